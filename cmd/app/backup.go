@@ -0,0 +1,133 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/kyverno/policy-server/pkg/backup"
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/wait"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/klog/v2"
+)
+
+type backupOptions struct {
+	Storage string
+	File    string
+	Format  string
+}
+
+func (o *backupOptions) Flags(name string) (fs cliflag.NamedFlagSets) {
+	bfs := fs.FlagSet(name)
+	bfs.StringVar(&o.Storage, "storage", o.Storage, "Storage holding the reports, memory:// or the comma separated http(s) endpoints of kine.")
+	bfs.StringVar(&o.File, "file", o.File, "Path of the archive, - for the standard input or output.")
+	bfs.StringVar(&o.Format, "format", o.Format, fmt.Sprintf("Format of the archive, one of %v.", backup.Formats))
+	return fs
+}
+
+func (o *backupOptions) Validate() error {
+	if len(o.Storage) == 0 {
+		return fmt.Errorf("--storage should be provided")
+	}
+	if !slices.Contains(backup.Formats, backup.Format(o.Format)) {
+		return fmt.Errorf("format should be one of %v, but value %q provided", backup.Formats, o.Format)
+	}
+	return nil
+}
+
+func newBackupCommand(stopCh <-chan struct{}) *cobra.Command {
+	o := &backupOptions{File: "-", Format: string(backup.NDJSON)}
+	cmd := &cobra.Command{
+		Use:   "backup --storage <storage-url> --file <archive>",
+		Short: "Back up policy reports to an archive",
+		Long:  "Write every policy report and cluster policy report of a storage to an archive, as of a single revision of the storage.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			return runBackup(o, stopCh)
+		},
+	}
+	nfs := o.Flags("backup")
+	for _, f := range nfs.FlagSets {
+		cmd.Flags().AddFlagSet(f)
+	}
+	setUsage(cmd, nfs)
+	return cmd
+}
+
+func newRestoreCommand(stopCh <-chan struct{}) *cobra.Command {
+	o := &backupOptions{File: "-", Format: string(backup.NDJSON)}
+	cmd := &cobra.Command{
+		Use:   "restore --storage <storage-url> --file <archive>",
+		Short: "Restore policy reports from an archive",
+		Long:  "Create or update the reports of an archive in a storage. Reports already holding the archived content are left untouched, so an archive can be restored more than once.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			return runRestore(o, stopCh)
+		},
+	}
+	nfs := o.Flags("restore")
+	for _, f := range nfs.FlagSets {
+		cmd.Flags().AddFlagSet(f)
+	}
+	setUsage(cmd, nfs)
+	return cmd
+}
+
+func runBackup(o *backupOptions, stopCh <-chan struct{}) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	store, err := storage.NewStorageFromURL(o.Storage)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var w io.Writer = os.Stdout
+	if o.File != "-" {
+		f, err := os.Create(o.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := backup.Backup(wait.ContextForChannel(stopCh), store, w, backup.Format(o.Format))
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Backup complete", "reports", count)
+	return nil
+}
+
+func runRestore(o *backupOptions, stopCh <-chan struct{}) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	store, err := storage.NewStorageFromURL(o.Storage)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var r io.Reader = os.Stdin
+	if o.File != "-" {
+		f, err := os.Open(o.File)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	result, err := backup.Restore(wait.ContextForChannel(stopCh), store, r, backup.Format(o.Format))
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Restore complete", "created", result.Created, "updated", result.Updated, "unchanged", result.Unchanged)
+	return nil
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/kyverno/policy-server/cmd/app/opts"
+	"github.com/kyverno/policy-server/pkg/importer"
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/klog/v2"
+)
+
+type importOptions struct {
+	Storage    string
+	Kubeconfig string
+	PageSize   int64
+}
+
+func (o *importOptions) Flags() (fs cliflag.NamedFlagSets) {
+	ifs := fs.FlagSet("import")
+	ifs.StringVar(&o.Storage, "storage", o.Storage, "Storage to import the reports into, memory:// or the comma separated http(s) endpoints of kine.")
+	ifs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "The path to the kubeconfig used to connect to the Kubernetes API server serving the custom resources (defaults to in-cluster config)")
+	ifs.Int64Var(&o.PageSize, "page-size", o.PageSize, "Number of reports listed per request.")
+	return fs
+}
+
+func (o *importOptions) Validate() error {
+	if len(o.Storage) == 0 {
+		return fmt.Errorf("--storage should be provided")
+	}
+	if o.PageSize <= 0 {
+		return fmt.Errorf("page-size should be positive, but value %v provided", o.PageSize)
+	}
+	return nil
+}
+
+func newImportCommand(stopCh <-chan struct{}) *cobra.Command {
+	o := &importOptions{PageSize: 500}
+	cmd := &cobra.Command{
+		Use:   "import --storage <storage-url>",
+		Short: "Import the policy reports stored as custom resources",
+		Long:  "Copy the policy reports served by the wgpolicyk8s.io custom resources into a storage. Run it before registering the APIService of policy-server, the custom resources are not reachable once it took over the group.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			return runImport(o, stopCh)
+		},
+	}
+	nfs := o.Flags()
+	for _, f := range nfs.FlagSets {
+		cmd.Flags().AddFlagSet(f)
+	}
+	setUsage(cmd, nfs)
+	return cmd
+}
+
+func runImport(o *importOptions, stopCh <-chan struct{}) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	restConfig, err := opts.Options{Kubeconfig: o.Kubeconfig}.RestConfig()
+	if err != nil {
+		return err
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	store, err := storage.NewStorageFromURL(o.Storage)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, err := importer.Import(wait.ContextForChannel(stopCh), client, store, o.PageSize)
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Import complete", "created", result.Created, "updated", result.Updated, "unchanged", result.Unchanged)
+	return nil
+}
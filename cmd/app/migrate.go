@@ -0,0 +1,85 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/wait"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/klog/v2"
+)
+
+// memoryStorage is the url of the in-memory database.
+const memoryStorage = "memory://"
+
+type migrateOptions struct {
+	From   string
+	To     string
+	Prefix string
+}
+
+func (o *migrateOptions) Flags() (fs cliflag.NamedFlagSets) {
+	mfs := fs.FlagSet("migrate")
+	mfs.StringVar(&o.From, "from", o.From, "Storage to migrate from, the comma separated http(s) endpoints of kine.")
+	mfs.StringVar(&o.To, "to", o.To, "Storage to migrate to, the comma separated http(s) endpoints of kine.")
+	mfs.StringVar(&o.Prefix, "prefix", o.Prefix, "Prefix of the keys to migrate.")
+	return fs
+}
+
+func (o *migrateOptions) Validate() error {
+	if len(o.From) == 0 || len(o.To) == 0 {
+		return fmt.Errorf("both --from and --to should be provided")
+	}
+	if o.From == o.To {
+		return fmt.Errorf("--from and --to should be different storages")
+	}
+	// the in-memory database only lives as long as the command
+	if o.From == memoryStorage || o.To == memoryStorage {
+		return fmt.Errorf("--from and --to should not be %s", memoryStorage)
+	}
+	return nil
+}
+
+func newMigrateCommand(stopCh <-chan struct{}) *cobra.Command {
+	o := &migrateOptions{Prefix: "/apis/"}
+	cmd := &cobra.Command{
+		Use:   "migrate --from <storage-url> --to <storage-url>",
+		Short: "Migrate policy reports between storages",
+		Long:  "Copy every stored policy report to another storage, preserving their metadata. Keys already copied are skipped, so an interrupted migration can be run again.",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			return runMigrate(o, stopCh)
+		},
+	}
+	nfs := o.Flags()
+	for _, f := range nfs.FlagSets {
+		cmd.Flags().AddFlagSet(f)
+	}
+	setUsage(cmd, nfs)
+	return cmd
+}
+
+func runMigrate(o *migrateOptions, stopCh <-chan struct{}) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	from, err := storage.NewStorageFromURL(o.From)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+	to, err := storage.NewStorageFromURL(o.To)
+	if err != nil {
+		return err
+	}
+	defer to.Close()
+
+	result, err := storage.Migrate(wait.ContextForChannel(stopCh), from, to, o.Prefix)
+	if err != nil {
+		return err
+	}
+	klog.InfoS("Migration complete", "created", result.Created, "updated", result.Updated, "skipped", result.Skipped)
+	return nil
+}
@@ -7,15 +7,21 @@ import (
 	"time"
 
 	"github.com/kyverno/policy-server/pkg/api"
-	generatedopenapi "github.com/kyverno/policy-server/pkg/api/generated/openapi"
+	"github.com/kyverno/policy-server/pkg/leaderelection"
 	"github.com/kyverno/policy-server/pkg/server"
 	openapinamer "k8s.io/apiserver/pkg/endpoints/openapi"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	genericoptions "k8s.io/apiserver/pkg/server/options"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/pkg/version"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/component-base/cli/flag"
+	componentbaseconfig "k8s.io/component-base/config"
+	componentbaseoptions "k8s.io/component-base/config/options"
 	"k8s.io/component-base/logs"
 	logsapi "k8s.io/component-base/logs/api/v1"
 	_ "k8s.io/component-base/logs/json/register"
@@ -27,13 +33,21 @@ type Options struct {
 	Authentication *genericoptions.DelegatingAuthenticationOptions
 	Authorization  *genericoptions.DelegatingAuthorizationOptions
 	Audit          *genericoptions.AuditOptions
+	Admission      *genericoptions.AdmissionOptions
 	Features       *genericoptions.FeatureOptions
 	Logging        *logs.Options
+	LeaderElection componentbaseconfig.LeaderElectionConfiguration
 
 	MetricResolution time.Duration
 	ShowVersion      bool
 	Debug            bool
 	Kubeconfig       string
+	GenericRegistry  bool
+	Quota            api.Quota
+	RulesFile        string
+	Retention        api.Retention
+	GCInterval       time.Duration
+	ClientSummaries  bool
 
 	// Only to be used to for testing
 	DisableAuthForTesting bool
@@ -41,6 +55,7 @@ type Options struct {
 
 func (o *Options) Validate() []error {
 	errors := o.validate()
+	errors = append(errors, o.Admission.Validate()...)
 	err := logsapi.ValidateAndApply(o.Logging, nil)
 	if err != nil {
 		errors = append(errors, err)
@@ -53,6 +68,18 @@ func (o *Options) validate() []error {
 	if o.MetricResolution < 10*time.Second {
 		errors = append(errors, fmt.Errorf("metric-resolution should be a time duration at least 10s, but value %v provided", o.MetricResolution))
 	}
+	if o.Quota.MaxReportsPerNamespace < 0 || o.Quota.MaxBytesPerNamespace < 0 || o.Quota.MaxReportBytes < 0 {
+		errors = append(errors, fmt.Errorf("quotas should not be negative, but values %+v provided", o.Quota))
+	}
+	if o.Retention.TTL < 0 || o.Retention.Interval < 0 {
+		errors = append(errors, fmt.Errorf("retention-ttl and retention-interval should not be negative, but values %v and %v provided", o.Retention.TTL, o.Retention.Interval))
+	}
+	if o.GCInterval < 0 {
+		errors = append(errors, fmt.Errorf("gc-interval should not be negative, but value %v provided", o.GCInterval))
+	}
+	if o.LeaderElection.LeaderElect && o.LeaderElection.RenewDeadline.Duration >= o.LeaderElection.LeaseDuration.Duration {
+		errors = append(errors, fmt.Errorf("leader-elect-renew-deadline should be less than leader-elect-lease-duration, but values %v and %v provided", o.LeaderElection.RenewDeadline.Duration, o.LeaderElection.LeaseDuration.Duration))
+	}
 	return errors
 }
 
@@ -61,12 +88,31 @@ func (o *Options) Flags() (fs flag.NamedFlagSets) {
 	msfs.DurationVar(&o.MetricResolution, "metric-resolution", o.MetricResolution, "The resolution at which policy-server will retain metrics, must set value at least 10s.")
 	msfs.BoolVar(&o.Debug, "debug", false, "Use inmemory database for debugging")
 	msfs.BoolVar(&o.ShowVersion, "version", false, "Show version")
+	msfs.BoolVar(&o.GenericRegistry, "generic-registry", o.GenericRegistry, "Serve reports through the upstream generic registry instead of the built-in stores.")
+	msfs.BoolVar(&o.ClientSummaries, "client-summaries", o.ClientSummaries, "Keep the summaries submitted by writers instead of deriving them from the results of reports, the "+api.ClientSummaryAnnotation+" annotation does so per report.")
 	msfs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "The path to the kubeconfig used to connect to the Kubernetes API server and the Kubelets (defaults to in-cluster config)")
 
+	qfs := fs.FlagSet("quota")
+	qfs.Int64Var(&o.Quota.MaxReportsPerNamespace, "quota-max-reports-per-namespace", o.Quota.MaxReportsPerNamespace, "Maximum number of reports stored per namespace, cluster policy reports count as a namespace of their own. 0 disables the limit.")
+	qfs.Int64Var(&o.Quota.MaxBytesPerNamespace, "quota-max-bytes-per-namespace", o.Quota.MaxBytesPerNamespace, "Maximum size in bytes of the reports stored per namespace. 0 disables the limit.")
+	qfs.Int64Var(&o.Quota.MaxReportBytes, "quota-max-report-bytes", o.Quota.MaxReportBytes, "Maximum size in bytes of a single report. 0 disables the limit.")
+
+	vfs := fs.FlagSet("validation")
+	vfs.StringVar(&o.RulesFile, "validation-rules-file", o.RulesFile, "Path to a YAML file of CEL rules reports are validated against on creates and updates.")
+
+	rfs := fs.FlagSet("retention")
+	rfs.DurationVar(&o.Retention.TTL, "retention-ttl", o.Retention.TTL, "Time after their last update at which reports are deleted, the "+api.TTLAnnotation+" annotation overrides it per report. 0 keeps reports forever.")
+	rfs.DurationVar(&o.Retention.Interval, "retention-interval", o.Retention.Interval, "Period at which the leader checks reports for expiry, 0 disables retention.")
+
+	gcfs := fs.FlagSet("garbage collection")
+	gcfs.DurationVar(&o.GCInterval, "gc-interval", o.GCInterval, "Period at which the leader deletes the reports whose scope and owners no longer exist, 0 disables garbage collection.")
+
+	componentbaseoptions.BindLeaderElectionFlags(&o.LeaderElection, fs.FlagSet("leader election"))
 	o.SecureServing.AddFlags(fs.FlagSet("apiserver secure serving"))
 	o.Authentication.AddFlags(fs.FlagSet("apiserver authentication"))
 	o.Authorization.AddFlags(fs.FlagSet("apiserver authorization"))
 	o.Audit.AddFlags(fs.FlagSet("apiserver audit log"))
+	o.Admission.AddFlags(fs.FlagSet("apiserver admission"))
 	o.Features.AddFlags(fs.FlagSet("features"))
 	logsapi.AddFlags(o.Logging, fs.FlagSet("logging"))
 
@@ -81,9 +127,12 @@ func NewOptions() *Options {
 		Authorization:  genericoptions.NewDelegatingAuthorizationOptions(),
 		Features:       genericoptions.NewFeatureOptions(),
 		Audit:          genericoptions.NewAuditOptions(),
+		Admission:      genericoptions.NewAdmissionOptions(),
 		Logging:        logs.NewOptions(),
+		LeaderElection: leaderelection.DefaultConfiguration(),
 
 		MetricResolution: 60 * time.Second,
+		Retention:        api.Retention{Interval: 10 * time.Minute},
 	}
 }
 
@@ -92,15 +141,33 @@ func (o Options) ServerConfig() (*server.Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	restConfig, err := o.restConfig()
+	restConfig, err := o.RestConfig()
+	if err != nil {
+		return nil, err
+	}
+	informerFactory, err := o.applyAdmission(apiserver, restConfig)
 	if err != nil {
 		return nil, err
 	}
+	var rules *api.Rules
+	if len(o.RulesFile) > 0 {
+		if rules, err = api.LoadRules(o.RulesFile); err != nil {
+			return nil, err
+		}
+	}
 	return &server.Config{
 		Apiserver:        apiserver,
 		Rest:             restConfig,
+		Informers:        informerFactory,
 		MetricResolution: o.MetricResolution,
 		Debug:            o.Debug,
+		GenericRegistry:  o.GenericRegistry,
+		LeaderElection:   o.LeaderElection,
+		Quota:            o.Quota,
+		Retention:        o.Retention,
+		GCInterval:       o.GCInterval,
+		ClientSummaries:  o.ClientSummaries,
+		Rules:            rules,
 	}, nil
 }
 
@@ -130,8 +197,8 @@ func (o Options) ApiserverConfig() (*genericapiserver.Config, error) {
 	versionGet := version.Get()
 	serverConfig.Version = &versionGet
 	// enable OpenAPI schemas
-	serverConfig.OpenAPIConfig = genericapiserver.DefaultOpenAPIConfig(generatedopenapi.GetOpenAPIDefinitions, openapinamer.NewDefinitionNamer(api.Scheme))
-	serverConfig.OpenAPIV3Config = genericapiserver.DefaultOpenAPIV3Config(generatedopenapi.GetOpenAPIDefinitions, openapinamer.NewDefinitionNamer(api.Scheme))
+	serverConfig.OpenAPIConfig = genericapiserver.DefaultOpenAPIConfig(api.GetOpenAPIDefinitions, openapinamer.NewDefinitionNamer(api.Scheme))
+	serverConfig.OpenAPIV3Config = genericapiserver.DefaultOpenAPIV3Config(api.GetOpenAPIDefinitions, openapinamer.NewDefinitionNamer(api.Scheme))
 	serverConfig.OpenAPIConfig.Info.Title = "policy-server"
 	serverConfig.OpenAPIV3Config.Info.Title = "policy-server"
 	serverConfig.OpenAPIConfig.Info.Version = strings.Split(serverConfig.Version.String(), "-")[0] // TODO(directxman12): remove this once autosetting this doesn't require security definitions
@@ -140,7 +207,27 @@ func (o Options) ApiserverConfig() (*genericapiserver.Config, error) {
 	return serverConfig, nil
 }
 
-func (o Options) restConfig() (*rest.Config, error) {
+// applyAdmission sets up the admission chain of the reports, namespace
+// lifecycle, admission webhooks and policies, and returns the informers it
+// relies on. They must be started with the server.
+func (o Options) applyAdmission(serverConfig *genericapiserver.Config, restConfig *rest.Config) (informers.SharedInformerFactory, error) {
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 10*time.Minute)
+	if err := o.Admission.ApplyTo(serverConfig, informerFactory, kubeClient, dynamicClient, utilfeature.DefaultFeatureGate); err != nil {
+		return nil, err
+	}
+	return informerFactory, nil
+}
+
+// RestConfig returns the config of the client of the Kubernetes API server.
+func (o Options) RestConfig() (*rest.Config, error) {
 	var config *rest.Config
 	var err error
 	if len(o.Kubeconfig) > 0 {
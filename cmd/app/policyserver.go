@@ -16,6 +16,7 @@ import (
 func NewPolicyServer(stopCh <-chan struct{}) *cobra.Command {
 	opts := opts.NewOptions()
 	cmd := &cobra.Command{
+		Use:   "policy-server",
 		Short: "Launch policy-server",
 		Long:  "Launch policy-server",
 		RunE: func(c *cobra.Command, args []string) error {
@@ -34,6 +35,18 @@ func NewPolicyServer(stopCh <-chan struct{}) *cobra.Command {
 	logs.AddGoFlags(local)
 	nfs.FlagSet("logging").AddGoFlagSet(local)
 
+	setUsage(cmd, nfs)
+	fs.AddGoFlagSet(local)
+
+	cmd.AddCommand(newMigrateCommand(stopCh))
+	cmd.AddCommand(newBackupCommand(stopCh))
+	cmd.AddCommand(newRestoreCommand(stopCh))
+	cmd.AddCommand(newImportCommand(stopCh))
+	return cmd
+}
+
+// setUsage prints the usage and help of cmd with its flags grouped in sections.
+func setUsage(cmd *cobra.Command, nfs cliflag.NamedFlagSets) {
 	usageFmt := "Usage:\n  %s\n"
 	cols, _, _ := term.TerminalSize(cmd.OutOrStdout())
 	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
@@ -45,8 +58,6 @@ func NewPolicyServer(stopCh <-chan struct{}) *cobra.Command {
 		fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n"+usageFmt, cmd.Long, cmd.UseLine())
 		cliflag.PrintSections(cmd.OutOrStdout(), nfs, cols)
 	})
-	fs.AddGoFlagSet(local)
-	return cmd
 }
 
 func runCommand(o *opts.Options, stopCh <-chan struct{}) error {
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	genericoptions "k8s.io/apiserver/pkg/server/options"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Admission", func() {
+	body := func(namespace string) string {
+		return fmt.Sprintf(`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"report","namespace":%q}}`, namespace)
+	}
+	reports := func(namespace string) string {
+		return "/apis/wgpolicyk8s.io/v1alpha2/namespaces/" + namespace + "/policyreports"
+	}
+
+	var handler http.Handler
+	BeforeEach(func() {
+		client := kubefake.NewSimpleClientset(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "active"}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "terminating"}, Status: corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating}},
+		)
+		factory := informers.NewSharedInformerFactory(client, 0)
+		config := newTestConfig()
+		err := genericoptions.NewAdmissionOptions().ApplyTo(config, factory, client, dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), utilfeature.DefaultFeatureGate)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		DeferCleanup(cancel)
+		factory.Start(ctx.Done())
+		for informer, synced := range factory.WaitForCacheSync(ctx.Done()) {
+			Expect(synced).To(BeTrue(), "%v did not sync", informer)
+		}
+		handler = startTestServer(config, inmemory.New(), Options{})
+	})
+
+	It("should admit reports in active namespaces", func() {
+		rec := serve(handler, http.MethodPost, reports("active"), body("active"))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+	})
+
+	It("should reject reports in terminating namespaces", func() {
+		rec := serve(handler, http.MethodPost, reports("terminating"), body("terminating"))
+		Expect(rec.Code).To(Equal(http.StatusForbidden), rec.Body.String())
+		Expect(rec.Body.String()).To(ContainSubstring("being terminated"))
+	})
+
+	It("should reject reports in missing namespaces", func() {
+		rec := serve(handler, http.MethodPost, reports("missing"), body("missing"))
+		Expect(rec.Code).To(Equal(http.StatusNotFound), rec.Body.String())
+	})
+})
+
+// denyPolicy is a validating admission plugin rejecting the reports with a
+// result of the policy named denied.
+type denyPolicy struct{}
+
+func (denyPolicy) Handles(admission.Operation) bool {
+	return true
+}
+
+func (denyPolicy) Validate(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	report, ok := a.GetObject().(*v1alpha2.PolicyReport)
+	if !ok || len(a.GetSubresource()) > 0 {
+		return nil
+	}
+	if slices.ContainsFunc(report.Results, func(result *v1alpha2.PolicyReportResult) bool { return result.Policy == "denied" }) {
+		return admission.NewForbidden(a, fmt.Errorf("policy denied"))
+	}
+	return nil
+}
+
+var _ = Describe("Validating admission", func() {
+	const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+	body := func(policy string) string {
+		return fmt.Sprintf(`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a"},"results":[{"policy":%q,"result":"pass"}]}`, policy)
+	}
+
+	var handler http.Handler
+	BeforeEach(func() {
+		config := newTestConfig()
+		config.AdmissionControl = denyPolicy{}
+		handler = startTestServer(config, inmemory.New(), Options{})
+	})
+
+	It("should run on server-side applies", func() {
+		rec := apply(handler, reports+"/a", body("denied"))
+		Expect(rec.Code).To(Equal(http.StatusForbidden), rec.Body.String())
+		rec = serve(handler, http.MethodGet, reports+"/a", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound), rec.Body.String())
+
+		rec = apply(handler, reports+"/a", body("allowed"))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		rec = apply(handler, reports+"/a", body("denied"))
+		Expect(rec.Code).To(Equal(http.StatusForbidden), rec.Body.String())
+	})
+
+	It("should run on the updates made through the results subresource", func() {
+		rec := serve(handler, http.MethodPost, reports, body("allowed"))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		rec = serve(handler, http.MethodPost, reports+"/a/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults","upsert":[{"policy":"denied","result":"fail"}]}`)
+		Expect(rec.Code).To(Equal(http.StatusForbidden), rec.Body.String())
+		rec = serve(handler, http.MethodGet, reports+"/a", "")
+		Expect(rec.Body.String()).NotTo(ContainSubstring("denied"))
+	})
+})
+
+// labelReports is a mutating admission plugin labelling the reports it
+// admits on updates.
+type labelReports struct{}
+
+func (labelReports) Handles(operation admission.Operation) bool {
+	return operation == admission.Update
+}
+
+func (labelReports) Admit(ctx context.Context, a admission.Attributes, o admission.ObjectInterfaces) error {
+	report, ok := a.GetObject().(*v1alpha2.PolicyReport)
+	if !ok || len(a.GetSubresource()) > 0 {
+		return nil
+	}
+	metav1.SetMetaDataLabel(&report.ObjectMeta, "admitted", "true")
+	return nil
+}
+
+var _ = Describe("Mutating admission", func() {
+	const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+
+	It("should run on the updates made through the results subresource", func() {
+		config := newTestConfig()
+		config.AdmissionControl = labelReports{}
+		handler := startTestServer(config, inmemory.New(), Options{})
+		rec := serve(handler, http.MethodPost, reports, `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a"}}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		Expect(rec.Body.String()).NotTo(ContainSubstring("admitted"))
+
+		rec = serve(handler, http.MethodPost, reports+"/a/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults","upsert":[{"policy":"p","result":"fail"}]}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		rec = serve(handler, http.MethodGet, reports+"/a", "")
+		var report v1alpha2.PolicyReport
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		Expect(report.Labels).To(HaveKeyWithValue("admitted", "true"))
+		Expect(report.Summary).To(Equal(v1alpha2.PolicyReportSummary{Fail: 1}))
+	})
+})
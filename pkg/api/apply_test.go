@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Server-side apply", func() {
+	const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+	body := func(result string) string {
+		return fmt.Sprintf(`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a"},"results":[{"policy":"p","result":%q}]}`, result)
+	}
+
+	var handler http.Handler
+	BeforeEach(func() {
+		handler = newTestServer(inmemory.New(), Options{})
+	})
+
+	It("should create and update reports", func() {
+		rec := apply(handler, reports+"/a", body("fail"))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		var report v1alpha2.PolicyReport
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		Expect(report.Summary).To(Equal(v1alpha2.PolicyReportSummary{Fail: 1}))
+
+		rec = apply(handler, reports+"/a", body("pass"))
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		rec = serve(handler, http.MethodGet, reports+"/a", "")
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		Expect(report.Summary).To(Equal(v1alpha2.PolicyReportSummary{Pass: 1}))
+	})
+
+	It("should validate reports", func() {
+		rec := apply(handler, reports+"/a", body("bogus"))
+		Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity), rec.Body.String())
+		rec = serve(handler, http.MethodGet, reports+"/a", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound), rec.Body.String())
+
+		Expect(apply(handler, reports+"/a", body("pass")).Code).To(Equal(http.StatusCreated))
+		rec = apply(handler, reports+"/a", body("bogus"))
+		Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity), rec.Body.String())
+	})
+
+	It("should apply cluster policy reports", func() {
+		rec := apply(handler, "/apis/wgpolicyk8s.io/v1alpha2/clusterpolicyreports/a", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"ClusterPolicyReport","metadata":{"name":"a"}}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		rec = apply(handler, "/apis/wgpolicyk8s.io/v1alpha2/clusterpolicyreports/a", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"ClusterPolicyReport","metadata":{"name":"a","labels":{"a":"b"}}}`)
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+	})
+})
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+// DroppedResultsAnnotation records how many results of a report were dropped
+// by the limits of the configuration it was written with.
+const DroppedResultsAnnotation = "policy-server.io/dropped-results"
+
+// maxConfigurationBodyBytes bounds the bodies read for their configuration,
+// larger bodies are passed on for the server to reject.
+const maxConfigurationBodyBytes = 3 << 20
+
+// Configuration is the configuration field of the body of report writes,
+// which the vendored report types do not have. It is read from the body by
+// WithConfiguration and applies to the results of that write. It is not
+// stored with the report, so it is left out of the OpenAPI schema of reports.
+type Configuration struct {
+	Limits Limits `json:"limits"`
+}
+
+// Limits bound the results stored in a report.
+type Limits struct {
+	// MaxResults is the maximum number of results of the report, 0 disables
+	// the limit.
+	MaxResults int `json:"maxResults,omitempty"`
+	// StatusFilter is the results to keep, all of them if it is empty.
+	StatusFilter []v1alpha2.PolicyResult `json:"statusFilter,omitempty"`
+}
+
+type configurationKey struct{}
+
+func withConfiguration(ctx context.Context, configuration *Configuration) context.Context {
+	return context.WithValue(ctx, configurationKey{}, configuration)
+}
+
+func configurationFrom(ctx context.Context) *Configuration {
+	configuration, _ := ctx.Value(configurationKey{}).(*Configuration)
+	return configuration
+}
+
+// WithConfiguration reads the configuration of the reports written by a
+// request and removes it from the body before it is decoded, so that strict
+// field validation does not reject it. It must run after the request info is
+// set.
+func WithConfiguration(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		info, ok := genericapirequest.RequestInfoFrom(req.Context())
+		if !ok || !writesReport(info) || req.Body == nil {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		data, err := io.ReadAll(io.LimitReader(req.Body, maxConfigurationBodyBytes+1))
+		if err != nil {
+			responsewriters.ErrorNegotiated(errors.NewBadRequest(err.Error()), Codecs, v1alpha2.SchemeGroupVersion, w, req)
+			return
+		}
+		if len(data) > maxConfigurationBodyBytes {
+			req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(data), req.Body), Closer: req.Body}
+			handler.ServeHTTP(w, req)
+			return
+		}
+		configuration, body, err := extractConfiguration(data)
+		if err != nil {
+			responsewriters.ErrorNegotiated(err, Codecs, v1alpha2.SchemeGroupVersion, w, req)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		if configuration != nil {
+			req = req.WithContext(withConfiguration(req.Context(), configuration))
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func writesReport(info *genericapirequest.RequestInfo) bool {
+	if !info.IsResourceRequest || info.APIGroup != v1alpha2.SchemeGroupVersion.Group || len(info.Subresource) > 0 {
+		return false
+	}
+	if info.Resource != "policyreports" && info.Resource != "clusterpolicyreports" {
+		return false
+	}
+	return info.Verb == "create" || info.Verb == "update" || info.Verb == "patch"
+}
+
+// extractConfiguration returns the configuration of the JSON or YAML object in
+// data, and data without it. Bodies which are not an object, such as JSON
+// patches, are returned unchanged.
+func extractConfiguration(data []byte) (*Configuration, []byte, error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, data, nil
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(jsonData, &object); err != nil {
+		return nil, data, nil
+	}
+	raw, ok := object["configuration"]
+	if !ok {
+		return nil, data, nil
+	}
+	delete(object, "configuration")
+	body, err := json.Marshal(object)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.Equal(raw, []byte("null")) {
+		return nil, body, nil
+	}
+
+	var configuration Configuration
+	if err := json.Unmarshal(raw, &configuration); err != nil {
+		return nil, nil, errors.NewBadRequest(fmt.Sprintf("invalid configuration: %v", err))
+	}
+	if errs := validateConfiguration(&configuration, field.NewPath("configuration")); len(errs) > 0 {
+		return nil, nil, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("PolicyReport").GroupKind(), "", errs)
+	}
+	return &configuration, body, nil
+}
+
+func validateConfiguration(configuration *Configuration, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	limitsPath := fldPath.Child("limits")
+	if configuration.Limits.MaxResults < 0 {
+		allErrs = append(allErrs, field.Invalid(limitsPath.Child("maxResults"), configuration.Limits.MaxResults, "must be greater than or equal to 0"))
+	}
+	for i, status := range configuration.Limits.StatusFilter {
+		if !slices.Contains(Results, status) {
+			allErrs = append(allErrs, field.NotSupported(limitsPath.Child("statusFilter").Index(i), status, Results))
+		}
+	}
+	return allErrs
+}
+
+// limitResults applies the limits of the configuration of the request to the
+// results of report. Results whose status is not in the filter are dropped,
+// then the results are ordered by severity, the most severe first, and cut to
+// the maximum number of results. The number of dropped results is recorded in
+// the DroppedResultsAnnotation of report. Writes without a configuration, such
+// as the changes made through the results subresource, leave the annotation as
+// it is.
+func limitResults(ctx context.Context, report metav1.Object, results []*v1alpha2.PolicyReportResult) []*v1alpha2.PolicyReportResult {
+	configuration := configurationFrom(ctx)
+	if configuration == nil {
+		return results
+	}
+	annotations := report.GetAnnotations()
+	delete(annotations, DroppedResultsAnnotation)
+	report.SetAnnotations(annotations)
+
+	limits := configuration.Limits
+	kept := results
+	if len(limits.StatusFilter) > 0 {
+		kept = make([]*v1alpha2.PolicyReportResult, 0, len(results))
+		for _, result := range results {
+			if result != nil && slices.Contains(limits.StatusFilter, result.Result) {
+				kept = append(kept, result)
+			}
+		}
+	}
+	if limits.MaxResults > 0 && len(kept) > limits.MaxResults {
+		kept = slices.Clone(kept)
+		sort.SliceStable(kept, func(i, j int) bool {
+			return severityRank(kept[i]) < severityRank(kept[j])
+		})
+		kept = kept[:limits.MaxResults]
+	}
+	if dropped := len(results) - len(kept); dropped > 0 {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[DroppedResultsAnnotation] = strconv.Itoa(dropped)
+		report.SetAnnotations(annotations)
+	}
+	return kept
+}
+
+// severityRank orders results by Severities, results without a severity come
+// last.
+func severityRank(result *v1alpha2.PolicyReportResult) int {
+	if result == nil {
+		return len(Severities) + 1
+	}
+	if rank := slices.Index(Severities, result.Severity); rank >= 0 {
+		return rank
+	}
+	return len(Severities)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Configuration", func() {
+	const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+	body := func(name, configuration string) string {
+		return fmt.Sprintf(`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":%q},"configuration":%s,"results":[`+
+			`{"policy":"a","result":"pass","severity":"low"},`+
+			`{"policy":"b","result":"fail","severity":"medium"},`+
+			`{"policy":"c","result":"fail"},`+
+			`{"policy":"d","result":"fail","severity":"critical"},`+
+			`{"policy":"e","result":"skip","severity":"high"}]}`, name, configuration)
+	}
+	reportOf := func(body []byte) *v1alpha2.PolicyReport {
+		var report v1alpha2.PolicyReport
+		Expect(json.Unmarshal(body, &report)).To(Succeed())
+		return &report
+	}
+	policies := func(report *v1alpha2.PolicyReport) []string {
+		var policies []string
+		for _, result := range report.Results {
+			policies = append(policies, result.Policy)
+		}
+		return policies
+	}
+
+	var handler http.Handler
+	BeforeEach(func() {
+		handler = newTestServer(inmemory.New(), Options{})
+	})
+
+	It("should filter results by status and keep the most severe ones", func() {
+		rec := serve(handler, http.MethodPost, reports+"?fieldValidation=Strict", body("a", `{"limits":{"maxResults":2,"statusFilter":["fail","pass"]}}`))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		report := reportOf(rec.Body.Bytes())
+		Expect(policies(report)).To(Equal([]string{"d", "b"}))
+		Expect(report.Annotations).To(HaveKeyWithValue(DroppedResultsAnnotation, "3"))
+		Expect(report.Summary).To(Equal(v1alpha2.PolicyReportSummary{Fail: 2}))
+
+		rec = serve(handler, http.MethodGet, reports+"/a", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		Expect(policies(reportOf(rec.Body.Bytes()))).To(Equal([]string{"d", "b"}))
+	})
+
+	It("should keep every result without limits", func() {
+		rec := serve(handler, http.MethodPost, reports, body("a", `{"limits":{"maxResults":2}}`))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+
+		rec = serve(handler, http.MethodPut, reports+"/a", body("a", "null"))
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		report := reportOf(rec.Body.Bytes())
+		Expect(policies(report)).To(Equal([]string{"a", "b", "c", "d", "e"}))
+		Expect(report.Annotations).NotTo(HaveKey(DroppedResultsAnnotation))
+	})
+
+	It("should reject invalid limits", func() {
+		rec := serve(handler, http.MethodPost, reports, body("a", `{"limits":{"maxResults":-1,"statusFilter":["bad"]}}`))
+		Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity), rec.Body.String())
+		Expect(rec.Body.String()).To(ContainSubstring("configuration.limits.maxResults"))
+		Expect(rec.Body.String()).To(ContainSubstring("configuration.limits.statusFilter[0]"))
+	})
+
+	It("should keep the dropped results of changes made without a configuration", func() {
+		rec := serve(handler, http.MethodPost, reports, body("a", `{"limits":{"maxResults":2}}`))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+
+		rec = serve(handler, http.MethodPost, reports+"/a/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults","upsert":[{"policy":"f","result":"pass"}]}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		report := reportOf(rec.Body.Bytes())
+		Expect(report.Results).To(HaveLen(3))
+		Expect(report.Annotations).To(HaveKeyWithValue(DroppedResultsAnnotation, "3"))
+	})
+})
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"slices"
 	"strconv"
+	"time"
 
 	"github.com/kyverno/policy-server/pkg/storage"
 	errorpkg "github.com/pkg/errors"
@@ -14,7 +15,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/apimachinery/pkg/watch"
@@ -24,17 +24,41 @@ import (
 )
 
 type cpolrStore struct {
-	broadcaster *watch.Broadcaster
-	store       storage.Storage
+	store      storage.Storage
+	watchCache *storage.WatchCache
+	reflector  *storage.Reflector
+	usage      *storage.Usage
+	quota      Quota
+	rules      *Rules
+	// clientSummaries keeps the summaries submitted by writers.
+	clientSummaries bool
+	stop            context.CancelFunc
 }
 
-func ClusterPolicyReportStore(store storage.Storage) API {
-	broadcaster := watch.NewBroadcaster(1000, watch.WaitIfChannelFull)
+func ClusterPolicyReportStore(store storage.Storage, usage *storage.Usage, quota Quota, rules *Rules, clientSummaries bool, observers ...storage.Observer) (API, error) {
+	c := &cpolrStore{
+		store:           store,
+		watchCache:      storage.NewWatchCache("clusterpolicyreports", watchCacheCapacity),
+		usage:           usage,
+		quota:           quota,
+		rules:           rules,
+		clientSummaries: clientSummaries,
+	}
+	reflector, stop, err := startReflector(store, "clusterpolicyreports", c.keyForList(), c.watchCache, decodeClusterPolicyReport, append([]storage.Observer{usage}, observers...)...)
+	if err != nil {
+		return nil, err
+	}
+	c.reflector, c.stop = reflector, stop
+	return c, nil
+}
 
-	return &cpolrStore{
-		broadcaster: broadcaster,
-		store:       store,
+// decodeClusterPolicyReport decodes a cluster policy report stored in the backend.
+func decodeClusterPolicyReport(data []byte) (runtime.Object, error) {
+	var report v1alpha2.ClusterPolicyReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
 	}
+	return &report, nil
 }
 
 func (c *cpolrStore) New() runtime.Object {
@@ -42,6 +66,9 @@ func (c *cpolrStore) New() runtime.Object {
 }
 
 func (c *cpolrStore) Destroy() {
+	if c.stop != nil {
+		c.stop()
+	}
 }
 
 func (c *cpolrStore) Kind() string {
@@ -53,37 +80,25 @@ func (c *cpolrStore) NewList() runtime.Object {
 }
 
 func (c *cpolrStore) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
-	labelSelector := labels.Everything()
-	if options != nil && options.LabelSelector != nil {
-		labelSelector = options.LabelSelector
-	}
-	list, err := c.listCpolr()
+	objs, listMeta, err := listFor(ctx, c.watchCache, c.reflector, c.keyForList(), filterFor("", options), options)
 	if err != nil {
-		return &v1alpha2.ClusterPolicyReportList{}, errors.NewBadRequest("failed to list resource clusterpolicyreport")
+		return &v1alpha2.ClusterPolicyReportList{}, err
 	}
 
-	// if labelSelector.String() == labels.Everything().String() {
-	// 	return list, nil
-	// }
-
 	cpolrList := &v1alpha2.ClusterPolicyReportList{
-		Items: make([]v1alpha2.ClusterPolicyReport, 0),
+		ListMeta: listMeta,
+		Items:    make([]v1alpha2.ClusterPolicyReport, 0, len(objs)),
 	}
-	for _, cpolr := range list.Items {
-		if cpolr.Labels == nil {
-			return list, nil
-		}
-		if labelSelector.Matches(labels.Set(cpolr.Labels)) {
-			cpolrList.Items = append(cpolrList.Items, cpolr)
-		}
+	for _, obj := range objs {
+		cpolrList.Items = append(cpolrList.Items, *obj.(*v1alpha2.ClusterPolicyReport))
 	}
 
 	return cpolrList, nil
 }
 
 func (c *cpolrStore) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
-	report, err := c.getCpolr(name)
-	if err != nil || report == nil {
+	report, ok := c.watchCache.Get(c.key(name))
+	if !ok {
 		return &v1alpha2.ClusterPolicyReport{}, errors.NewNotFound(v1alpha2.Resource("clusterpolicyreports"), name)
 	}
 	return report, nil
@@ -92,31 +107,33 @@ func (c *cpolrStore) Get(ctx context.Context, name string, options *metav1.GetOp
 func (c *cpolrStore) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
 	isDryRun := slices.Contains(options.DryRun, "All")
 
-	err := createValidation(ctx, obj)
-	if err != nil {
-		switch options.FieldValidation {
-		case "Ignore":
-		case "Warn":
-			// return &admissionv1.AdmissionResponse{
-			// 	Allowed:  false,
-			// 	Warnings: []string{err.Error()},
-			// }, nil
-		case "Strict":
-			return &v1alpha2.ClusterPolicyReport{}, err
-		}
+	// options.FieldValidation applies to unknown and duplicate fields, which
+	// the handlers report while decoding, validation errors always fail.
+	if err := createValidation(ctx, obj); err != nil {
+		return &v1alpha2.ClusterPolicyReport{}, err
 	}
 
 	cpolr, ok := obj.(*v1alpha2.ClusterPolicyReport)
 	if !ok {
 		return &v1alpha2.ClusterPolicyReport{}, errors.NewBadRequest("failed to validate cluster policy report")
 	}
+	if errs := ValidateClusterPolicyReport(cpolr); len(errs) > 0 {
+		return &v1alpha2.ClusterPolicyReport{}, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("ClusterPolicyReport").GroupKind(), cpolr.Name, errs)
+	}
+	cpolr.Results = limitResults(ctx, cpolr, cpolr.Results)
+	setSummary(ctx, c.clientSummaries, cpolr, &cpolr.Summary, nil, cpolr.Results)
+	if errs := c.rules.Validate(c.Kind(), cpolr, nil); len(errs) > 0 {
+		return &v1alpha2.ClusterPolicyReport{}, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("ClusterPolicyReport").GroupKind(), cpolr.Name, errs)
+	}
 
 	if !isDryRun {
-		err := c.createCpolr(cpolr)
+		err := c.createCpolr(ctx, cpolr)
 		if err != nil {
+			if _, ok := err.(errors.APIStatus); ok {
+				return &v1alpha2.ClusterPolicyReport{}, err
+			}
 			return &v1alpha2.ClusterPolicyReport{}, errors.NewBadRequest(fmt.Sprintf("cannot create cluster policy report: %s", err.Error()))
 		}
-		c.broadcaster.Action(watch.Added, obj)
 	}
 
 	return obj, nil
@@ -125,17 +142,22 @@ func (c *cpolrStore) Create(ctx context.Context, obj runtime.Object, createValid
 func (c *cpolrStore) Update(ctx context.Context, name string, objInfo rest.UpdatedObjectInfo, createValidation rest.ValidateObjectFunc, updateValidation rest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
 	isDryRun := slices.Contains(options.DryRun, "All")
 
-	if forceAllowCreate {
-		oldObj, _ := c.getCpolr(name)
-		updatedObject, _ := objInfo.UpdatedObject(ctx, oldObj)
-		cpolr := updatedObject.(*v1alpha2.ClusterPolicyReport)
-		c.updatePolr(cpolr, true)
-		c.broadcaster.Action(watch.Added, updatedObject)
-		return updatedObject, true, nil
-	}
-
 	oldObj, err := c.getCpolr(name)
-	if err != nil {
+	if storage.IsNotFound(err) {
+		if !forceAllowCreate {
+			return &v1alpha2.ClusterPolicyReport{}, false, errors.NewNotFound(v1alpha2.Resource("clusterpolicyreports"), name)
+		}
+		// server-side apply creates the reports it does not find
+		updatedObject, err := objInfo.UpdatedObject(ctx, nil)
+		if err != nil {
+			return &v1alpha2.ClusterPolicyReport{}, false, err
+		}
+		created, err := c.Create(ctx, updatedObject, createValidation, &metav1.CreateOptions{DryRun: options.DryRun, FieldManager: options.FieldManager, FieldValidation: options.FieldValidation})
+		if err != nil {
+			return &v1alpha2.ClusterPolicyReport{}, false, err
+		}
+		return created, true, nil
+	} else if err != nil {
 		return &v1alpha2.ClusterPolicyReport{}, false, err
 	}
 
@@ -143,18 +165,8 @@ func (c *cpolrStore) Update(ctx context.Context, name string, objInfo rest.Updat
 	if err != nil {
 		return &v1alpha2.ClusterPolicyReport{}, false, err
 	}
-	err = updateValidation(ctx, updatedObject, oldObj)
-	if err != nil {
-		switch options.FieldValidation {
-		case "Ignore":
-		case "Warn":
-			// return &admissionv1.AdmissionResponse{
-			// 	Allowed:  false,
-			// 	Warnings: []string{err.Error()},
-			// }, nil
-		case "Strict":
-			return &v1alpha2.ClusterPolicyReport{}, false, err
-		}
+	if err := updateValidation(ctx, updatedObject, oldObj); err != nil {
+		return &v1alpha2.ClusterPolicyReport{}, false, err
 	}
 
 	cpolr, ok := updatedObject.(*v1alpha2.ClusterPolicyReport)
@@ -162,19 +174,42 @@ func (c *cpolrStore) Update(ctx context.Context, name string, objInfo rest.Updat
 		return &v1alpha2.ClusterPolicyReport{}, false, errors.NewBadRequest("failed to validate cluster policy report")
 	}
 
+	// unconditional updates apply on top of the version they were read from
+	if len(cpolr.ResourceVersion) == 0 {
+		cpolr.ResourceVersion = oldObj.ResourceVersion
+	}
+	remove, err := prepareUpdate(v1alpha2.Resource("clusterpolicyreports"), cpolr, oldObj, time.Now())
+	if err != nil {
+		return &v1alpha2.ClusterPolicyReport{}, false, err
+	}
+	if errs := ValidateClusterPolicyReportUpdate(cpolr, oldObj); len(errs) > 0 {
+		return &v1alpha2.ClusterPolicyReport{}, false, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("ClusterPolicyReport").GroupKind(), cpolr.Name, errs)
+	}
+	cpolr.Results = limitResults(ctx, cpolr, cpolr.Results)
+	setSummary(ctx, c.clientSummaries, cpolr, &cpolr.Summary, &oldObj.Summary, cpolr.Results)
+	if errs := c.rules.Validate(c.Kind(), cpolr, oldObj); len(errs) > 0 {
+		return &v1alpha2.ClusterPolicyReport{}, false, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("ClusterPolicyReport").GroupKind(), cpolr.Name, errs)
+	}
+
 	if !isDryRun {
-		err := c.createCpolr(cpolr)
+		// the last finalizer of a deleted report is gone, the update removes it
+		if remove {
+			err = c.deletePolr(ctx, cpolr)
+		} else {
+			err = c.updatePolr(ctx, cpolr)
+		}
 		if err != nil {
+			if _, ok := err.(errors.APIStatus); ok {
+				return &v1alpha2.ClusterPolicyReport{}, false, err
+			}
 			return &v1alpha2.ClusterPolicyReport{}, false, errors.NewBadRequest(fmt.Sprintf("cannot create cluster policy report: %s", err.Error()))
 		}
-		c.broadcaster.Action(watch.Added, updatedObject)
 	}
 
-	return updatedObject, true, nil
+	return updatedObject, false, nil
 }
 
 func (c *cpolrStore) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
-	// TODO: Use propogation policy
 	isDryRun := slices.Contains(options.DryRun, "All")
 
 	cpolr, err := c.getCpolr(name)
@@ -183,19 +218,39 @@ func (c *cpolrStore) Delete(ctx context.Context, name string, deleteValidation r
 		return &v1alpha2.ClusterPolicyReport{}, false, errors.NewNotFound(v1alpha2.Resource("clusterpolicyreports"), name)
 	}
 
+	if err := checkPreconditions(v1alpha2.Resource("clusterpolicyreports"), cpolr, options.Preconditions); err != nil {
+		return &v1alpha2.ClusterPolicyReport{}, false, err
+	}
+
 	err = deleteValidation(ctx, cpolr)
 	if err != nil {
 		klog.ErrorS(err, "invalid resource", "name", name)
 		return &v1alpha2.ClusterPolicyReport{}, false, errors.NewBadRequest(fmt.Sprintf("invalid resource: %s", err.Error()))
 	}
 
-	if !isDryRun {
-		err = c.deletePolr(cpolr)
-		if err != nil {
-			klog.ErrorS(err, "failed to delete cpolr", "name", name)
-			return &v1alpha2.ClusterPolicyReport{}, false, errors.NewBadRequest(fmt.Sprintf("failed to delete clusterpolicyreport: %s", err.Error()))
+	cpolr = cpolr.DeepCopy()
+	d := deletion{
+		store:    c,
+		resource: v1alpha2.Resource("clusterpolicyreports"),
+		dryRun:   isDryRun,
+		update: func(ctx context.Context, report metav1.Object) error {
+			return c.updatePolr(ctx, report.(*v1alpha2.ClusterPolicyReport))
+		},
+		remove: func(ctx context.Context, report metav1.Object) error {
+			return c.deletePolr(ctx, report.(*v1alpha2.ClusterPolicyReport))
+		},
+	}
+	deleted, err := d.run(ctx, cpolr, options)
+	if err != nil {
+		klog.ErrorS(err, "failed to delete cpolr", "name", name)
+		if _, ok := err.(errors.APIStatus); ok {
+			return &v1alpha2.ClusterPolicyReport{}, false, err
 		}
-		c.broadcaster.Action(watch.Deleted, cpolr)
+		return &v1alpha2.ClusterPolicyReport{}, false, errors.NewBadRequest(fmt.Sprintf("failed to delete clusterpolicyreport: %s", err.Error()))
+	}
+	// reports with finalizers or a grace period are only marked for deletion
+	if !deleted {
+		return cpolr, false, nil
 	}
 
 	obj, err := c.cpolrToObj(cpolr)
@@ -222,19 +277,22 @@ func (c *cpolrStore) DeleteCollection(ctx context.Context, deleteValidation rest
 
 	if !isDryRun {
 		for _, cpolr := range cpolrList.Items {
-			obj, isDeleted, err := c.Delete(ctx, cpolr.GetName(), deleteValidation, options)
-			if !isDeleted {
+			_, _, err := c.Delete(ctx, cpolr.GetName(), deleteValidation, options)
+			if err != nil {
 				klog.ErrorS(err, "Failed to delete cpolr", "name", cpolr.GetName())
 				return &v1alpha2.ClusterPolicyReportList{}, errors.NewBadRequest(fmt.Sprintf("Failed to delete cluster policy report: %s", cpolr.GetName()))
 			}
-			c.broadcaster.Action(watch.Deleted, obj)
 		}
 	}
 	return cpolrList, nil
 }
 
-func (c *cpolrStore) Watch(ctx context.Context, _ *metainternalversion.ListOptions) (watch.Interface, error) {
-	return c.broadcaster.Watch()
+func (c *cpolrStore) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	rev, err := revisionFor(options)
+	if err != nil {
+		return nil, err
+	}
+	return c.watchCache.Watch(ctx, rev, filterFor("", options))
 }
 
 func (c *cpolrStore) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1beta1.Table, error) {
@@ -244,12 +302,12 @@ func (c *cpolrStore) ConvertToTable(ctx context.Context, object runtime.Object,
 	case *v1alpha2.ClusterPolicyReport:
 		table.ResourceVersion = t.ResourceVersion
 		table.SelfLink = t.SelfLink //nolint:staticcheck // keep deprecated field to be backward compatible
-		addClusterPolicyReportToTable(&table, *t)
+		addClusterPolicyReportToTable(&table, tableOptions, *t)
 	case *v1alpha2.ClusterPolicyReportList:
 		table.ResourceVersion = t.ResourceVersion
 		table.SelfLink = t.SelfLink //nolint:staticcheck // keep deprecated field to be backward compatible
 		table.Continue = t.Continue
-		addClusterPolicyReportToTable(&table, t.Items...)
+		addClusterPolicyReportToTable(&table, tableOptions, t.Items...)
 	default:
 	}
 
@@ -269,11 +327,11 @@ func (c *cpolrStore) ShortNames() []string {
 }
 
 func (c *cpolrStore) key(name string) string {
-	return fmt.Sprintf("/apis/%s/clusterpolicyreports/%s", v1alpha2.SchemeGroupVersion, name)
+	return ClusterPolicyReportKey(name)
 }
 
 func (c *cpolrStore) keyForList() string {
-	return fmt.Sprintf("/apis/%s/clusterpolicyreports/", v1alpha2.SchemeGroupVersion)
+	return ClusterPolicyReportKeyRoot()
 }
 
 func (c *cpolrStore) cpolrToObj(cpolr *v1alpha2.ClusterPolicyReport) (runtime.Object, error) {
@@ -289,6 +347,8 @@ func (c *cpolrStore) cpolrToObj(cpolr *v1alpha2.ClusterPolicyReport) (runtime.Ob
 	return unst.DeepCopyObject(), nil
 }
 
+// getCpolr reads a report from the store, so that writes start from its
+// latest version rather than from the watch cache, which may lag behind.
 func (c *cpolrStore) getCpolr(name string) (*v1alpha2.ClusterPolicyReport, error) {
 	var report v1alpha2.ClusterPolicyReport
 	key := c.key(name)
@@ -301,77 +361,81 @@ func (c *cpolrStore) getCpolr(name string) (*v1alpha2.ClusterPolicyReport, error
 	if err := json.Unmarshal(val.Data, &report); err != nil {
 		return nil, errors.NewBadRequest("invalid object found")
 	}
+	report.ResourceVersion = fmt.Sprint(val.Modified)
 
 	return &report, nil
 }
 
-func (c *cpolrStore) listCpolr() (*v1alpha2.ClusterPolicyReportList, error) {
-	key := c.keyForList()
-
-	valList, err := c.store.List(context.TODO(), key, 0)
-	if err != nil {
-		return nil, errorpkg.Wrapf(err, "could not find cluster policy report in store")
-	}
-
-	reportList := &v1alpha2.ClusterPolicyReportList{
-		Items: make([]v1alpha2.ClusterPolicyReport, len(valList)),
-	}
-
-	var cpolr v1alpha2.ClusterPolicyReport
-	for i, val := range valList {
-		if err := json.Unmarshal(val.Data, &cpolr); err != nil {
-			return nil, errors.NewBadRequest("invalid object found")
-		}
-		reportList.Items[i] = cpolr
-	}
-	return reportList, nil
-}
-
-func (c *cpolrStore) createCpolr(report *v1alpha2.ClusterPolicyReport) error {
+func (c *cpolrStore) createCpolr(ctx context.Context, report *v1alpha2.ClusterPolicyReport) error {
 	key := c.key(report.Name)
 
-	report.ResourceVersion = fmt.Sprint(1)
+	report.ResourceVersion = ""
 	report.UID = uuid.NewUUID()
 	report.CreationTimestamp = metav1.Now()
-
+	touch(report, time.Now())
 	val, err := json.Marshal(report)
 	if err != nil {
 		return errorpkg.Wrapf(err, "could not marshal report")
 	}
-	return c.store.Update(context.TODO(), key, 1, val)
+	if err := c.quota.admit(c.usage, v1alpha2.Resource("clusterpolicyreports"), key, "", report.Name, len(val)); err != nil {
+		return err
+	}
+	revision, err := c.store.CreateRevision(ctx, key, val)
+	if err != nil {
+		return writeError(v1alpha2.Resource("clusterpolicyreports"), report.Name, err)
+	}
+	c.written(ctx, report, revision)
+	return nil
 }
 
-func (c *cpolrStore) updatePolr(report *v1alpha2.ClusterPolicyReport, force bool) error {
+// updatePolr writes report to the store if it still is at its resource version.
+func (c *cpolrStore) updatePolr(ctx context.Context, report *v1alpha2.ClusterPolicyReport) error {
 	key := c.key(report.GetName())
-	if !force {
-		oldReport, err := c.getCpolr(report.GetName())
-		if err != nil {
-			return errorpkg.Wrapf(err, "old cluster policy report not found")
-		}
-		oldRV, err := strconv.ParseInt(oldReport.ResourceVersion, 10, 64)
-		if err != nil {
-			return errorpkg.Wrapf(err, "could not parse resource version")
-		}
 
-		report.ResourceVersion = fmt.Sprint(oldRV + 1)
-	} else {
-		report.ResourceVersion = "1"
+	rev, err := strconv.ParseInt(report.ResourceVersion, 10, 64)
+	if err != nil {
+		return errorpkg.Wrapf(err, "could not parse report's resource version")
 	}
+	report.ResourceVersion = ""
+	touch(report, time.Now())
 	val, err := json.Marshal(report)
 	if err != nil {
 		return errorpkg.Wrapf(err, "could not marshal report")
 	}
+	// reports being deleted are not subject to quota
+	if report.DeletionTimestamp == nil {
+		if err := c.quota.admit(c.usage, v1alpha2.Resource("clusterpolicyreports"), key, "", report.Name, len(val)); err != nil {
+			return err
+		}
+	}
+	revision, err := c.store.UpdateRevision(ctx, key, rev, val)
+	if err != nil {
+		return writeError(v1alpha2.Resource("clusterpolicyreports"), report.Name, err)
+	}
+	c.written(ctx, report, revision)
+	return nil
+}
 
-	rev, _ := strconv.ParseInt(report.ResourceVersion, 10, 64)
-	return c.store.Update(context.TODO(), key, rev, val)
+// written sets the revision of the write of a report as its resource version,
+// and waits for the watch cache to observe it.
+func (c *cpolrStore) written(ctx context.Context, report *v1alpha2.ClusterPolicyReport, revision int64) {
+	report.ResourceVersion = fmt.Sprint(revision)
+	waitForWrite(ctx, c.watchCache, revision)
 }
 
-func (c *cpolrStore) deletePolr(report *v1alpha2.ClusterPolicyReport) error {
+// deletePolr removes report from the store if it still is at its resource
+// version, and waits for the watch cache to observe the deletion.
+func (c *cpolrStore) deletePolr(ctx context.Context, report *v1alpha2.ClusterPolicyReport) error {
 	key := c.key(report.GetName())
 
 	rev, err := strconv.ParseInt(report.ResourceVersion, 10, 64)
 	if err != nil {
-		return errorpkg.Wrapf(err, "could not marshal report's resource version")
+		return errorpkg.Wrapf(err, "could not parse report's resource version")
+	}
+	revision, err := c.store.DeleteRevision(ctx, key, rev)
+	if err != nil {
+		return writeError(v1alpha2.Resource("clusterpolicyreports"), report.Name, err)
 	}
-	return c.store.Delete(context.TODO(), key, rev)
+	waitForWrite(ctx, c.watchCache, revision)
+	return nil
 }
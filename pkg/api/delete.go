@@ -0,0 +1,366 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+// deletionInterval is the period at which the reports being deleted are
+// checked for removal.
+const deletionInterval = 10 * time.Second
+
+// checkPreconditions returns a Conflict error when report does not match the
+// preconditions of a delete.
+func checkPreconditions(resource schema.GroupResource, report metav1.Object, preconditions *metav1.Preconditions) error {
+	if preconditions == nil {
+		return nil
+	}
+	if preconditions.UID != nil && *preconditions.UID != report.GetUID() {
+		return errors.NewConflict(resource, report.GetName(), fmt.Errorf("precondition failed: UID in precondition: %v, UID in object meta: %v", *preconditions.UID, report.GetUID()))
+	}
+	if preconditions.ResourceVersion != nil && *preconditions.ResourceVersion != report.GetResourceVersion() {
+		return errors.NewConflict(resource, report.GetName(), fmt.Errorf("precondition failed: ResourceVersion in precondition: %v, ResourceVersion in object meta: %v", *preconditions.ResourceVersion, report.GetResourceVersion()))
+	}
+	return nil
+}
+
+// writeError translates the error of a backend write of the report name to
+// the API error about it. Backends report their keys in their errors.
+func writeError(resource schema.GroupResource, name string, err error) error {
+	switch {
+	case storage.IsNotFound(err):
+		return errors.NewNotFound(resource, name)
+	case errors.IsAlreadyExists(err):
+		return errors.NewAlreadyExists(resource, name)
+	case errors.IsConflict(err):
+		return errors.NewConflict(resource, name, fmt.Errorf(genericregistry.OptimisticLockErrorMsg))
+	}
+	return err
+}
+
+// deletion deletes reports of a store with the semantics of kube-apiserver.
+// A report with finalizers, or deleted with a grace period, is only marked
+// with a deletion timestamp, and removed once its finalizers are gone and its
+// grace period elapsed. Dependents are the reports of the same store owning
+// it, they are handled according to the propagation policy.
+type deletion struct {
+	store    API
+	resource schema.GroupResource
+	dryRun   bool
+	// update writes a report marked for deletion.
+	update func(ctx context.Context, report metav1.Object) error
+	// remove removes a report from the backend.
+	remove func(ctx context.Context, report metav1.Object) error
+}
+
+// run deletes report, which is modified in place, and reports whether it was
+// removed rather than marked for deletion.
+func (d deletion) run(ctx context.Context, report metav1.Object, options *metav1.DeleteOptions) (bool, error) {
+	policy, err := propagationPolicy(report, options)
+	if err != nil {
+		return false, err
+	}
+	var grace int64
+	if options.GracePeriodSeconds != nil {
+		grace = max(*options.GracePeriodSeconds, 0)
+	}
+	now := time.Now()
+
+	if !d.dryRun {
+		switch policy {
+		case metav1.DeletePropagationOrphan:
+			if err := d.orphanDependents(ctx, report); err != nil {
+				return false, err
+			}
+			report.SetFinalizers(without(report.GetFinalizers(), metav1.FinalizerOrphanDependents))
+		case metav1.DeletePropagationForeground:
+			dependents, err := d.dependents(ctx, report)
+			if err != nil {
+				return false, err
+			}
+			if len(dependents) > 0 {
+				// the report is marked first so that cycles of owners end
+				if !slices.Contains(report.GetFinalizers(), metav1.FinalizerDeleteDependents) {
+					report.SetFinalizers(append(report.GetFinalizers(), metav1.FinalizerDeleteDependents))
+				}
+				markForDeletion(report, grace, now)
+				if err := d.update(ctx, report); err != nil {
+					return false, err
+				}
+				remaining, err := d.deleteDependents(ctx, dependents, policy)
+				if err != nil || remaining > 0 {
+					return false, err
+				}
+			}
+			report.SetFinalizers(without(report.GetFinalizers(), metav1.FinalizerDeleteDependents))
+		}
+	}
+
+	if len(report.GetFinalizers()) > 0 || grace > 0 {
+		markForDeletion(report, grace, now)
+		if d.dryRun {
+			return false, nil
+		}
+		return false, d.update(ctx, report)
+	}
+	if d.dryRun {
+		return true, nil
+	}
+	if err := d.remove(ctx, report); err != nil {
+		return false, err
+	}
+	if policy == metav1.DeletePropagationBackground {
+		dependents, err := d.dependents(ctx, report)
+		if err != nil {
+			return true, err
+		}
+		if _, err := d.deleteDependents(ctx, dependents, policy); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// dependents returns the reports of the store owned by report.
+func (d deletion) dependents(ctx context.Context, report metav1.Object) ([]metav1.Object, error) {
+	list, err := d.store.List(genericapirequest.WithNamespace(ctx, report.GetNamespace()), &metainternalversion.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	var dependents []metav1.Object
+	for _, item := range items {
+		dependent, err := meta.Accessor(item.DeepCopyObject())
+		if err != nil {
+			return nil, err
+		}
+		if dependent.GetUID() != report.GetUID() && ownedBy(dependent, report) {
+			dependents = append(dependents, dependent)
+		}
+	}
+	return dependents, nil
+}
+
+// deleteDependents deletes dependents with policy and returns how many of
+// them are still being deleted.
+func (d deletion) deleteDependents(ctx context.Context, dependents []metav1.Object, policy metav1.DeletionPropagation) (int, error) {
+	remaining := 0
+	for _, dependent := range dependents {
+		// dependents already being deleted are not deleted again, which also
+		// breaks cycles of owners
+		if dependent.GetDeletionTimestamp() != nil {
+			remaining++
+			continue
+		}
+		options := &metav1.DeleteOptions{
+			PropagationPolicy: ptr.To(policy),
+			Preconditions:     &metav1.Preconditions{UID: ptr.To(dependent.GetUID())},
+		}
+		_, deleted, err := d.store.Delete(genericapirequest.WithNamespace(ctx, dependent.GetNamespace()), dependent.GetName(), rest.ValidateAllObjectFunc, options)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !deleted {
+			remaining++
+		}
+	}
+	return remaining, nil
+}
+
+// orphanDependents removes report from the owners of its dependents.
+func (d deletion) orphanDependents(ctx context.Context, report metav1.Object) error {
+	dependents, err := d.dependents(ctx, report)
+	if err != nil {
+		return err
+	}
+	for _, dependent := range dependents {
+		var owners []metav1.OwnerReference
+		for _, owner := range dependent.GetOwnerReferences() {
+			if owner.UID != report.GetUID() {
+				owners = append(owners, owner)
+			}
+		}
+		dependent.SetOwnerReferences(owners)
+		obj, ok := dependent.(runtime.Object)
+		if !ok {
+			continue
+		}
+		_, _, err := d.store.Update(genericapirequest.WithNamespace(ctx, dependent.GetNamespace()), dependent.GetName(), rest.DefaultUpdatedObjectInfo(obj), rest.ValidateAllObjectFunc, rest.ValidateAllObjectUpdateFunc, false, &metav1.UpdateOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// propagationPolicy returns the propagation policy of a delete, defaulting to
+// the one requested by the finalizers of report and then to Background.
+func propagationPolicy(report metav1.Object, options *metav1.DeleteOptions) (metav1.DeletionPropagation, error) {
+	if options.OrphanDependents != nil && options.PropagationPolicy != nil {
+		return "", errors.NewBadRequest("propagationPolicy and orphanDependents cannot be both set")
+	}
+	if options.PropagationPolicy != nil {
+		switch policy := *options.PropagationPolicy; policy {
+		case metav1.DeletePropagationOrphan, metav1.DeletePropagationBackground, metav1.DeletePropagationForeground:
+			return policy, nil
+		default:
+			return "", errors.NewBadRequest(fmt.Sprintf("unsupported propagationPolicy %q", policy))
+		}
+	}
+	if options.OrphanDependents != nil {
+		if *options.OrphanDependents {
+			return metav1.DeletePropagationOrphan, nil
+		}
+		return metav1.DeletePropagationBackground, nil
+	}
+	switch {
+	case slices.Contains(report.GetFinalizers(), metav1.FinalizerOrphanDependents):
+		return metav1.DeletePropagationOrphan, nil
+	case slices.Contains(report.GetFinalizers(), metav1.FinalizerDeleteDependents):
+		return metav1.DeletePropagationForeground, nil
+	}
+	return metav1.DeletePropagationBackground, nil
+}
+
+// markForDeletion sets the deletion timestamp of report to grace seconds
+// from now, unless it is being deleted sooner already.
+func markForDeletion(report metav1.Object, grace int64, now time.Time) {
+	deadline := metav1.NewTime(now.Add(time.Duration(grace) * time.Second))
+	if current := report.GetDeletionTimestamp(); current != nil && !deadline.Before(current) {
+		return
+	}
+	report.SetDeletionTimestamp(&deadline)
+	report.SetDeletionGracePeriodSeconds(ptr.To(grace))
+}
+
+// prepareUpdate keeps the fields of old which clients can't update, such as
+// its creation and deletion state, on report. It reports whether report has
+// to be removed rather than written because its last finalizer is gone after
+// its grace period elapsed.
+func prepareUpdate(resource schema.GroupResource, report, old metav1.Object, now time.Time) (bool, error) {
+	if len(report.GetUID()) == 0 {
+		report.SetUID(old.GetUID())
+	}
+	report.SetCreationTimestamp(old.GetCreationTimestamp())
+	report.SetDeletionTimestamp(old.GetDeletionTimestamp())
+	report.SetDeletionGracePeriodSeconds(old.GetDeletionGracePeriodSeconds())
+	deadline := old.GetDeletionTimestamp()
+	if deadline == nil {
+		return false, nil
+	}
+	for _, finalizer := range report.GetFinalizers() {
+		if !slices.Contains(old.GetFinalizers(), finalizer) {
+			return false, errors.NewForbidden(resource, report.GetName(), fmt.Errorf("no new finalizers can be added if the object is being deleted, found new finalizer %q", finalizer))
+		}
+	}
+	return len(report.GetFinalizers()) == 0 && !now.Before(deadline.Time), nil
+}
+
+// DeletionTask returns a loop completing the deletion of the reports of
+// stores until ctx is done. It releases the reports deleted in the
+// foreground whose dependents are gone, and removes the reports without
+// finalizers whose grace period elapsed.
+func DeletionTask(stores ...API) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for _, store := range stores {
+				if err := finalize(ctx, store, time.Now()); err != nil {
+					klog.ErrorS(err, "failed to finalize deleted reports", "kind", store.Kind())
+				}
+			}
+		}, deletionInterval)
+	}
+}
+
+func finalize(ctx context.Context, store API, now time.Time) error {
+	list, err := store.List(genericapirequest.WithNamespace(ctx, metav1.NamespaceAll), &metainternalversion.ListOptions{})
+	if err != nil {
+		return err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	d := deletion{store: store}
+	for _, item := range items {
+		item = item.DeepCopyObject()
+		report, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		if report.GetDeletionTimestamp() == nil {
+			continue
+		}
+		ctx := genericapirequest.WithNamespace(ctx, report.GetNamespace())
+
+		if slices.Contains(report.GetFinalizers(), metav1.FinalizerDeleteDependents) {
+			dependents, err := d.dependents(ctx, report)
+			if err != nil || len(dependents) > 0 {
+				continue
+			}
+			report.SetFinalizers(without(report.GetFinalizers(), metav1.FinalizerDeleteDependents))
+			_, _, err = store.Update(ctx, report.GetName(), rest.DefaultUpdatedObjectInfo(item), rest.ValidateAllObjectFunc, rest.ValidateAllObjectUpdateFunc, false, &metav1.UpdateOptions{})
+			if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+				klog.ErrorS(err, "failed to release report", "kind", store.Kind(), "report", klog.KObj(report))
+			}
+			continue
+		}
+
+		if len(report.GetFinalizers()) > 0 || now.Before(report.GetDeletionTimestamp().Time) {
+			continue
+		}
+		options := &metav1.DeleteOptions{
+			GracePeriodSeconds: ptr.To[int64](0),
+			Preconditions: &metav1.Preconditions{
+				UID:             ptr.To(report.GetUID()),
+				ResourceVersion: ptr.To(report.GetResourceVersion()),
+			},
+		}
+		_, _, err = store.Delete(ctx, report.GetName(), rest.ValidateAllObjectFunc, options)
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			klog.ErrorS(err, "failed to remove deleted report", "kind", store.Kind(), "report", klog.KObj(report))
+		}
+	}
+	return nil
+}
+
+func ownedBy(dependent, owner metav1.Object) bool {
+	for _, ref := range dependent.GetOwnerReferences() {
+		if ref.UID == owner.GetUID() {
+			return true
+		}
+	}
+	return false
+}
+
+func without(finalizers []string, finalizer string) []string {
+	var result []string
+	for _, f := range finalizers {
+		if f != finalizer {
+			result = append(result, f)
+		}
+	}
+	return result
+}
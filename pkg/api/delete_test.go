@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Delete", func() {
+	var (
+		ctx   context.Context
+		store API
+	)
+	BeforeEach(func() {
+		ctx = genericapirequest.WithNamespace(context.Background(), "default")
+		var err error
+		store, err = PolicyReportStore(inmemory.New(), storage.NewUsage("policyreports"), Quota{}, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(store.Destroy)
+	})
+
+	create := func(name string, finalizers []string, owners ...*v1alpha2.PolicyReport) *v1alpha2.PolicyReport {
+		report := &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Finalizers: finalizers}}
+		for _, owner := range owners {
+			report.OwnerReferences = append(report.OwnerReferences, metav1.OwnerReference{APIVersion: "wgpolicyk8s.io/v1alpha2", Kind: "PolicyReport", Name: owner.Name, UID: owner.UID})
+		}
+		_, err := store.Create(ctx, report, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return get(ctx, store, name)
+	}
+	remove := func(name string, options *metav1.DeleteOptions) (bool, error) {
+		_, deleted, err := store.Delete(ctx, name, rest.ValidateAllObjectFunc, options)
+		return deleted, err
+	}
+	exists := func(name string) bool {
+		_, err := store.Get(ctx, name, &metav1.GetOptions{})
+		return err == nil
+	}
+
+	It("should enforce preconditions", func() {
+		report := create("a", nil)
+		_, err := remove("a", &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: ptr.To(types.UID("other"))}})
+		Expect(errors.IsConflict(err)).To(BeTrue())
+		_, err = remove("a", &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: ptr.To("0")}})
+		Expect(errors.IsConflict(err)).To(BeTrue())
+		Expect(remove("a", &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: ptr.To(report.UID), ResourceVersion: ptr.To(report.ResourceVersion)}})).To(BeTrue())
+		Expect(exists("a")).To(BeFalse())
+	})
+
+	It("should keep reports until their finalizers are removed", func() {
+		create("a", []string{"example.com/hold"})
+		Expect(remove("a", &metav1.DeleteOptions{})).To(BeFalse())
+		report := get(ctx, store, "a")
+		Expect(report.DeletionTimestamp).NotTo(BeNil())
+
+		// finalizers can't be added once the report is being deleted
+		report.Finalizers = append(report.Finalizers, "example.com/other")
+		_, _, err := store.Update(ctx, "a", rest.DefaultUpdatedObjectInfo(report.DeepCopy()), rest.ValidateAllObjectFunc, rest.ValidateAllObjectUpdateFunc, false, &metav1.UpdateOptions{})
+		Expect(errors.IsForbidden(err)).To(BeTrue())
+
+		report.Finalizers = nil
+		_, _, err = store.Update(ctx, "a", rest.DefaultUpdatedObjectInfo(report), rest.ValidateAllObjectFunc, rest.ValidateAllObjectUpdateFunc, false, &metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists("a")).To(BeFalse())
+	})
+
+	It("should remove reports once their grace period elapsed", func() {
+		create("a", nil)
+		Expect(remove("a", &metav1.DeleteOptions{GracePeriodSeconds: ptr.To[int64](60)})).To(BeFalse())
+		report := get(ctx, store, "a")
+		Expect(*report.DeletionGracePeriodSeconds).To(Equal(int64(60)))
+
+		Expect(finalize(ctx, store, time.Now())).To(Succeed())
+		Expect(exists("a")).To(BeTrue())
+		Expect(finalize(ctx, store, time.Now().Add(2*time.Minute))).To(Succeed())
+		Expect(exists("a")).To(BeFalse())
+	})
+
+	It("should delete dependents in the background", func() {
+		owner := create("owner", nil)
+		create("dependent", nil, owner)
+		create("other", nil)
+
+		Expect(remove("owner", &metav1.DeleteOptions{})).To(BeTrue())
+		Expect(exists("dependent")).To(BeFalse())
+		Expect(exists("other")).To(BeTrue())
+	})
+
+	It("should orphan dependents", func() {
+		owner := create("owner", nil)
+		create("dependent", nil, owner)
+
+		Expect(remove("owner", &metav1.DeleteOptions{PropagationPolicy: ptr.To(metav1.DeletePropagationOrphan)})).To(BeTrue())
+		Expect(get(ctx, store, "dependent").OwnerReferences).To(BeEmpty())
+	})
+
+	It("should delete owners after their dependents in the foreground", func() {
+		owner := create("owner", nil)
+		create("dependent", []string{"example.com/hold"}, owner)
+
+		Expect(remove("owner", &metav1.DeleteOptions{PropagationPolicy: ptr.To(metav1.DeletePropagationForeground)})).To(BeFalse())
+		Expect(get(ctx, store, "owner").Finalizers).To(ConsistOf(metav1.FinalizerDeleteDependents))
+		dependent := get(ctx, store, "dependent")
+		Expect(dependent.DeletionTimestamp).NotTo(BeNil())
+
+		dependent.Finalizers = nil
+		_, _, err := store.Update(ctx, "dependent", rest.DefaultUpdatedObjectInfo(dependent), rest.ValidateAllObjectFunc, rest.ValidateAllObjectUpdateFunc, false, &metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists("dependent")).To(BeFalse())
+
+		Eventually(func() bool {
+			Expect(finalize(ctx, store, time.Now())).To(Succeed())
+			return exists("owner")
+		}).Should(BeFalse())
+	})
+})
+
+func get(ctx context.Context, store API, name string) *v1alpha2.PolicyReport {
+	obj, err := store.Get(ctx, name, &metav1.GetOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	return obj.(*v1alpha2.PolicyReport).DeepCopy()
+}
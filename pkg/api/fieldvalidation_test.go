@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
+	openapinamer "k8s.io/apiserver/pkg/endpoints/openapi"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// newTestServer returns the handler of an API server serving the reports of
+// store, without authentication and authorizing every request. It must be called from a
+// setup or a spec, the stores are destroyed once it completes.
+func newTestServer(store storage.Storage, opts Options) http.Handler {
+	return startTestServer(newTestConfig(), store, opts)
+}
+
+// newTestConfig returns the config of a test server, without admission.
+func newTestConfig() *genericapiserver.Config {
+	config := genericapiserver.NewConfig(Codecs)
+	config.ExternalAddress = "localhost:443"
+	config.LoopbackClientConfig = &rest.Config{}
+	config.Authorization.Authorizer = authorizerfactory.NewAlwaysAllowAuthorizer()
+	config.OpenAPIConfig = genericapiserver.DefaultOpenAPIConfig(GetOpenAPIDefinitions, openapinamer.NewDefinitionNamer(Scheme))
+	config.OpenAPIV3Config = genericapiserver.DefaultOpenAPIV3Config(GetOpenAPIDefinitions, openapinamer.NewDefinitionNamer(Scheme))
+	config.BuildHandlerChainFunc = func(handler http.Handler, config *genericapiserver.Config) http.Handler {
+		return genericapiserver.DefaultBuildHandlerChain(WithConfiguration(handler), config)
+	}
+	return config
+}
+
+// startTestServer is newTestServer with the given config, whose admission
+// chain also covers the updates made through the results subresource.
+func startTestServer(config *genericapiserver.Config, store storage.Storage, opts Options) http.Handler {
+	opts.Admission = config.AdmissionControl
+	server, err := config.Complete(nil).New("policy-server-test", genericapiserver.NewEmptyDelegate())
+	Expect(err).NotTo(HaveOccurred())
+	stores, err := Install(store, server, opts)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(stores.PolicyReports.Destroy)
+	DeferCleanup(stores.ClusterPolicyReports.Destroy)
+	return server.Handler
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// apply server-side applies body to path as the test field manager.
+func apply(handler http.Handler, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, path+"?fieldManager=test&force=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/apply-patch+yaml")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+var _ = Describe("Field validation", func() {
+	const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+	// an unknown field and a duplicate field
+	body := func(name, resourceVersion string) string {
+		return fmt.Sprintf(`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":%q,"namespace":"default","resourceVersion":%q},"bogus":1,"summary":{"pass":1},"results":[{"policy":"p","policy":"q","result":"pass"}]}`, name, resourceVersion)
+	}
+	warnings := []string{`299 - "unknown field \"bogus\""`, `299 - "duplicate field \"results[0].policy\""`}
+
+	var handler http.Handler
+	BeforeEach(func() {
+		handler = newTestServer(inmemory.New(), Options{})
+	})
+
+	It("should warn about unknown and duplicate fields", func() {
+		for _, query := range []string{"?fieldValidation=Warn", ""} {
+			rec := serve(handler, http.MethodPost, reports+query, body("warn"+strings.TrimPrefix(query, "?fieldValidation="), ""))
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+			Expect(rec.Header().Values("Warning")).To(ConsistOf(warnings))
+		}
+	})
+
+	It("should reject unknown and duplicate fields in strict mode", func() {
+		rec := serve(handler, http.MethodPost, reports+"?fieldValidation=Strict", body("strict", ""))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring(`unknown field \"bogus\"`))
+
+		rec = serve(handler, http.MethodPost, reports+"?fieldValidation=Ignore", body("strict", ""))
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+		rec = serve(handler, http.MethodPut, reports+"/strict?fieldValidation=Strict", body("strict", "1"))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		Expect(rec.Body.String()).To(ContainSubstring(`duplicate field \"results[0].policy\"`))
+	})
+
+	It("should ignore unknown and duplicate fields", func() {
+		rec := serve(handler, http.MethodPost, reports+"?fieldValidation=Ignore", body("ignore", ""))
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+		Expect(rec.Header().Values("Warning")).To(BeEmpty())
+	})
+
+	It("should fail validation errors in every mode", func() {
+		store, err := PolicyReportStore(inmemory.New(), storage.NewUsage("policyreports"), Quota{}, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Destroy()
+
+		ctx := genericapirequest.WithNamespace(context.Background(), "default")
+		invalid := func(context.Context, runtime.Object) error { return fmt.Errorf("invalid") }
+		for _, mode := range []string{metav1.FieldValidationIgnore, metav1.FieldValidationWarn, metav1.FieldValidationStrict} {
+			report := &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "a"}}
+			_, err := store.Create(ctx, report, invalid, &metav1.CreateOptions{FieldValidation: mode})
+			Expect(err).To(HaveOccurred(), mode)
+		}
+	})
+})
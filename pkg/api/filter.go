@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	apistorage "k8s.io/apiserver/pkg/storage"
+)
+
+// filterFor returns a filter accepting the objects of namespace, or of every
+// namespace if it is empty, that match the selectors of options.
+func filterFor(namespace string, options *metainternalversion.ListOptions) storage.FilterFunc {
+	labelSelector := labels.Everything()
+	fieldSelector := fields.Everything()
+	if options != nil && options.LabelSelector != nil {
+		labelSelector = options.LabelSelector
+	}
+	if options != nil && options.FieldSelector != nil {
+		fieldSelector = options.FieldSelector
+	}
+
+	return func(obj runtime.Object) bool {
+		objMeta, err := meta.Accessor(obj)
+		if err != nil {
+			return false
+		}
+		if len(namespace) > 0 && objMeta.GetNamespace() != namespace {
+			return false
+		}
+		if !labelSelector.Matches(labels.Set(objMeta.GetLabels())) {
+			return false
+		}
+		return fieldSelector.Matches(fields.Set{
+			"metadata.name":      objMeta.GetName(),
+			"metadata.namespace": objMeta.GetNamespace(),
+		})
+	}
+}
+
+// revisionFor parses the resource version requested by options.
+func revisionFor(options *metainternalversion.ListOptions) (uint64, error) {
+	if options == nil || len(options.ResourceVersion) == 0 {
+		return 0, nil
+	}
+	rev, err := strconv.ParseUint(options.ResourceVersion, 10, 64)
+	if err != nil {
+		return 0, errors.NewBadRequest("invalid resource version: " + options.ResourceVersion)
+	}
+	return rev, nil
+}
+
+// listFor lists the objects under prefix accepted by filter, following the
+// resourceVersion, resourceVersionMatch, limit and continue semantics of
+// kube-apiserver. Lists are served by the watch cache once it has observed the
+// resource version they ask for. Lists asking for an exact resource version,
+// and the continuations of lists made at a resource version, are served by the
+// backend when the watch cache has moved past it.
+func listFor(ctx context.Context, watchCache *storage.WatchCache, reflector *storage.Reflector, prefix string, filter storage.FilterFunc, options *metainternalversion.ListOptions) ([]runtime.Object, metav1.ListMeta, error) {
+	if options == nil {
+		options = &metainternalversion.ListOptions{}
+	}
+	var start string
+	var revision uint64
+	exact := options.ResourceVersionMatch == metav1.ResourceVersionMatchExact
+	if len(options.Continue) > 0 {
+		key, rv, err := apistorage.DecodeContinue(options.Continue, prefix)
+		if err != nil {
+			return nil, metav1.ListMeta{}, errors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+		}
+		start, revision, exact = key, uint64(rv), true
+	} else {
+		rev, err := revisionFor(options)
+		if err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+		revision = rev
+	}
+
+	if revision > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, listTimeout)
+		defer cancel()
+		if err := watchCache.WaitForRevision(waitCtx, revision); err != nil {
+			return nil, metav1.ListMeta{}, errors.NewTimeoutError(fmt.Sprintf("too large resource version: %d, current: %d", revision, watchCache.Revision()), 1)
+		}
+	}
+	objects, last, listed := watchCache.List(filter, start, options.Limit)
+	if exact && listed != revision {
+		var err error
+		if objects, last, err = reflector.List(ctx, prefix, start, int64(revision), options.Limit, filter); err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+		listed = revision
+	}
+
+	listMeta := metav1.ListMeta{ResourceVersion: strconv.FormatUint(listed, 10)}
+	if len(last) > 0 {
+		next, err := apistorage.EncodeContinue(last+"\x00", prefix, int64(listed))
+		if err != nil {
+			return nil, metav1.ListMeta{}, err
+		}
+		listMeta.Continue = next
+	}
+	return objects, listMeta, nil
+}
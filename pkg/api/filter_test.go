@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Report lists", func() {
+	const (
+		reports        = "/apis/wgpolicyk8s.io/v1alpha2/policyreports"
+		inTeam         = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/policyreports"
+		clusterReports = "/apis/wgpolicyk8s.io/v1alpha2/clusterpolicyreports"
+	)
+
+	var handler http.Handler
+	BeforeEach(func() {
+		handler = newTestServer(inmemory.New(), Options{})
+		for _, report := range []struct{ namespace, name string }{{"team", "d"}, {"team", "b"}, {"other", "a"}, {"team", "c"}} {
+			rec := serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/"+report.namespace+"/policyreports",
+				fmt.Sprintf(`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":%q}}`, report.name))
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		}
+		for _, name := range []string{"y", "x"} {
+			rec := serve(handler, http.MethodPost, clusterReports, fmt.Sprintf(`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"ClusterPolicyReport","metadata":{"name":%q}}`, name))
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		}
+	})
+
+	list := func(path string, query url.Values) *v1alpha2.PolicyReportList {
+		rec := serve(handler, http.MethodGet, path+"?"+query.Encode(), "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		var list v1alpha2.PolicyReportList
+		Expect(json.Unmarshal(rec.Body.Bytes(), &list)).To(Succeed())
+		return &list
+	}
+	names := func(list *v1alpha2.PolicyReportList) []string {
+		var names []string
+		for _, item := range list.Items {
+			names = append(names, item.Namespace+"/"+item.Name)
+		}
+		return names
+	}
+	pages := func(path string, limit int) [][]string {
+		var pages [][]string
+		query := url.Values{"limit": {fmt.Sprint(limit)}}
+		for {
+			page := list(path, query)
+			pages = append(pages, names(page))
+			if len(page.Continue) == 0 {
+				return pages
+			}
+			query.Set("continue", page.Continue)
+		}
+	}
+
+	It("should list reports in the order of their keys, a page at a time", func() {
+		Expect(names(list(reports, nil))).To(Equal([]string{"other/a", "team/b", "team/c", "team/d"}))
+		Expect(pages(reports, 3)).To(Equal([][]string{{"other/a", "team/b", "team/c"}, {"team/d"}}))
+		Expect(pages(inTeam, 2)).To(Equal([][]string{{"team/b", "team/c"}, {"team/d"}}))
+		Expect(pages(clusterReports, 1)).To(Equal([][]string{{"/x"}, {"/y"}}))
+
+		rec := serve(handler, http.MethodGet, reports+"?limit=1&continue=bogus", "")
+		Expect(rec.Code).To(Equal(http.StatusBadRequest), rec.Body.String())
+	})
+
+	It("should list reports at the exact resource version asked for", func() {
+		listed := list(inTeam, nil)
+		rec := serve(handler, http.MethodDelete, inTeam+"/b", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+
+		Expect(list(inTeam, url.Values{"resourceVersion": {"0"}}).ResourceVersion).NotTo(Equal(listed.ResourceVersion))
+		exact := list(inTeam, url.Values{"resourceVersion": {listed.ResourceVersion}, "resourceVersionMatch": {"Exact"}})
+		Expect(exact.ResourceVersion).To(Equal(listed.ResourceVersion))
+		notOlder := list(inTeam, url.Values{"resourceVersion": {listed.ResourceVersion}, "resourceVersionMatch": {"NotOlderThan"}})
+		Expect(names(notOlder)).To(Equal([]string{"team/c", "team/d"}))
+	})
+})
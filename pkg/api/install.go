@@ -15,18 +15,36 @@
 package api
 
 import (
+	"context"
+	"time"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
 	"github.com/kyverno/policy-server/pkg/storage"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/admission"
 	"k8s.io/apiserver/pkg/registry/rest"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
 )
 
+// watchCacheCapacity is the number of events each resource keeps for watchers
+// to resume from.
+const watchCacheCapacity = 1000
+
+// writeVisibilityTimeout bounds how long a write waits for its own event to
+// reach the watch cache, so that the client reads it back from lists.
+const writeVisibilityTimeout = 5 * time.Second
+
+// listTimeout bounds how long a list waits for the watch cache to observe the
+// resource version it asks for, as the cacher of kube-apiserver does.
+const listTimeout = 3 * time.Second
+
 var (
 	// Scheme contains the types needed by the resource API.
 	Scheme = runtime.NewScheme()
@@ -36,26 +54,136 @@ var (
 
 func init() {
 	utilruntime.Must(v1alpha2.AddToScheme(Scheme))
+	utilruntime.Must(views.AddToScheme(Scheme))
+	// server-side apply converts reports to the internal version of the group,
+	// which has the types of the served version
+	Scheme.AddKnownTypes(schema.GroupVersion{Group: v1alpha2.SchemeGroupVersion.Group, Version: runtime.APIVersionInternal},
+		&v1alpha2.PolicyReport{}, &v1alpha2.PolicyReportList{}, &v1alpha2.ClusterPolicyReport{}, &v1alpha2.ClusterPolicyReportList{})
+	utilruntime.Must(Scheme.AddFieldLabelConversionFunc(v1alpha2.SchemeGroupVersion.WithKind("PolicyResult"), resultFieldLabelConversion))
+	utilruntime.Must(Scheme.AddFieldLabelConversionFunc(v1alpha2.SchemeGroupVersion.WithKind("ClusterPolicyResult"), resultFieldLabelConversion))
+	utilruntime.Must(Scheme.AddFieldLabelConversionFunc(v1alpha2.SchemeGroupVersion.WithKind("ResourceReport"), resourceReportFieldLabelConversion))
+	utilruntime.Must(Scheme.AddFieldLabelConversionFunc(v1alpha2.SchemeGroupVersion.WithKind("ClusterResourceReport"), resourceReportFieldLabelConversion))
 	utilruntime.Must(Scheme.SetVersionPriority(v1alpha2.SchemeGroupVersion))
 	metav1.AddToGroupVersion(Scheme, schema.GroupVersion{Version: "v1"})
 }
 
 // Build constructs APIGroupInfo the wgpolicyk8s.io API group using the given getters.
-func Build(polr, cpolr rest.Storage) genericapiserver.APIGroupInfo {
+// The read-only views computed from the reports are served next to them, and
+// the results of reports can be changed one by one through their results
+// subresource, whose updates of the reports go through admit.
+func Build(polr, cpolr rest.Storage, virtual map[string]rest.Storage, admit admission.Interface) genericapiserver.APIGroupInfo {
 	apiGroupInfo := genericapiserver.NewDefaultAPIGroupInfo(v1alpha2.SchemeGroupVersion.Group, Scheme, metav1.ParameterCodec, Codecs)
 	policyServerResources := map[string]rest.Storage{
 		"policyreports":        polr,
 		"clusterpolicyreports": cpolr,
 	}
+	if updater, ok := polr.(rest.Updater); ok {
+		policyServerResources["policyreports/results"] = &resultsStore{
+			reports:   updater,
+			kind:      v1alpha2.SchemeGroupVersion.WithKind("PolicyReport"),
+			resource:  v1alpha2.SchemeGroupVersion.WithResource("policyreports"),
+			admission: admit,
+		}
+	}
+	if updater, ok := cpolr.(rest.Updater); ok {
+		policyServerResources["clusterpolicyreports/results"] = &resultsStore{
+			reports:   updater,
+			kind:      v1alpha2.SchemeGroupVersion.WithKind("ClusterPolicyReport"),
+			resource:  v1alpha2.SchemeGroupVersion.WithResource("clusterpolicyreports"),
+			admission: admit,
+		}
+	}
+	for resource, view := range virtual {
+		policyServerResources[resource] = view
+	}
 	apiGroupInfo.VersionedResourcesStorageMap[v1alpha2.SchemeGroupVersion.Version] = policyServerResources
 
 	return apiGroupInfo
 }
 
+// Options configures the report stores installed by Install.
+type Options struct {
+	// GenericRegistry serves the reports through genericregistry.Store instead of the built-in stores.
+	GenericRegistry bool
+	// Admission is the admission chain of the server, run on the updates of
+	// reports made through their results subresource.
+	Admission admission.Interface
+	// Quota limits the storage used by each namespace.
+	Quota Quota
+	// ClientSummaries keeps the summaries submitted by writers instead of
+	// deriving them from the results of reports.
+	ClientSummaries bool
+	// Rules are the CEL rules reports are validated against on creates and updates.
+	Rules *Rules
+}
+
+// Stores are the report stores served by the wgpolicyk8s.io API.
+type Stores struct {
+	PolicyReports        API
+	ClusterPolicyReports API
+}
+
 // Install builds the metrics for the wgpolicyk8s.io API, and then installs it into the given API policy-server.
-func Install(store storage.Storage, server *genericapiserver.GenericAPIServer) error {
-	polr := PolicyReportStore(store)
-	cpolr := ClusterPolicyReportStore(store)
-	info := Build(polr, cpolr)
-	return server.InstallAPIGroup(&info)
+// It returns the installed stores, for background tasks to go through them.
+func Install(store storage.Storage, server *genericapiserver.GenericAPIServer, opts Options) (Stores, error) {
+	polr, cpolr, virtual, err := reportStores(store, server, opts)
+	if err != nil {
+		return Stores{}, err
+	}
+	info := Build(polr, cpolr, virtual, opts.Admission)
+	if err := server.InstallAPIGroup(&info); err != nil {
+		return Stores{}, err
+	}
+	return Stores{PolicyReports: polr, ClusterPolicyReports: cpolr}, nil
+}
+
+// reportStores returns the report stores, and the views computed from them.
+// Views are fed by the reflectors of the report stores, whichever of the
+// built-in stores or the generic registry serves them.
+func reportStores(store storage.Storage, server *genericapiserver.GenericAPIServer, opts Options) (API, API, map[string]rest.Storage, error) {
+	results, summaries := newResultIndex(), newSummaryIndex()
+	polrUsage, cpolrUsage := storage.NewUsage("policyreports"), storage.NewUsage("clusterpolicyreports")
+	polrStore, cpolrStore := PolicyReportStore, ClusterPolicyReportStore
+	if opts.GenericRegistry {
+		polrStore, cpolrStore = PolicyReportRegistryStore, ClusterPolicyReportRegistryStore
+	}
+	polr, err := polrStore(store, polrUsage, opts.Quota, opts.Rules, opts.ClientSummaries, results.observer("PolicyReport"), summaries.observer("PolicyReport"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cpolr, err := cpolrStore(store, cpolrUsage, opts.Quota, opts.Rules, opts.ClientSummaries, results.observer("ClusterPolicyReport"), summaries.observer("ClusterPolicyReport"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	server.Handler.NonGoRestfulMux.Handle("/quota", quotaStatusHandler(opts.Quota, polrUsage, cpolrUsage))
+	virtual := summaries.stores()
+	virtual["policyresults"] = &resultStore{index: results, namespaced: true}
+	virtual["clusterpolicyresults"] = &resultStore{index: results}
+	virtual["resourcereports"] = &resourceReportStore{index: results, namespaced: true}
+	virtual["clusterresourcereports"] = &resourceReportStore{index: results}
+	return polr, cpolr, virtual, nil
+}
+
+// startReflector loads watchCache from the backend and keeps it in sync with
+// the writes of every replica until the returned func is called. The
+// reflector also serves the lists the watch cache cannot.
+func startReflector(store storage.Storage, resource, prefix string, watchCache *storage.WatchCache, decode storage.DecodeFunc, observers ...storage.Observer) (*storage.Reflector, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reflector := storage.NewReflector(store, resource, prefix, watchCache, decode, observers...)
+	revision, err := reflector.Load(ctx)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	go reflector.Run(ctx, revision)
+	return reflector, cancel, nil
+}
+
+// waitForWrite waits until watchCache has observed the write made at revision.
+func waitForWrite(ctx context.Context, watchCache *storage.WatchCache, revision int64) {
+	ctx, cancel := context.WithTimeout(ctx, writeVisibilityTimeout)
+	defer cancel()
+	if err := watchCache.WaitForRevision(ctx, uint64(revision)); err != nil {
+		klog.ErrorS(err, "write is not visible in the watch cache yet", "revision", revision)
+	}
 }
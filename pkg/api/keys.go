@@ -0,0 +1,37 @@
+package api
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// PolicyReportKey returns the storage key of the policy report name in namespace.
+func PolicyReportKey(namespace, name string) string {
+	return fmt.Sprintf("/apis/%s/namespaces/%s/policyreports/%s", v1alpha2.SchemeGroupVersion, namespace, name)
+}
+
+// PolicyReportKeyRoot returns the prefix of the storage keys of the policy
+// reports in namespace. The prefix of every namespace also covers the keys of
+// other namespaced resources, which callers have to skip.
+func PolicyReportKeyRoot(namespace string) string {
+	if len(namespace) == 0 {
+		return fmt.Sprintf("/apis/%s/namespaces/", v1alpha2.SchemeGroupVersion)
+	}
+	return fmt.Sprintf("/apis/%s/namespaces/%s/policyreports/", v1alpha2.SchemeGroupVersion, namespace)
+}
+
+// ClusterPolicyReportKey returns the storage key of the cluster policy report name.
+func ClusterPolicyReportKey(name string) string {
+	return fmt.Sprintf("/apis/%s/clusterpolicyreports/%s", v1alpha2.SchemeGroupVersion, name)
+}
+
+// ClusterPolicyReportKeyRoot returns the prefix of the storage keys of the cluster policy reports.
+func ClusterPolicyReportKeyRoot() string {
+	return fmt.Sprintf("/apis/%s/clusterpolicyreports/", v1alpha2.SchemeGroupVersion)
+}
+
+// KeyRoot returns the prefix of the storage keys of every resource of the API group.
+func KeyRoot() string {
+	return fmt.Sprintf("/apis/%s/", v1alpha2.SchemeGroupVersion)
+}
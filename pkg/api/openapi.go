@@ -0,0 +1,49 @@
+package api
+
+import (
+	generatedopenapi "github.com/kyverno/policy-server/pkg/api/generated/openapi"
+	"github.com/kyverno/policy-server/pkg/api/views"
+	"k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+const (
+	policyReportDefinition        = "sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2.PolicyReport"
+	clusterPolicyReportDefinition = "sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2.ClusterPolicyReport"
+	policyReportResultDefinition  = "sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2.PolicyReportResult"
+)
+
+// GetOpenAPIDefinitions returns the generated OpenAPI definitions of the
+// reports and of the views, completed with the enums enforced by the
+// validation of the reports. The configuration of reports only applies to the
+// write it comes with, reports are served without it.
+func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
+	definitions := generatedopenapi.GetOpenAPIDefinitions(ref)
+	for name, definition := range views.GetOpenAPIDefinitions(ref) {
+		definitions[name] = definition
+	}
+	if definition, ok := definitions[policyReportResultDefinition]; ok {
+		setEnum(&definition.Schema, "result", Results)
+		setEnum(&definition.Schema, "severity", Severities)
+		definitions[policyReportResultDefinition] = definition
+	}
+	for _, name := range []string{policyReportDefinition, clusterPolicyReportDefinition} {
+		if definition, ok := definitions[name]; ok {
+			delete(definition.Schema.Properties, "configuration")
+			definitions[name] = definition
+		}
+	}
+	return definitions
+}
+
+func setEnum[T ~string](schema *spec.Schema, property string, values []T) {
+	prop, ok := schema.Properties[property]
+	if !ok {
+		return
+	}
+	prop.Enum = make([]interface{}, 0, len(values))
+	for _, value := range values {
+		prop.Enum = append(prop.Enum, string(value))
+	}
+	schema.Properties[property] = prop
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"slices"
 	"strconv"
+	"time"
 
 	"github.com/kyverno/policy-server/pkg/storage"
 	errorpkg "github.com/pkg/errors"
@@ -14,7 +15,6 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	"k8s.io/apimachinery/pkg/watch"
@@ -25,17 +25,41 @@ import (
 )
 
 type polrStore struct {
-	broadcaster *watch.Broadcaster
-	store       storage.Storage
+	store      storage.Storage
+	watchCache *storage.WatchCache
+	reflector  *storage.Reflector
+	usage      *storage.Usage
+	quota      Quota
+	rules      *Rules
+	// clientSummaries keeps the summaries submitted by writers.
+	clientSummaries bool
+	stop            context.CancelFunc
 }
 
-func PolicyReportStore(store storage.Storage) API {
-	broadcaster := watch.NewBroadcaster(1000, watch.WaitIfChannelFull)
+func PolicyReportStore(store storage.Storage, usage *storage.Usage, quota Quota, rules *Rules, clientSummaries bool, observers ...storage.Observer) (API, error) {
+	p := &polrStore{
+		store:           store,
+		watchCache:      storage.NewWatchCache("policyreports", watchCacheCapacity),
+		usage:           usage,
+		quota:           quota,
+		rules:           rules,
+		clientSummaries: clientSummaries,
+	}
+	reflector, stop, err := startReflector(store, "policyreports", p.keyForList(), p.watchCache, decodePolicyReport, append([]storage.Observer{usage}, observers...)...)
+	if err != nil {
+		return nil, err
+	}
+	p.reflector, p.stop = reflector, stop
+	return p, nil
+}
 
-	return &polrStore{
-		broadcaster: broadcaster,
-		store:       store,
+// decodePolicyReport decodes a policy report stored in the backend.
+func decodePolicyReport(data []byte) (runtime.Object, error) {
+	var report v1alpha2.PolicyReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
 	}
+	return &report, nil
 }
 
 func (p *polrStore) New() runtime.Object {
@@ -43,6 +67,9 @@ func (p *polrStore) New() runtime.Object {
 }
 
 func (p *polrStore) Destroy() {
+	if p.stop != nil {
+		p.stop()
+	}
 }
 
 func (p *polrStore) Kind() string {
@@ -54,30 +81,18 @@ func (p *polrStore) NewList() runtime.Object {
 }
 
 func (p *polrStore) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
-	labelSelector := labels.Everything()
-	if options != nil && options.LabelSelector != nil {
-		labelSelector = options.LabelSelector
-	}
 	namespace := genericapirequest.NamespaceValue(ctx)
-	list, err := p.listPolr(namespace)
+	objs, listMeta, err := listFor(ctx, p.watchCache, p.reflector, PolicyReportKeyRoot(namespace), filterFor(namespace, options), options)
 	if err != nil {
-		return &v1alpha2.PolicyReportList{}, errors.NewBadRequest("failed to list resource policyreport")
+		return &v1alpha2.PolicyReportList{}, err
 	}
 
-	// if labelSelector == labels.Everything() {
-	// 	return list, nil
-	// }
-
 	polrList := &v1alpha2.PolicyReportList{
-		Items: make([]v1alpha2.PolicyReport, 0),
+		ListMeta: listMeta,
+		Items:    make([]v1alpha2.PolicyReport, 0, len(objs)),
 	}
-	for _, polr := range list.Items {
-		if polr.Labels == nil {
-			return list, nil
-		}
-		if labelSelector.Matches(labels.Set(polr.Labels)) {
-			polrList.Items = append(polrList.Items, polr)
-		}
+	for _, obj := range objs {
+		polrList.Items = append(polrList.Items, *obj.(*v1alpha2.PolicyReport))
 	}
 
 	return polrList, nil
@@ -85,8 +100,8 @@ func (p *polrStore) List(ctx context.Context, options *metainternalversion.ListO
 
 func (p *polrStore) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
 	namespace := genericapirequest.NamespaceValue(ctx)
-	report, err := p.getPolr(name, namespace)
-	if err != nil || report == nil {
+	report, ok := p.watchCache.Get(p.key(name, namespace))
+	if !ok {
 		return &v1alpha2.PolicyReport{}, errors.NewNotFound(v1alpha2.Resource("policyreports"), name)
 	}
 	return report, nil
@@ -95,18 +110,10 @@ func (p *polrStore) Get(ctx context.Context, name string, options *metav1.GetOpt
 func (p *polrStore) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
 	isDryRun := slices.Contains(options.DryRun, "All")
 
-	err := createValidation(ctx, obj)
-	if err != nil {
-		switch options.FieldValidation {
-		case "Ignore":
-		case "Warn":
-			// return &admissionv1.AdmissionResponse{
-			// 	Allowed:  false,
-			// 	Warnings: []string{err.Error()},
-			// }, nil
-		case "Strict":
-			return &v1alpha2.PolicyReport{}, err
-		}
+	// options.FieldValidation applies to unknown and duplicate fields, which
+	// the handlers report while decoding, validation errors always fail.
+	if err := createValidation(ctx, obj); err != nil {
+		return &v1alpha2.PolicyReport{}, err
 	}
 
 	polr, ok := obj.(*v1alpha2.PolicyReport)
@@ -118,13 +125,23 @@ func (p *polrStore) Create(ctx context.Context, obj runtime.Object, createValida
 	if len(polr.Namespace) == 0 {
 		polr.Namespace = namespace
 	}
+	if errs := ValidatePolicyReport(polr); len(errs) > 0 {
+		return &v1alpha2.PolicyReport{}, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("PolicyReport").GroupKind(), polr.Name, errs)
+	}
+	polr.Results = limitResults(ctx, polr, polr.Results)
+	setSummary(ctx, p.clientSummaries, polr, &polr.Summary, nil, polr.Results)
+	if errs := p.rules.Validate(p.Kind(), polr, nil); len(errs) > 0 {
+		return &v1alpha2.PolicyReport{}, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("PolicyReport").GroupKind(), polr.Name, errs)
+	}
 
 	if !isDryRun {
-		err := p.createPolr(polr)
+		err := p.createPolr(ctx, polr)
 		if err != nil {
+			if _, ok := err.(errors.APIStatus); ok {
+				return &v1alpha2.PolicyReport{}, err
+			}
 			return &v1alpha2.PolicyReport{}, errors.NewBadRequest(fmt.Sprintf("cannot create policy report: %s", err.Error()))
 		}
-		p.broadcaster.Action(watch.Added, obj)
 	}
 
 	return obj, nil
@@ -134,17 +151,22 @@ func (p *polrStore) Update(ctx context.Context, name string, objInfo rest.Update
 	isDryRun := slices.Contains(options.DryRun, "All")
 	namespace := genericapirequest.NamespaceValue(ctx)
 
-	if forceAllowCreate {
-		oldObj, _ := p.getPolr(name, namespace)
-		updatedObject, _ := objInfo.UpdatedObject(ctx, oldObj)
-		polr := updatedObject.(*v1alpha2.PolicyReport)
-		p.updatePolr(polr, true)
-		p.broadcaster.Action(watch.Added, updatedObject)
-		return updatedObject, true, nil
-	}
-
 	oldObj, err := p.getPolr(name, namespace)
-	if err != nil {
+	if storage.IsNotFound(err) {
+		if !forceAllowCreate {
+			return &v1alpha2.PolicyReport{}, false, errors.NewNotFound(v1alpha2.Resource("policyreports"), name)
+		}
+		// server-side apply creates the reports it does not find
+		updatedObject, err := objInfo.UpdatedObject(ctx, nil)
+		if err != nil {
+			return &v1alpha2.PolicyReport{}, false, err
+		}
+		created, err := p.Create(ctx, updatedObject, createValidation, &metav1.CreateOptions{DryRun: options.DryRun, FieldManager: options.FieldManager, FieldValidation: options.FieldValidation})
+		if err != nil {
+			return &v1alpha2.PolicyReport{}, false, err
+		}
+		return created, true, nil
+	} else if err != nil {
 		return &v1alpha2.PolicyReport{}, false, err
 	}
 
@@ -152,18 +174,8 @@ func (p *polrStore) Update(ctx context.Context, name string, objInfo rest.Update
 	if err != nil {
 		return &v1alpha2.PolicyReport{}, false, err
 	}
-	err = updateValidation(ctx, updatedObject, oldObj)
-	if err != nil {
-		switch options.FieldValidation {
-		case "Ignore":
-		case "Warn":
-			// return &admissionv1.AdmissionResponse{
-			// 	Allowed:  false,
-			// 	Warnings: []string{err.Error()},
-			// }, nil
-		case "Strict":
-			return &v1alpha2.PolicyReport{}, false, err
-		}
+	if err := updateValidation(ctx, updatedObject, oldObj); err != nil {
+		return &v1alpha2.PolicyReport{}, false, err
 	}
 
 	polr, ok := updatedObject.(*v1alpha2.PolicyReport)
@@ -174,20 +186,42 @@ func (p *polrStore) Update(ctx context.Context, name string, objInfo rest.Update
 	if len(polr.Namespace) == 0 {
 		polr.Namespace = namespace
 	}
+	// unconditional updates apply on top of the version they were read from
+	if len(polr.ResourceVersion) == 0 {
+		polr.ResourceVersion = oldObj.ResourceVersion
+	}
+	remove, err := prepareUpdate(v1alpha2.Resource("policyreports"), polr, oldObj, time.Now())
+	if err != nil {
+		return &v1alpha2.PolicyReport{}, false, err
+	}
+	if errs := ValidatePolicyReportUpdate(polr, oldObj); len(errs) > 0 {
+		return &v1alpha2.PolicyReport{}, false, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("PolicyReport").GroupKind(), polr.Name, errs)
+	}
+	polr.Results = limitResults(ctx, polr, polr.Results)
+	setSummary(ctx, p.clientSummaries, polr, &polr.Summary, &oldObj.Summary, polr.Results)
+	if errs := p.rules.Validate(p.Kind(), polr, oldObj); len(errs) > 0 {
+		return &v1alpha2.PolicyReport{}, false, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("PolicyReport").GroupKind(), polr.Name, errs)
+	}
 
 	if !isDryRun {
-		err := p.updatePolr(polr, false)
+		// the last finalizer of a deleted report is gone, the update removes it
+		if remove {
+			err = p.deletePolr(ctx, polr)
+		} else {
+			err = p.updatePolr(ctx, polr)
+		}
 		if err != nil {
+			if _, ok := err.(errors.APIStatus); ok {
+				return &v1alpha2.PolicyReport{}, false, err
+			}
 			return &v1alpha2.PolicyReport{}, false, errors.NewBadRequest(fmt.Sprintf("cannot create policy report: %s", err.Error()))
 		}
-		p.broadcaster.Action(watch.Added, updatedObject)
 	}
 
-	return updatedObject, true, nil
+	return updatedObject, false, nil
 }
 
 func (p *polrStore) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
-	// TODO: Use propogation policy
 	isDryRun := slices.Contains(options.DryRun, "All")
 	namespace := genericapirequest.NamespaceValue(ctx)
 
@@ -197,19 +231,39 @@ func (p *polrStore) Delete(ctx context.Context, name string, deleteValidation re
 		return &v1alpha2.PolicyReport{}, false, errors.NewNotFound(v1alpha2.Resource("policyreports"), name)
 	}
 
+	if err := checkPreconditions(v1alpha2.Resource("policyreports"), polr, options.Preconditions); err != nil {
+		return &v1alpha2.PolicyReport{}, false, err
+	}
+
 	err = deleteValidation(ctx, polr)
 	if err != nil {
 		klog.ErrorS(err, "invalid resource", "name", name, "namespace", klog.KRef("", namespace))
 		return &v1alpha2.PolicyReport{}, false, errors.NewBadRequest(fmt.Sprintf("invalid resource: %s", err.Error()))
 	}
 
-	if !isDryRun {
-		err = p.deletePolr(polr)
-		if err != nil {
-			klog.ErrorS(err, "failed to delete polr", "name", name, "namespace", klog.KRef("", namespace))
-			return &v1alpha2.PolicyReport{}, false, errors.NewBadRequest(fmt.Sprintf("failed to delete policyreport: %s", err.Error()))
+	polr = polr.DeepCopy()
+	d := deletion{
+		store:    p,
+		resource: v1alpha2.Resource("policyreports"),
+		dryRun:   isDryRun,
+		update: func(ctx context.Context, report metav1.Object) error {
+			return p.updatePolr(ctx, report.(*v1alpha2.PolicyReport))
+		},
+		remove: func(ctx context.Context, report metav1.Object) error {
+			return p.deletePolr(ctx, report.(*v1alpha2.PolicyReport))
+		},
+	}
+	deleted, err := d.run(ctx, polr, options)
+	if err != nil {
+		klog.ErrorS(err, "failed to delete polr", "name", name, "namespace", klog.KRef("", namespace))
+		if _, ok := err.(errors.APIStatus); ok {
+			return &v1alpha2.PolicyReport{}, false, err
 		}
-		p.broadcaster.Action(watch.Deleted, polr)
+		return &v1alpha2.PolicyReport{}, false, errors.NewBadRequest(fmt.Sprintf("failed to delete policyreport: %s", err.Error()))
+	}
+	// reports with finalizers or a grace period are only marked for deletion
+	if !deleted {
+		return polr, false, nil
 	}
 
 	obj, err := p.polrToObj(polr)
@@ -237,19 +291,23 @@ func (p *polrStore) DeleteCollection(ctx context.Context, deleteValidation rest.
 
 	if !isDryRun {
 		for _, polr := range polrList.Items {
-			obj, isDeleted, err := p.Delete(ctx, polr.GetName(), deleteValidation, options)
-			if !isDeleted {
+			_, _, err := p.Delete(genericapirequest.WithNamespace(ctx, polr.Namespace), polr.GetName(), deleteValidation, options)
+			if err != nil {
 				klog.ErrorS(err, "Failed to delete polr", "name", polr.GetName(), "namespace", klog.KRef("", namespace))
 				return &v1alpha2.PolicyReportList{}, errors.NewBadRequest(fmt.Sprintf("Failed to delete policy report: %s/%s", polr.Namespace, polr.GetName()))
 			}
-			p.broadcaster.Action(watch.Deleted, obj)
 		}
 	}
 	return polrList, nil
 }
 
-func (p *polrStore) Watch(ctx context.Context, _ *metainternalversion.ListOptions) (watch.Interface, error) {
-	return p.broadcaster.Watch()
+func (p *polrStore) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	rev, err := revisionFor(options)
+	if err != nil {
+		return nil, err
+	}
+	namespace := genericapirequest.NamespaceValue(ctx)
+	return p.watchCache.Watch(ctx, rev, filterFor(namespace, options))
 }
 
 func (p *polrStore) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1beta1.Table, error) {
@@ -259,12 +317,12 @@ func (p *polrStore) ConvertToTable(ctx context.Context, object runtime.Object, t
 	case *v1alpha2.PolicyReport:
 		table.ResourceVersion = t.ResourceVersion
 		table.SelfLink = t.SelfLink //nolint:staticcheck // keep deprecated field to be backward compatible
-		addPolicyReportToTable(&table, *t)
+		addPolicyReportToTable(&table, tableOptions, *t)
 	case *v1alpha2.PolicyReportList:
 		table.ResourceVersion = t.ResourceVersion
 		table.SelfLink = t.SelfLink //nolint:staticcheck // keep deprecated field to be backward compatible
 		table.Continue = t.Continue
-		addPolicyReportToTable(&table, t.Items...)
+		addPolicyReportToTable(&table, tableOptions, t.Items...)
 	default:
 	}
 
@@ -284,11 +342,11 @@ func (p *polrStore) ShortNames() []string {
 }
 
 func (p *polrStore) key(name, namespace string) string {
-	return fmt.Sprintf("/apis/%s/namespaces/%s/policyreports/%s", v1alpha2.SchemeGroupVersion, namespace, name)
+	return PolicyReportKey(namespace, name)
 }
 
-func (p *polrStore) keyForList(namespace string) string {
-	return fmt.Sprintf("/apis/%s/namespaces/%s/policyreports/", v1alpha2.SchemeGroupVersion, namespace)
+func (p *polrStore) keyForList() string {
+	return PolicyReportKeyRoot("")
 }
 
 func (c *polrStore) polrToObj(polr *v1alpha2.PolicyReport) (runtime.Object, error) {
@@ -304,6 +362,8 @@ func (c *polrStore) polrToObj(polr *v1alpha2.PolicyReport) (runtime.Object, erro
 	return unst.DeepCopyObject(), nil
 }
 
+// getPolr reads a report from the store, so that writes start from its
+// latest version rather than from the watch cache, which may lag behind.
 func (p *polrStore) getPolr(name, namespace string) (*v1alpha2.PolicyReport, error) {
 	var report v1alpha2.PolicyReport
 	key := p.key(name, namespace)
@@ -316,77 +376,81 @@ func (p *polrStore) getPolr(name, namespace string) (*v1alpha2.PolicyReport, err
 	if err := json.Unmarshal(val.Data, &report); err != nil {
 		return nil, errors.NewBadRequest("invalid object found")
 	}
+	report.ResourceVersion = fmt.Sprint(val.Modified)
 
 	return &report, nil
 }
 
-func (p *polrStore) listPolr(namespace string) (*v1alpha2.PolicyReportList, error) {
-	key := p.keyForList(namespace)
-
-	valList, err := p.store.List(context.TODO(), key, 0)
-	if err != nil {
-		return nil, errorpkg.Wrapf(err, "could not find policy report in store")
-	}
-
-	reportList := &v1alpha2.PolicyReportList{
-		Items: make([]v1alpha2.PolicyReport, len(valList)),
-	}
-
-	var polr v1alpha2.PolicyReport
-	for i, val := range valList {
-		if err := json.Unmarshal(val.Data, &polr); err != nil {
-			return nil, errors.NewBadRequest("invalid object found")
-		}
-		reportList.Items[i] = polr
-	}
-	return reportList, nil
-}
-
-func (p *polrStore) createPolr(report *v1alpha2.PolicyReport) error {
+func (p *polrStore) createPolr(ctx context.Context, report *v1alpha2.PolicyReport) error {
 	key := p.key(report.Name, report.Namespace)
 
-	report.ResourceVersion = fmt.Sprint(1)
+	report.ResourceVersion = ""
 	report.UID = uuid.NewUUID()
 	report.CreationTimestamp = metav1.Now()
-
+	touch(report, time.Now())
 	val, err := json.Marshal(report)
 	if err != nil {
 		return errorpkg.Wrapf(err, "could not marshal report")
 	}
-	return p.store.Create(context.TODO(), key, val)
+	if err := p.quota.admit(p.usage, v1alpha2.Resource("policyreports"), key, report.Namespace, report.Name, len(val)); err != nil {
+		return err
+	}
+	revision, err := p.store.CreateRevision(ctx, key, val)
+	if err != nil {
+		return writeError(v1alpha2.Resource("policyreports"), report.Name, err)
+	}
+	p.written(ctx, report, revision)
+	return nil
 }
 
-func (p *polrStore) updatePolr(report *v1alpha2.PolicyReport, force bool) error {
+// updatePolr writes report to the store if it still is at its resource version.
+func (p *polrStore) updatePolr(ctx context.Context, report *v1alpha2.PolicyReport) error {
 	key := p.key(report.Name, report.Namespace)
-	if !force {
-		oldReport, err := p.getPolr(report.GetName(), report.Namespace)
-		if err != nil {
-			return errorpkg.Wrapf(err, "old policy report not found")
-		}
-		oldRV, err := strconv.ParseInt(oldReport.ResourceVersion, 10, 64)
-		if err != nil {
-			return errorpkg.Wrapf(err, "could not parse resource version")
-		}
 
-		report.ResourceVersion = fmt.Sprint(oldRV + 1)
-	} else {
-		report.ResourceVersion = "1"
+	rev, err := strconv.ParseInt(report.ResourceVersion, 10, 64)
+	if err != nil {
+		return errorpkg.Wrapf(err, "could not parse report's resource version")
 	}
+	report.ResourceVersion = ""
+	touch(report, time.Now())
 	val, err := json.Marshal(report)
 	if err != nil {
 		return errorpkg.Wrapf(err, "could not marshal report")
 	}
+	// reports being deleted are not subject to quota
+	if report.DeletionTimestamp == nil {
+		if err := p.quota.admit(p.usage, v1alpha2.Resource("policyreports"), key, report.Namespace, report.Name, len(val)); err != nil {
+			return err
+		}
+	}
+	revision, err := p.store.UpdateRevision(ctx, key, rev, val)
+	if err != nil {
+		return writeError(v1alpha2.Resource("policyreports"), report.Name, err)
+	}
+	p.written(ctx, report, revision)
+	return nil
+}
 
-	rev, _ := strconv.ParseInt(report.ResourceVersion, 10, 64)
-	return p.store.Update(context.TODO(), key, rev, val)
+// written sets the revision of the write of a report as its resource version,
+// and waits for the watch cache to observe it.
+func (p *polrStore) written(ctx context.Context, report *v1alpha2.PolicyReport, revision int64) {
+	report.ResourceVersion = fmt.Sprint(revision)
+	waitForWrite(ctx, p.watchCache, revision)
 }
 
-func (p *polrStore) deletePolr(report *v1alpha2.PolicyReport) error {
+// deletePolr removes report from the store if it still is at its resource
+// version, and waits for the watch cache to observe the deletion.
+func (p *polrStore) deletePolr(ctx context.Context, report *v1alpha2.PolicyReport) error {
 	key := p.key(report.Name, report.Namespace)
 
 	rev, err := strconv.ParseInt(report.ResourceVersion, 10, 64)
 	if err != nil {
-		return errorpkg.Wrapf(err, "could not marshal report's resource version")
+		return errorpkg.Wrapf(err, "could not parse report's resource version")
+	}
+	revision, err := p.store.DeleteRevision(ctx, key, rev)
+	if err != nil {
+		return writeError(v1alpha2.Resource("policyreports"), report.Name, err)
 	}
-	return p.store.Delete(context.TODO(), key, rev)
+	waitForWrite(ctx, p.watchCache, revision)
+	return nil
 }
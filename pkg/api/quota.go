@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Quota limits the storage used by the reports of a namespace, cluster policy
+// reports are accounted for as a namespace of their own. Zero disables a limit.
+// Quotas are checked against the usage observed by this replica, concurrent
+// writes on other replicas may exceed them slightly.
+type Quota struct {
+	MaxReportsPerNamespace int64 `json:"maxReportsPerNamespace,omitempty"`
+	MaxBytesPerNamespace   int64 `json:"maxBytesPerNamespace,omitempty"`
+	MaxReportBytes         int64 `json:"maxReportBytes,omitempty"`
+}
+
+// admit checks that storing size bytes under key keeps namespace within the
+// quota, given its current usage. It returns a Forbidden error otherwise.
+func (q Quota) admit(usage *storage.Usage, resource schema.GroupResource, key, namespace, name string, size int) error {
+	if q.MaxReportBytes > 0 && int64(size) > q.MaxReportBytes {
+		return errors.NewForbidden(resource, name, fmt.Errorf("exceeded quota: report is %d bytes, maximum is %d bytes", size, q.MaxReportBytes))
+	}
+
+	current := usage.Namespace(namespace)
+	oldSize := usage.Size(key)
+	reports := current.Reports
+	if oldSize == 0 {
+		reports++
+	}
+	if q.MaxReportsPerNamespace > 0 && reports > q.MaxReportsPerNamespace {
+		return errors.NewForbidden(resource, name, fmt.Errorf("exceeded quota: namespace %q would hold %d reports, maximum is %d", namespace, reports, q.MaxReportsPerNamespace))
+	}
+	if bytes := current.Bytes - oldSize + int64(size); q.MaxBytesPerNamespace > 0 && bytes > q.MaxBytesPerNamespace {
+		return errors.NewForbidden(resource, name, fmt.Errorf("exceeded quota: namespace %q would hold %d bytes, maximum is %d bytes", namespace, bytes, q.MaxBytesPerNamespace))
+	}
+	return nil
+}
+
+// QuotaStatus is served by the quota status endpoint.
+type QuotaStatus struct {
+	Quota Quota `json:"quota"`
+	// Namespaces is the usage of the policy reports of each namespace.
+	Namespaces map[string]storage.NamespaceUsage `json:"namespaces"`
+	// Cluster is the usage of the cluster policy reports.
+	Cluster storage.NamespaceUsage `json:"cluster"`
+}
+
+// quotaStatusHandler serves the quota and the storage usage of each namespace.
+func quotaStatusHandler(quota Quota, polrUsage, cpolrUsage *storage.Usage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		status := QuotaStatus{
+			Quota:      quota,
+			Namespaces: polrUsage.Namespaces(),
+			Cluster:    cpolrUsage.Namespace(""),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+func TestAPI(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "API Test")
+}
+
+var _ = Describe("Quota", func() {
+	resource := v1alpha2.Resource("policyreports")
+
+	var usage *storage.Usage
+	BeforeEach(func() {
+		usage = storage.NewUsage("policyreports")
+		usage.Observe(watch.Added, PolicyReportKey("default", "a"), &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}}, 60)
+	})
+
+	It("should admit writes within the quota", func() {
+		quota := Quota{MaxReportsPerNamespace: 2, MaxBytesPerNamespace: 100, MaxReportBytes: 50}
+		Expect(quota.admit(usage, resource, PolicyReportKey("default", "b"), "default", "b", 40)).To(Succeed())
+		// updates replace the size of the report
+		Expect(quota.admit(usage, resource, PolicyReportKey("default", "a"), "default", "a", 50)).To(Succeed())
+		Expect(Quota{}.admit(usage, resource, PolicyReportKey("default", "b"), "default", "b", 1<<20)).To(Succeed())
+	})
+
+	It("should forbid writes exceeding the quota", func() {
+		for _, quota := range []Quota{{MaxReportsPerNamespace: 1}, {MaxBytesPerNamespace: 100}, {MaxReportBytes: 30}} {
+			err := quota.admit(usage, resource, PolicyReportKey("default", "b"), "default", "b", 41)
+			Expect(errors.IsForbidden(err)).To(BeTrue(), "quota %+v", quota)
+		}
+		// other namespaces have their own quota
+		quota := Quota{MaxReportsPerNamespace: 1}
+		Expect(quota.admit(usage, resource, PolicyReportKey("other", "b"), "other", "b", 41)).To(Succeed())
+	})
+
+	It("should forbid applies exceeding the quota", func() {
+		const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+		body := func(name string) string {
+			return `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"` + name + `"}}`
+		}
+		for _, generic := range []bool{false, true} {
+			handler := newTestServer(inmemory.New(), Options{GenericRegistry: generic, Quota: Quota{MaxReportsPerNamespace: 1}})
+			rec := apply(handler, reports+"/a", body("a"))
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+			rec = apply(handler, reports+"/b", body("b"))
+			Expect(rec.Code).To(Equal(http.StatusForbidden), rec.Body.String())
+			rec = serve(handler, http.MethodGet, reports+"/b", "")
+			Expect(rec.Code).To(Equal(http.StatusNotFound), rec.Body.String())
+		}
+	})
+})
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/generic"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	registrygeneric "k8s.io/apiserver/pkg/registry/generic"
+	genericregistry "k8s.io/apiserver/pkg/registry/generic/registry"
+	"k8s.io/apiserver/pkg/registry/rest"
+	apistorage "k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// registryREST serves a report resource through the upstream generic
+// registry, which brings preconditions, finalizers, graceful deletion,
+// dry-run and field selectors with the semantics of kube-apiserver.
+type registryREST struct {
+	*genericregistry.Store
+	kind       string
+	shortNames []string
+	// stop stops the reflector feeding the usage and the views.
+	stop context.CancelFunc
+}
+
+func (r *registryREST) Kind() string {
+	return r.kind
+}
+
+func (r *registryREST) ShortNames() []string {
+	return r.shortNames
+}
+
+func (r *registryREST) Destroy() {
+	r.Store.Destroy()
+	r.stop()
+}
+
+// PolicyReportRegistryStore returns policy report storage built on
+// genericregistry.Store. Like the built-in store, it enforces quota and keeps
+// usage and observers in sync with the backend.
+func PolicyReportRegistryStore(store storage.Storage, usage *storage.Usage, quota Quota, rules *Rules, clientSummaries bool, observers ...storage.Observer) (API, error) {
+	watchCache := storage.NewWatchCache("policyreports", watchCacheCapacity)
+	_, stop, err := startReflector(store, "policyreports", PolicyReportKeyRoot(""), watchCache, decodePolicyReport, append([]storage.Observer{usage}, observers...)...)
+	if err != nil {
+		return nil, err
+	}
+	strategy := reportStrategy{ObjectTyper: Scheme, NameGenerator: names.SimpleNameGenerator, namespaced: true, rules: rules, clientSummaries: clientSummaries}
+	r := &genericregistry.Store{
+		NewFunc:                   func() runtime.Object { return &v1alpha2.PolicyReport{} },
+		NewListFunc:               func() runtime.Object { return &v1alpha2.PolicyReportList{} },
+		DefaultQualifiedResource:  v1alpha2.Resource("policyreports"),
+		SingularQualifiedResource: v1alpha2.Resource("policyreport"),
+		KeyRootFunc: func(ctx context.Context) string {
+			return PolicyReportKeyRoot(genericapirequest.NamespaceValue(ctx))
+		},
+		KeyFunc: func(ctx context.Context, name string) (string, error) {
+			return PolicyReportKey(genericapirequest.NamespaceValue(ctx), name), nil
+		},
+		CreateStrategy: strategy,
+		UpdateStrategy: strategy,
+		DeleteStrategy: strategy,
+		TableConvertor: &polrStore{},
+	}
+	options := &registrygeneric.StoreOptions{RESTOptions: restOptionsGetter{store: store, watchCache: watchCache, usage: usage, quota: quota}}
+	if err := r.CompleteWithOptions(options); err != nil {
+		stop()
+		return nil, err
+	}
+	return &registryREST{Store: r, kind: "PolicyReport", shortNames: []string{"polr"}, stop: stop}, nil
+}
+
+// ClusterPolicyReportRegistryStore returns cluster policy report storage built
+// on genericregistry.Store.
+func ClusterPolicyReportRegistryStore(store storage.Storage, usage *storage.Usage, quota Quota, rules *Rules, clientSummaries bool, observers ...storage.Observer) (API, error) {
+	watchCache := storage.NewWatchCache("clusterpolicyreports", watchCacheCapacity)
+	_, stop, err := startReflector(store, "clusterpolicyreports", ClusterPolicyReportKeyRoot(), watchCache, decodeClusterPolicyReport, append([]storage.Observer{usage}, observers...)...)
+	if err != nil {
+		return nil, err
+	}
+	strategy := reportStrategy{ObjectTyper: Scheme, NameGenerator: names.SimpleNameGenerator, namespaced: false, rules: rules, clientSummaries: clientSummaries}
+	r := &genericregistry.Store{
+		NewFunc:                   func() runtime.Object { return &v1alpha2.ClusterPolicyReport{} },
+		NewListFunc:               func() runtime.Object { return &v1alpha2.ClusterPolicyReportList{} },
+		DefaultQualifiedResource:  v1alpha2.Resource("clusterpolicyreports"),
+		SingularQualifiedResource: v1alpha2.Resource("clusterpolicyreport"),
+		KeyRootFunc: func(ctx context.Context) string {
+			return ClusterPolicyReportKeyRoot()
+		},
+		KeyFunc: func(ctx context.Context, name string) (string, error) {
+			return ClusterPolicyReportKey(name), nil
+		},
+		CreateStrategy: strategy,
+		UpdateStrategy: strategy,
+		DeleteStrategy: strategy,
+		TableConvertor: &cpolrStore{},
+	}
+	options := &registrygeneric.StoreOptions{RESTOptions: restOptionsGetter{store: store, watchCache: watchCache, usage: usage, quota: quota}}
+	if err := r.CompleteWithOptions(options); err != nil {
+		stop()
+		return nil, err
+	}
+	return &registryREST{Store: r, kind: "ClusterPolicyReport", shortNames: []string{"cpolr"}, stop: stop}, nil
+}
+
+// restOptionsGetter hands the generic registry a storage.Interface over our backend.
+type restOptionsGetter struct {
+	store      storage.Storage
+	watchCache *storage.WatchCache
+	usage      *storage.Usage
+	quota      Quota
+}
+
+func (g restOptionsGetter) GetRESTOptions(resource schema.GroupResource) (registrygeneric.RESTOptions, error) {
+	codec := Codecs.LegacyCodec(v1alpha2.SchemeGroupVersion)
+	return registrygeneric.RESTOptions{
+		StorageConfig: &storagebackend.ConfigForResource{
+			Config: storagebackend.Config{
+				Codec:           codec,
+				EncodeVersioner: v1alpha2.SchemeGroupVersion,
+			},
+			GroupResource: resource,
+		},
+		Decorator: func(_ *storagebackend.ConfigForResource, _ string, keyFunc func(obj runtime.Object) (string, error), newFunc func() runtime.Object, _ func() runtime.Object, _ apistorage.AttrFunc, _ apistorage.IndexerFuncs, _ *cache.Indexers) (apistorage.Interface, factory.DestroyFunc, error) {
+			return &quotaStorage{
+				Interface:  generic.New(g.store, codec, resource.Resource, keyFunc, newFunc),
+				resource:   resource,
+				watchCache: g.watchCache,
+				usage:      g.usage,
+				quota:      g.quota,
+			}, func() {}, nil
+		},
+		ResourcePrefix: "/apis/" + v1alpha2.SchemeGroupVersion.String(),
+	}, nil
+}
+
+// quotaStorage enforces quota on the writes of the generic registry against
+// the usage observed by the reflector of the resource, and waits for its watch
+// cache to observe each write so that the usage and the views include it.
+type quotaStorage struct {
+	apistorage.Interface
+	resource   schema.GroupResource
+	watchCache *storage.WatchCache
+	usage      *storage.Usage
+	quota      Quota
+}
+
+func (s *quotaStorage) Create(ctx context.Context, key string, obj, out runtime.Object, ttl uint64) error {
+	if err := s.admit(key, obj); err != nil {
+		return err
+	}
+	if err := s.Interface.Create(ctx, key, obj, out, ttl); err != nil {
+		return err
+	}
+	s.written(ctx, out)
+	return nil
+}
+
+func (s *quotaStorage) GuaranteedUpdate(ctx context.Context, key string, destination runtime.Object, ignoreNotFound bool, preconditions *apistorage.Preconditions, tryUpdate apistorage.UpdateFunc, cachedExistingObject runtime.Object) error {
+	err := s.Interface.GuaranteedUpdate(ctx, key, destination, ignoreNotFound, preconditions, func(input runtime.Object, res apistorage.ResponseMeta) (runtime.Object, *uint64, error) {
+		updated, ttl, err := tryUpdate(input, res)
+		if err != nil {
+			return nil, nil, err
+		}
+		// reports being deleted are not subject to quota
+		if accessor, err := meta.Accessor(updated); err == nil && accessor.GetDeletionTimestamp() != nil {
+			return updated, ttl, nil
+		}
+		if err := s.admit(key, updated); err != nil {
+			return nil, nil, err
+		}
+		return updated, ttl, nil
+	}, cachedExistingObject)
+	if err != nil {
+		return err
+	}
+	s.written(ctx, destination)
+	return nil
+}
+
+func (s *quotaStorage) admit(key string, obj runtime.Object) error {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return s.quota.admit(s.usage, s.resource, key, accessor.GetNamespace(), accessor.GetName(), len(data))
+}
+
+// written waits for the watch cache to observe the write of obj.
+func (s *quotaStorage) written(ctx context.Context, obj runtime.Object) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	if revision, err := strconv.ParseInt(accessor.GetResourceVersion(), 10, 64); err == nil {
+		waitForWrite(ctx, s.watchCache, revision)
+	}
+}
+
+// reportStrategy implements the create, update and delete strategies of both report kinds.
+type reportStrategy struct {
+	runtime.ObjectTyper
+	names.NameGenerator
+
+	namespaced bool
+	rules      *Rules
+	// clientSummaries keeps the summaries submitted by writers.
+	clientSummaries bool
+}
+
+func (s reportStrategy) NamespaceScoped() bool {
+	return s.namespaced
+}
+
+func (s reportStrategy) PrepareForCreate(ctx context.Context, obj runtime.Object) {
+	touch(obj, time.Now())
+	s.prepareResults(ctx, obj, nil)
+}
+
+func (s reportStrategy) Validate(ctx context.Context, obj runtime.Object) field.ErrorList {
+	switch report := obj.(type) {
+	case *v1alpha2.PolicyReport:
+		return append(ValidatePolicyReport(report), s.rules.Validate("PolicyReport", report, nil)...)
+	case *v1alpha2.ClusterPolicyReport:
+		return append(ValidateClusterPolicyReport(report), s.rules.Validate("ClusterPolicyReport", report, nil)...)
+	}
+	return nil
+}
+
+func (reportStrategy) WarningsOnCreate(ctx context.Context, obj runtime.Object) []string {
+	return nil
+}
+
+func (reportStrategy) Canonicalize(obj runtime.Object) {}
+
+func (reportStrategy) AllowCreateOnUpdate() bool {
+	return false
+}
+
+func (s reportStrategy) PrepareForUpdate(ctx context.Context, obj, old runtime.Object) {
+	touch(obj, time.Now())
+	s.prepareResults(ctx, obj, old)
+}
+
+// prepareResults limits the results of a report and sets its summary, old is
+// nil on creates.
+func (s reportStrategy) prepareResults(ctx context.Context, obj, old runtime.Object) {
+	switch report := obj.(type) {
+	case *v1alpha2.PolicyReport:
+		var previous *v1alpha2.PolicyReportSummary
+		if old, ok := old.(*v1alpha2.PolicyReport); ok {
+			previous = &old.Summary
+		}
+		report.Results = limitResults(ctx, report, report.Results)
+		setSummary(ctx, s.clientSummaries, report, &report.Summary, previous, report.Results)
+	case *v1alpha2.ClusterPolicyReport:
+		var previous *v1alpha2.PolicyReportSummary
+		if old, ok := old.(*v1alpha2.ClusterPolicyReport); ok {
+			previous = &old.Summary
+		}
+		report.Results = limitResults(ctx, report, report.Results)
+		setSummary(ctx, s.clientSummaries, report, &report.Summary, previous, report.Results)
+	}
+}
+
+func (s reportStrategy) ValidateUpdate(ctx context.Context, obj, old runtime.Object) field.ErrorList {
+	switch report := obj.(type) {
+	case *v1alpha2.PolicyReport:
+		return append(ValidatePolicyReportUpdate(report, old.(*v1alpha2.PolicyReport)), s.rules.Validate("PolicyReport", report, old)...)
+	case *v1alpha2.ClusterPolicyReport:
+		return append(ValidateClusterPolicyReportUpdate(report, old.(*v1alpha2.ClusterPolicyReport)), s.rules.Validate("ClusterPolicyReport", report, old)...)
+	}
+	return nil
+}
+
+func (reportStrategy) WarningsOnUpdate(ctx context.Context, obj, old runtime.Object) []string {
+	return nil
+}
+
+func (reportStrategy) AllowUnconditionalUpdate() bool {
+	return true
+}
+
+var _ rest.RESTCreateStrategy = reportStrategy{}
+var _ rest.RESTUpdateStrategy = reportStrategy{}
+var _ rest.RESTDeleteStrategy = reportStrategy{}
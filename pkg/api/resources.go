@@ -0,0 +1,378 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	apistorage "k8s.io/apiserver/pkg/storage"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// ResourceReportFields are the fields resource reports can be selected by.
+var ResourceReportFields = []string{
+	"metadata.name", "metadata.namespace",
+	"resource.apiVersion", "resource.kind", "resource.name", "resource.uid",
+}
+
+// resourceResultFields are the fields of the rows of the results index
+// matching the fields of resource reports, to find their candidates.
+var resourceResultFields = map[string]string{
+	"resource.kind": "scope.kind",
+	"resource.name": "scope.name",
+	"resource.uid":  "scope.uid",
+}
+
+// resourceReportFieldLabelConversion accepts the fields resource reports can
+// be selected by.
+func resourceReportFieldLabelConversion(label, value string) (string, string, error) {
+	if slices.Contains(ResourceReportFields, label) {
+		return label, value, nil
+	}
+	return "", "", fmt.Errorf("field label not supported: %s", label)
+}
+
+// resourceRefs returns the resources a result is about, the scope of its
+// report and the resources of the result, without duplicates. Resources
+// without a namespace are taken to be in the namespace of the report.
+func resourceRefs(row *views.PolicyResult) []corev1.ObjectReference {
+	resources := row.Result.Subjects
+	if row.Scope != nil {
+		resources = append([]*corev1.ObjectReference{row.Scope}, resources...)
+	}
+	refs := make([]corev1.ObjectReference, 0, len(resources))
+	seen := sets.New[string]()
+	for _, resource := range resources {
+		if resource == nil {
+			continue
+		}
+		ref := corev1.ObjectReference{
+			APIVersion: resource.APIVersion,
+			Kind:       resource.Kind,
+			Namespace:  resource.Namespace,
+			Name:       resource.Name,
+			UID:        resource.UID,
+		}
+		if len(ref.Namespace) == 0 {
+			ref.Namespace = row.Namespace
+		}
+		if key := resourceKey(ref); !seen.Has(key) {
+			seen.Insert(key)
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// resourceKey identifies the report of a resource by the scope and the name of
+// the report.
+func resourceKey(ref corev1.ObjectReference) string {
+	return resourcePrefix(ref.Namespace) + resourceReportName(ref)
+}
+
+// resourcePrefix is the prefix of the keys of the reports of the resources of
+// namespace, or of the cluster-scoped resources if it is empty.
+func resourcePrefix(namespace string) string {
+	if len(namespace) == 0 {
+		return "/cluster/"
+	}
+	return "/namespaces/" + namespace + "/"
+}
+
+// resourceReportName is the name of the report of a resource, its UID or,
+// when no report knows it, its kind, API group and name, as
+// deployment.apps:nginx, kinds and groups never holding a colon.
+func resourceReportName(ref corev1.ObjectReference) string {
+	if len(ref.UID) > 0 {
+		return string(ref.UID)
+	}
+	name := strings.ToLower(ref.Kind)
+	if group := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind).Group; len(group) > 0 {
+		name += "." + group
+	}
+	return name + ":" + ref.Name
+}
+
+// anonymousResourceKey is the key of the results about the resource of ref
+// which do not name its UID.
+func anonymousResourceKey(ref corev1.ObjectReference) string {
+	ref.UID = ""
+	return resourceKey(ref)
+}
+
+// hasResource reports whether the report of the resource at key exists, the
+// results which do not name the UID of their resource being merged into the
+// reports of the resources with a known UID. It must be called with the lock
+// held.
+func (i *resultIndex) hasResource(key string) bool {
+	_, ok := i.resources[key]
+	return ok && i.identified[key].Len() == 0
+}
+
+// resourceReport merges the rows about the resource at key, it must be called
+// with the lock held.
+func (i *resultIndex) resourceReport(key string) *views.ResourceReport {
+	report := &views.ResourceReport{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha2.SchemeGroupVersion.String(), Kind: "ResourceReport"},
+	}
+	rowKeys := i.resources[key]
+	if first := sets.List(rowKeys); len(first) > 0 {
+		for _, ref := range resourceRefs(i.rows[first[0]].result) {
+			if resourceKey(ref) == key {
+				report.Resource = ref
+				break
+			}
+		}
+	}
+	if len(report.Resource.UID) > 0 {
+		rowKeys = rowKeys.Union(i.resources[anonymousResourceKey(report.Resource)])
+	}
+	for _, rowKey := range sets.List(rowKeys) {
+		row := i.rows[rowKey].result
+		result := row.Result.DeepCopy()
+		report.Results = append(report.Results, views.ResourceResult{Report: row.Report, Result: *result})
+		addSummary(&report.Summary, summarize([]*v1alpha2.PolicyReportResult{result}), 1)
+	}
+	report.Name = resourceReportName(report.Resource)
+	report.Namespace = report.Resource.Namespace
+	report.ResourceVersion = fmt.Sprint(i.revision)
+	return report
+}
+
+// resourceCandidates returns the keys of the resources which may match
+// selector, the resources of the rows matching its indexed equality
+// requirements, or every key.
+func (i *resultIndex) resourceCandidates(selector fields.Selector) sets.Set[string] {
+	var requirements []string
+	for _, requirement := range selector.Requirements() {
+		field, ok := resourceResultFields[requirement.Field]
+		if ok && (requirement.Operator == selection.Equals || requirement.Operator == selection.DoubleEquals) {
+			requirements = append(requirements, field+"="+requirement.Value)
+		}
+	}
+	if len(requirements) == 0 {
+		return sets.KeySet(i.resources)
+	}
+	rowSelector, err := fields.ParseSelector(strings.Join(requirements, ","))
+	if err != nil {
+		return sets.KeySet(i.resources)
+	}
+	keys := sets.New[string]()
+	for rowKey := range i.candidates("", rowSelector) {
+		row := i.rows[rowKey]
+		if !matchFields(rowSelector, row.fields) {
+			continue
+		}
+		for _, ref := range resourceRefs(row.result) {
+			keys.Insert(resourceKey(ref))
+		}
+	}
+	return keys
+}
+
+// listResources returns the reports of the resources with keys starting with
+// prefix matching options, in key order after the continue key of options. It
+// returns the continue token of the next page if limit cut the list short.
+func (i *resultIndex) listResources(prefix string, options *metainternalversion.ListOptions) (*views.ResourceReportList, error) {
+	labelSelector, fieldSelector := labels.Everything(), fields.Everything()
+	var limit int64
+	var start string
+	if options != nil {
+		if options.LabelSelector != nil {
+			labelSelector = options.LabelSelector
+		}
+		if options.FieldSelector != nil {
+			fieldSelector = options.FieldSelector
+		}
+		limit = options.Limit
+		if len(options.Continue) > 0 {
+			key, _, err := apistorage.DecodeContinue(options.Continue, "/")
+			if err != nil {
+				return nil, errors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+			}
+			start = key
+		}
+	}
+
+	i.RLock()
+	defer i.RUnlock()
+
+	keys := i.resourceCandidates(fieldSelector).UnsortedList()
+	sort.Strings(keys)
+	list := &views.ResourceReportList{Items: []views.ResourceReport{}}
+	list.ResourceVersion = fmt.Sprint(i.revision)
+	var last string
+	for _, key := range keys {
+		if key <= start || !strings.HasPrefix(key, prefix) || !i.hasResource(key) {
+			continue
+		}
+		report := i.resourceReport(key)
+		if !labelSelector.Matches(labels.Set(report.Labels)) || !fieldSelector.Matches(resourceReportFields(report)) {
+			continue
+		}
+		if limit > 0 && int64(len(list.Items)) == limit {
+			token, err := apistorage.EncodeContinue(last, "/", int64(max(i.revision, 1)))
+			if err != nil {
+				return nil, err
+			}
+			list.Continue = token
+			break
+		}
+		list.Items = append(list.Items, *report)
+		last = key
+	}
+	return list, nil
+}
+
+func (i *resultIndex) getResource(namespace, name string) (*views.ResourceReport, bool) {
+	i.RLock()
+	defer i.RUnlock()
+
+	key := resourcePrefix(namespace) + name
+	if !i.hasResource(key) {
+		return nil, false
+	}
+	return i.resourceReport(key), true
+}
+
+func resourceReportFields(report *views.ResourceReport) fields.Set {
+	return fields.Set{
+		"metadata.name":       report.Name,
+		"metadata.namespace":  report.Namespace,
+		"resource.apiVersion": report.Resource.APIVersion,
+		"resource.kind":       report.Resource.Kind,
+		"resource.name":       report.Resource.Name,
+		"resource.uid":        string(report.Resource.UID),
+	}
+}
+
+// resourceReportStore serves the results about each resource merged across
+// reports from a resultIndex, as the read-only resourcereports resource for
+// namespaced resources and clusterresourcereports for cluster-scoped ones.
+type resourceReportStore struct {
+	index      *resultIndex
+	namespaced bool
+}
+
+func (r *resourceReportStore) New() runtime.Object {
+	if r.namespaced {
+		return &views.ResourceReport{}
+	}
+	return &views.ClusterResourceReport{}
+}
+
+func (r *resourceReportStore) Destroy() {}
+
+func (r *resourceReportStore) Kind() string {
+	if r.namespaced {
+		return "ResourceReport"
+	}
+	return "ClusterResourceReport"
+}
+
+func (r *resourceReportStore) NewList() runtime.Object {
+	if r.namespaced {
+		return &views.ResourceReportList{}
+	}
+	return &views.ClusterResourceReportList{}
+}
+
+func (r *resourceReportStore) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	prefix := resourcePrefix("")
+	if r.namespaced {
+		prefix = "/namespaces/"
+		if namespace := genericapirequest.NamespaceValue(ctx); len(namespace) > 0 {
+			prefix = resourcePrefix(namespace)
+		}
+	}
+	list, err := r.index.listResources(prefix, options)
+	if err != nil || r.namespaced {
+		return list, err
+	}
+	clusterList := &views.ClusterResourceReportList{ListMeta: list.ListMeta, Items: make([]views.ClusterResourceReport, 0, len(list.Items))}
+	for i := range list.Items {
+		clusterList.Items = append(clusterList.Items, *clusterResourceReport(&list.Items[i]))
+	}
+	return clusterList, nil
+}
+
+func (r *resourceReportStore) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	report, ok := r.index.getResource(genericapirequest.NamespaceValue(ctx), name)
+	if !ok {
+		return nil, errors.NewNotFound(v1alpha2.Resource(strings.ToLower(r.Kind())+"s"), name)
+	}
+	if !r.namespaced {
+		return clusterResourceReport(report), nil
+	}
+	return report, nil
+}
+
+// clusterResourceReport returns report as the report of a cluster-scoped
+// resource.
+func clusterResourceReport(report *views.ResourceReport) *views.ClusterResourceReport {
+	clusterReport := views.ClusterResourceReport(*report)
+	clusterReport.Kind = "ClusterResourceReport"
+	return &clusterReport
+}
+
+func (r *resourceReportStore) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	var table metav1.Table
+	switch t := object.(type) {
+	case *views.ResourceReport:
+		table.ResourceVersion = t.ResourceVersion
+		addResourceReportToTable(&table, *t)
+	case *views.ResourceReportList:
+		table.ResourceVersion = t.ResourceVersion
+		table.Continue = t.Continue
+		addResourceReportToTable(&table, t.Items...)
+	case *views.ClusterResourceReport:
+		table.ResourceVersion = t.ResourceVersion
+		addResourceReportToTable(&table, views.ResourceReport(*t))
+	case *views.ClusterResourceReportList:
+		table.ResourceVersion = t.ResourceVersion
+		table.Continue = t.Continue
+		reports := make([]views.ResourceReport, 0, len(t.Items))
+		for _, report := range t.Items {
+			reports = append(reports, views.ResourceReport(report))
+		}
+		addResourceReportToTable(&table, reports...)
+	}
+	return &table, nil
+}
+
+func (r *resourceReportStore) NamespaceScoped() bool {
+	return r.namespaced
+}
+
+func (r *resourceReportStore) GetSingularName() string {
+	return strings.ToLower(r.Kind())
+}
+
+func (r *resourceReportStore) ShortNames() []string {
+	if r.namespaced {
+		return []string{"resrep"}
+	}
+	return []string{"cresrep"}
+}
+
+var _ rest.Getter = &resourceReportStore{}
+var _ rest.Lister = &resourceReportStore{}
+var _ rest.KindProvider = &resourceReportStore{}
+var _ rest.Scoper = &resourceReportStore{}
+var _ rest.SingularNameProvider = &resourceReportStore{}
+var _ rest.ShortNamesProvider = &resourceReportStore{}
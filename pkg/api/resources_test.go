@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+)
+
+var _ = Describe("Resource reports", func() {
+	const (
+		reports        = "/apis/wgpolicyk8s.io/v1alpha2/resourcereports"
+		inTeam         = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/resourcereports"
+		clusterReports = "/apis/wgpolicyk8s.io/v1alpha2/clusterresourcereports"
+	)
+
+	var handler http.Handler
+	BeforeEach(func() {
+		handler = newTestServer(inmemory.New(), Options{})
+		for _, report := range []struct{ path, body string }{
+			{"/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"kyverno"},
+				"scope":{"apiVersion":"apps/v1","kind":"Deployment","name":"a","uid":"1234"},
+				"results":[{"policy":"require-labels","rule":"check-team","result":"fail","source":"kyverno"},
+				           {"policy":"require-labels","rule":"check-owner","result":"pass","source":"kyverno"}]}`},
+			{"/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"trivy"},
+				"results":[{"policy":"CVE-1","result":"fail","source":"trivy","resources":[{"apiVersion":"apps/v1","kind":"Deployment","name":"a"},{"kind":"Pod","name":"b"}]},
+				           {"policy":"CVE-2","result":"warn","source":"trivy","resources":[{"kind":"Pod","name":"b"}]}]}`},
+			{"/apis/wgpolicyk8s.io/v1alpha2/clusterpolicyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"ClusterPolicyReport","metadata":{"name":"falco"},
+				"results":[{"policy":"shell","result":"fail","source":"falco","resources":[{"apiVersion":"apps/v1","kind":"Deployment","namespace":"team","name":"a"},{"kind":"Node","name":"n"}]}]}`},
+		} {
+			rec := serve(handler, http.MethodPost, report.path, report.body)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		}
+	})
+
+	list := func(path string, query url.Values) []string {
+		rec := serve(handler, http.MethodGet, path+"?"+query.Encode(), "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		var list views.ResourceReportList
+		Expect(json.Unmarshal(rec.Body.Bytes(), &list)).To(Succeed())
+		var names []string
+		for _, item := range list.Items {
+			names = append(names, item.Namespace+"/"+item.Name)
+		}
+		return names
+	}
+
+	It("should merge the results about a resource from every report", func() {
+		rec := serve(handler, http.MethodGet, inTeam+"/1234", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		var report views.ResourceReport
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		Expect(report.Resource.Kind).To(Equal("Deployment"))
+		Expect(string(report.Resource.UID)).To(Equal("1234"))
+		Expect(report.Summary.Fail).To(Equal(3))
+		Expect(report.Summary.Pass).To(Equal(1))
+		var sources []string
+		for _, result := range report.Results {
+			sources = append(sources, result.Report.Name+"/"+result.Result.Source)
+		}
+		Expect(sources).To(Equal([]string{"falco/falco", "kyverno/kyverno", "kyverno/kyverno", "trivy/trivy"}))
+
+		rec = serve(handler, http.MethodGet, inTeam+"/deployment.apps:a", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+		rec = serve(handler, http.MethodGet, inTeam+"/deployment.apps:b", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should list and select the reports of resources", func() {
+		Expect(list(reports, nil)).To(Equal([]string{"team/1234", "team/pod:b"}))
+		Expect(list(inTeam, nil)).To(Equal([]string{"team/1234", "team/pod:b"}))
+		Expect(list(clusterReports, nil)).To(Equal([]string{"/node:n"}))
+		Expect(list(reports, url.Values{"fieldSelector": {"resource.uid=1234"}})).To(Equal([]string{"team/1234"}))
+		Expect(list(reports, url.Values{"fieldSelector": {"resource.kind=Pod"}})).To(Equal([]string{"team/pod:b"}))
+		Expect(list(reports, url.Values{"fieldSelector": {"resource.kind!=Pod"}})).To(Equal([]string{"team/1234"}))
+		Expect(list(reports, url.Values{"limit": {"2"}})).To(HaveLen(2))
+
+		rec := serve(handler, http.MethodGet, reports+"?fieldSelector=policy%3Da", "")
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should follow the changes of the reports", func() {
+		rec := serve(handler, http.MethodDelete, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/policyreports/trivy", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		Eventually(func() []string {
+			return list(inTeam, nil)
+		}).Should(Equal([]string{"team/1234"}))
+	})
+
+	It("should get the reports of cluster-scoped resources", func() {
+		rec := serve(handler, http.MethodGet, clusterReports+"/node:n", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		var report views.ClusterResourceReport
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		Expect(report.Kind).To(Equal("ClusterResourceReport"))
+		Expect(report.Resource.Kind).To(Equal("Node"))
+		Expect(report.Summary.Fail).To(Equal(1))
+
+		rec = serve(handler, http.MethodGet, clusterReports+"/pod:b", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should keep resources of other groups and recreated resources apart", func() {
+		rec := serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"recreated"},
+			"scope":{"apiVersion":"apps/v1","kind":"Deployment","name":"a","uid":"5678"},
+			"results":[{"policy":"require-labels","rule":"check-team","result":"pass","source":"kyverno"},
+			           {"policy":"crd","result":"fail","source":"kyverno","resources":[{"apiVersion":"example.com/v1","kind":"Deployment","name":"a"}]}]}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		Eventually(func() []string {
+			return list(inTeam, nil)
+		}).Should(Equal([]string{"team/1234", "team/5678", "team/deployment.example.com:a", "team/pod:b"}))
+
+		rec = serve(handler, http.MethodGet, inTeam+"/5678", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		var report views.ResourceReport
+		Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		var sources []string
+		for _, result := range report.Results {
+			sources = append(sources, result.Report.Name+"/"+result.Result.Policy)
+		}
+		Expect(sources).To(Equal([]string{"falco/shell", "recreated/require-labels", "recreated/crd", "trivy/CVE-1"}))
+	})
+})
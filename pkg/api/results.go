@@ -0,0 +1,488 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
+	"github.com/kyverno/policy-server/pkg/storage"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	apistorage "k8s.io/apiserver/pkg/storage"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var (
+	// ResultFields are the fields results can be selected by. The scope
+	// fields match the scope of the report and every resource of the result.
+	ResultFields = []string{
+		"metadata.name", "metadata.namespace", "report.kind", "report.name",
+		"policy", "rule", "result", "severity", "category", "source",
+		"scope.kind", "scope.namespace", "scope.name", "scope.uid",
+	}
+	// indexedResultFields are indexed, equality selectors on them only go
+	// through the matching results.
+	indexedResultFields = []string{"metadata.namespace", "policy", "rule", "result", "severity", "category", "source", "scope.kind", "scope.name", "scope.uid"}
+)
+
+// resultFieldLabelConversion accepts the fields results can be selected by.
+func resultFieldLabelConversion(label, value string) (string, string, error) {
+	if slices.Contains(ResultFields, label) {
+		return label, value, nil
+	}
+	return "", "", fmt.Errorf("field label not supported: %s", label)
+}
+
+// resultIndex holds the results of the reports, indexed by the fields they
+// are selected by. It is fed by the reflectors of the report stores, so it
+// reflects the writes of every replica.
+type resultIndex struct {
+	sync.RWMutex
+
+	rows map[string]*resultRow
+	// reports are the keys of the rows of each report, by storage key.
+	reports map[string]reportRows
+	// indexes are the keys of the rows by field and value.
+	indexes map[string]map[string]sets.Set[string]
+	// resources are the keys of the rows about each resource, by resource key.
+	resources map[string]sets.Set[string]
+	// identified are the keys of the resources with a known UID, by the key
+	// of the results about them which do not name it.
+	identified map[string]sets.Set[string]
+	revision   uint64
+}
+
+type reportRows struct {
+	kind string
+	keys []string
+}
+
+type resultRow struct {
+	result *views.PolicyResult
+	fields map[string][]string
+}
+
+func newResultIndex() *resultIndex {
+	return &resultIndex{
+		rows:       make(map[string]*resultRow),
+		reports:    make(map[string]reportRows),
+		indexes:    make(map[string]map[string]sets.Set[string]),
+		resources:  make(map[string]sets.Set[string]),
+		identified: make(map[string]sets.Set[string]),
+	}
+}
+
+// observer returns the observer feeding the index with the reports of kind.
+func (i *resultIndex) observer(kind string) storage.Observer {
+	return &resultObserver{index: i, kind: kind}
+}
+
+type resultObserver struct {
+	index *resultIndex
+	kind  string
+}
+
+func (o *resultObserver) Observe(eventType watch.EventType, key string, obj runtime.Object, _ int64) {
+	o.index.Lock()
+	defer o.index.Unlock()
+
+	o.index.remove(key)
+	if rv, err := strconv.ParseUint(resourceVersionOf(obj), 10, 64); err == nil && rv > o.index.revision {
+		o.index.revision = rv
+	}
+	if eventType == watch.Deleted {
+		return
+	}
+	var rows []*resultRow
+	switch report := obj.(type) {
+	case *v1alpha2.PolicyReport:
+		rows = resultRows("PolicyReport", &report.ObjectMeta, report.Scope, report.Results)
+	case *v1alpha2.ClusterPolicyReport:
+		rows = resultRows("ClusterPolicyReport", &report.ObjectMeta, report.Scope, report.Results)
+	}
+	o.index.add(key, o.kind, rows)
+}
+
+func (i *resultIndex) add(reportKey, kind string, rows []*resultRow) {
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		key := resultKey(row.result.Namespace, row.result.Name)
+		keys = append(keys, key)
+		i.rows[key] = row
+		for _, field := range indexedResultFields {
+			for _, value := range row.fields[field] {
+				values, ok := i.indexes[field]
+				if !ok {
+					values = make(map[string]sets.Set[string])
+					i.indexes[field] = values
+				}
+				if values[value] == nil {
+					values[value] = sets.New[string]()
+				}
+				values[value].Insert(key)
+			}
+		}
+		for _, resource := range resourceRefs(row.result) {
+			resourceKey := resourceKey(resource)
+			if i.resources[resourceKey] == nil {
+				i.resources[resourceKey] = sets.New[string]()
+			}
+			i.resources[resourceKey].Insert(key)
+			if len(resource.UID) > 0 {
+				anonymousKey := anonymousResourceKey(resource)
+				if i.identified[anonymousKey] == nil {
+					i.identified[anonymousKey] = sets.New[string]()
+				}
+				i.identified[anonymousKey].Insert(resourceKey)
+			}
+		}
+	}
+	i.reports[reportKey] = reportRows{kind: kind, keys: keys}
+}
+
+func (i *resultIndex) remove(reportKey string) {
+	for _, key := range i.reports[reportKey].keys {
+		row := i.rows[key]
+		delete(i.rows, key)
+		for _, field := range indexedResultFields {
+			for _, value := range row.fields[field] {
+				i.indexes[field][value].Delete(key)
+				if i.indexes[field][value].Len() == 0 {
+					delete(i.indexes[field], value)
+				}
+			}
+		}
+		for _, resource := range resourceRefs(row.result) {
+			resourceKey := resourceKey(resource)
+			i.resources[resourceKey].Delete(key)
+			if i.resources[resourceKey].Len() > 0 {
+				continue
+			}
+			delete(i.resources, resourceKey)
+			if len(resource.UID) > 0 {
+				anonymousKey := anonymousResourceKey(resource)
+				i.identified[anonymousKey].Delete(resourceKey)
+				if i.identified[anonymousKey].Len() == 0 {
+					delete(i.identified, anonymousKey)
+				}
+			}
+		}
+	}
+	delete(i.reports, reportKey)
+}
+
+// candidates returns the keys of the rows which may match the selection of
+// namespace and selector, from the smallest index matching one of its
+// equality requirements, or every key.
+func (i *resultIndex) candidates(namespace string, selector fields.Selector) sets.Set[string] {
+	var best sets.Set[string]
+	found := false
+	consider := func(field, value string) {
+		keys := i.indexes[field][value]
+		if !found || keys.Len() < best.Len() {
+			best, found = keys, true
+		}
+	}
+	if len(namespace) > 0 {
+		consider("metadata.namespace", namespace)
+	}
+	for _, requirement := range selector.Requirements() {
+		if (requirement.Operator == selection.Equals || requirement.Operator == selection.DoubleEquals) && slices.Contains(indexedResultFields, requirement.Field) {
+			consider(requirement.Field, requirement.Value)
+		}
+	}
+	if found {
+		return best
+	}
+	return sets.KeySet(i.rows)
+}
+
+// list returns copies of the rows of the cluster reports, or of the reports of
+// namespace or of every namespace if it is empty, matching options, in key
+// order after the continue key of options. It returns the continue token of
+// the next page if limit cut the list short.
+func (i *resultIndex) list(cluster bool, namespace string, options *metainternalversion.ListOptions) (*views.PolicyResultList, error) {
+	labelSelector, fieldSelector := labels.Everything(), fields.Everything()
+	var limit int64
+	var start string
+	if options != nil {
+		if options.LabelSelector != nil {
+			labelSelector = options.LabelSelector
+		}
+		if options.FieldSelector != nil {
+			fieldSelector = options.FieldSelector
+		}
+		limit = options.Limit
+		if len(options.Continue) > 0 {
+			key, _, err := apistorage.DecodeContinue(options.Continue, "/")
+			if err != nil {
+				return nil, errors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+			}
+			start = key
+		}
+	}
+
+	i.RLock()
+	defer i.RUnlock()
+
+	prefix := "/namespaces/"
+	switch {
+	case cluster:
+		prefix = "/cluster/"
+	case len(namespace) > 0:
+		prefix += namespace + "/"
+	}
+	keys := i.candidates(namespace, fieldSelector).UnsortedList()
+	sort.Strings(keys)
+	list := &views.PolicyResultList{Items: []views.PolicyResult{}}
+	list.ResourceVersion = fmt.Sprint(i.revision)
+	var last string
+	for _, key := range keys {
+		if key <= start || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		row := i.rows[key]
+		if !labelSelector.Matches(labels.Set(row.result.Labels)) || !matchFields(fieldSelector, row.fields) {
+			continue
+		}
+		if limit > 0 && int64(len(list.Items)) == limit {
+			token, err := apistorage.EncodeContinue(last, "/", int64(max(i.revision, 1)))
+			if err != nil {
+				return nil, err
+			}
+			list.Continue = token
+			break
+		}
+		list.Items = append(list.Items, *row.result.DeepCopy())
+		last = key
+	}
+	return list, nil
+}
+
+func (i *resultIndex) get(namespace, name string) (*views.PolicyResult, bool) {
+	i.RLock()
+	defer i.RUnlock()
+
+	row, ok := i.rows[resultKey(namespace, name)]
+	if !ok {
+		return nil, false
+	}
+	return row.result.DeepCopy(), true
+}
+
+// matchFields reports whether the fields of a row, which may have several
+// values, match selector. Equality requires one of the values to match,
+// inequality all of them to differ.
+func matchFields(selector fields.Selector, values map[string][]string) bool {
+	for _, requirement := range selector.Requirements() {
+		found := slices.Contains(values[requirement.Field], requirement.Value)
+		switch requirement.Operator {
+		case selection.Equals, selection.DoubleEquals:
+			if !found {
+				return false
+			}
+		case selection.NotEquals:
+			if found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// resultKey orders the results by namespace, report and position, the results
+// of cluster reports come first.
+func resultKey(namespace, name string) string {
+	report, index := name, -1
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		if n, err := strconv.Atoi(name[i+1:]); err == nil {
+			report, index = name[:i], n
+		}
+	}
+	if len(namespace) == 0 {
+		return fmt.Sprintf("/cluster/%s/%08d", report, index)
+	}
+	return fmt.Sprintf("/namespaces/%s/%s/%08d", namespace, report, index)
+}
+
+// resultRows returns the rows of the results of a report of kind.
+func resultRows(kind string, report *metav1.ObjectMeta, scope *corev1.ObjectReference, results []*v1alpha2.PolicyReportResult) []*resultRow {
+	rows := make([]*resultRow, 0, len(results))
+	for n, result := range results {
+		if result == nil {
+			continue
+		}
+		row := &views.PolicyResult{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              fmt.Sprintf("%s.%d", report.Name, n),
+				Namespace:         report.Namespace,
+				ResourceVersion:   report.ResourceVersion,
+				CreationTimestamp: report.CreationTimestamp,
+				Labels:            report.Labels,
+			},
+			Report: corev1.ObjectReference{
+				APIVersion:      v1alpha2.SchemeGroupVersion.String(),
+				Kind:            kind,
+				Namespace:       report.Namespace,
+				Name:            report.Name,
+				UID:             report.UID,
+				ResourceVersion: report.ResourceVersion,
+			},
+			Scope:  scope,
+			Result: *result,
+		}
+		rows = append(rows, &resultRow{result: row, fields: resultFields(row)})
+	}
+	return rows
+}
+
+func resultFields(row *views.PolicyResult) map[string][]string {
+	values := map[string][]string{
+		"metadata.name":      {row.Name},
+		"metadata.namespace": {row.Namespace},
+		"report.kind":        {row.Report.Kind},
+		"report.name":        {row.Report.Name},
+		"policy":             {row.Result.Policy},
+		"rule":               {row.Result.Rule},
+		"result":             {string(row.Result.Result)},
+		"severity":           {string(row.Result.Severity)},
+		"category":           {row.Result.Category},
+		"source":             {row.Result.Source},
+	}
+	for _, resource := range resourceRefs(row) {
+		values["scope.kind"] = append(values["scope.kind"], resource.Kind)
+		values["scope.namespace"] = append(values["scope.namespace"], resource.Namespace)
+		values["scope.name"] = append(values["scope.name"], resource.Name)
+		if len(resource.UID) > 0 {
+			values["scope.uid"] = append(values["scope.uid"], string(resource.UID))
+		}
+	}
+	return values
+}
+
+func resourceVersionOf(obj runtime.Object) string {
+	switch report := obj.(type) {
+	case *v1alpha2.PolicyReport:
+		return report.ResourceVersion
+	case *v1alpha2.ClusterPolicyReport:
+		return report.ResourceVersion
+	}
+	return ""
+}
+
+// resultStore serves the results of every report from a resultIndex, as the
+// read-only policyresults resource for policy reports and clusterpolicyresults
+// for cluster policy reports.
+type resultStore struct {
+	index      *resultIndex
+	namespaced bool
+}
+
+func (r *resultStore) New() runtime.Object {
+	if r.namespaced {
+		return &views.PolicyResult{}
+	}
+	return &views.ClusterPolicyResult{}
+}
+
+func (r *resultStore) Destroy() {}
+
+func (r *resultStore) Kind() string {
+	if r.namespaced {
+		return "PolicyResult"
+	}
+	return "ClusterPolicyResult"
+}
+
+func (r *resultStore) NewList() runtime.Object {
+	if r.namespaced {
+		return &views.PolicyResultList{}
+	}
+	return &views.ClusterPolicyResultList{}
+}
+
+func (r *resultStore) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	list, err := r.index.list(!r.namespaced, genericapirequest.NamespaceValue(ctx), options)
+	if err != nil || r.namespaced {
+		return list, err
+	}
+	clusterList := &views.ClusterPolicyResultList{ListMeta: list.ListMeta, Items: make([]views.ClusterPolicyResult, 0, len(list.Items))}
+	for _, result := range list.Items {
+		clusterList.Items = append(clusterList.Items, views.ClusterPolicyResult(result))
+	}
+	return clusterList, nil
+}
+
+func (r *resultStore) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	result, ok := r.index.get(genericapirequest.NamespaceValue(ctx), name)
+	if !ok {
+		return nil, errors.NewNotFound(v1alpha2.Resource(strings.ToLower(r.Kind())+"s"), name)
+	}
+	if !r.namespaced {
+		clusterResult := views.ClusterPolicyResult(*result)
+		return &clusterResult, nil
+	}
+	return result, nil
+}
+
+func (r *resultStore) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	var table metav1.Table
+	switch t := object.(type) {
+	case *views.PolicyResult:
+		table.ResourceVersion = t.ResourceVersion
+		addPolicyResultToTable(&table, tableOptions, *t)
+	case *views.PolicyResultList:
+		table.ResourceVersion = t.ResourceVersion
+		table.Continue = t.Continue
+		addPolicyResultToTable(&table, tableOptions, t.Items...)
+	case *views.ClusterPolicyResult:
+		table.ResourceVersion = t.ResourceVersion
+		addPolicyResultToTable(&table, tableOptions, views.PolicyResult(*t))
+	case *views.ClusterPolicyResultList:
+		table.ResourceVersion = t.ResourceVersion
+		table.Continue = t.Continue
+		results := make([]views.PolicyResult, 0, len(t.Items))
+		for _, result := range t.Items {
+			results = append(results, views.PolicyResult(result))
+		}
+		addPolicyResultToTable(&table, tableOptions, results...)
+	}
+	return &table, nil
+}
+
+func (r *resultStore) NamespaceScoped() bool {
+	return r.namespaced
+}
+
+func (r *resultStore) GetSingularName() string {
+	return strings.ToLower(r.Kind())
+}
+
+func (r *resultStore) ShortNames() []string {
+	if r.namespaced {
+		return []string{"polres"}
+	}
+	return []string{"cpolres"}
+}
+
+var _ rest.Getter = &resultStore{}
+var _ rest.Lister = &resultStore{}
+var _ rest.KindProvider = &resultStore{}
+var _ rest.Scoper = &resultStore{}
+var _ rest.SingularNameProvider = &resultStore{}
+var _ rest.ShortNamesProvider = &resultStore{}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("Policy results", func() {
+	const (
+		results        = "/apis/wgpolicyk8s.io/v1alpha2/policyresults"
+		inTeam         = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/policyresults"
+		clusterResults = "/apis/wgpolicyk8s.io/v1alpha2/clusterpolicyresults"
+	)
+
+	var handler http.Handler
+	BeforeEach(func() {
+		handler = newTestServer(inmemory.New(), Options{})
+		for _, report := range []struct{ path, body string }{
+			{"/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"deploy","labels":{"app":"a"}},
+				"scope":{"apiVersion":"apps/v1","kind":"Deployment","name":"a"},
+				"results":[{"policy":"require-labels","rule":"check-team","result":"fail","severity":"high","source":"kyverno"},
+				           {"policy":"require-labels","rule":"check-owner","result":"pass","source":"kyverno"},
+				           {"policy":"CVE-1","result":"fail","severity":"high","source":"trivy"}]}`},
+			{"/apis/wgpolicyk8s.io/v1alpha2/namespaces/other/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"pods"},
+				"results":[{"policy":"require-labels","rule":"check-team","result":"fail","source":"kyverno","resources":[{"kind":"Pod","name":"b"},{"kind":"Pod","name":"c"}]}]}`},
+			{"/apis/wgpolicyk8s.io/v1alpha2/clusterpolicyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"ClusterPolicyReport","metadata":{"name":"nodes"},
+				"scope":{"apiVersion":"v1","kind":"Node","name":"n"},
+				"results":[{"policy":"node-check","result":"warn","severity":"low","source":"kyverno"}]}`},
+		} {
+			rec := serve(handler, http.MethodPost, report.path, report.body)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		}
+	})
+
+	list := func(path string, query url.Values) *views.PolicyResultList {
+		rec := serve(handler, http.MethodGet, path+"?"+query.Encode(), "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		var list views.PolicyResultList
+		Expect(json.Unmarshal(rec.Body.Bytes(), &list)).To(Succeed())
+		return &list
+	}
+	names := func(list *views.PolicyResultList) []string {
+		var names []string
+		for _, item := range list.Items {
+			names = append(names, item.Namespace+"/"+item.Name)
+		}
+		return names
+	}
+	selecting := func(selector string) url.Values {
+		return url.Values{"fieldSelector": {selector}}
+	}
+
+	It("should list the results of every report with their report", func() {
+		all := list(results, nil)
+		Expect(names(all)).To(Equal([]string{"other/pods.0", "team/deploy.0", "team/deploy.1", "team/deploy.2"}))
+		Expect(all.Items[1].Report.Kind).To(Equal("PolicyReport"))
+		Expect(all.Items[1].Report.Name).To(Equal("deploy"))
+		Expect(all.Items[1].Scope.Kind).To(Equal("Deployment"))
+		Expect(all.Items[1].Result.Rule).To(Equal("check-team"))
+		Expect(all.Items[1].Labels).To(HaveKeyWithValue("app", "a"))
+
+		Expect(names(list(inTeam, nil))).To(Equal([]string{"team/deploy.0", "team/deploy.1", "team/deploy.2"}))
+		Expect(names(list(clusterResults, nil))).To(Equal([]string{"/nodes.0"}))
+	})
+
+	It("should select results by field", func() {
+		Expect(names(list(results, selecting("policy=require-labels,rule=check-team,result=fail")))).To(Equal([]string{"other/pods.0", "team/deploy.0"}))
+		Expect(names(list(results, selecting("severity=high")))).To(Equal([]string{"team/deploy.0", "team/deploy.2"}))
+		Expect(names(list(results, selecting("source!=kyverno")))).To(Equal([]string{"team/deploy.2"}))
+		Expect(names(list(results, selecting("scope.kind=Node")))).To(BeEmpty())
+		Expect(names(list(clusterResults, selecting("scope.kind=Node")))).To(Equal([]string{"/nodes.0"}))
+		// the resources of a result are matched one by one
+		Expect(names(list(results, selecting("scope.kind=Pod,scope.name=c")))).To(Equal([]string{"other/pods.0"}))
+		Expect(names(list(results, selecting("scope.namespace=team,report.kind=PolicyReport")))).To(HaveLen(3))
+		Expect(names(list(inTeam, selecting("policy=require-labels")))).To(Equal([]string{"team/deploy.0", "team/deploy.1"}))
+		Expect(names(list(results, url.Values{"labelSelector": {"app=a"}}))).To(HaveLen(3))
+
+		rec := serve(handler, http.MethodGet, results+"?fieldSelector=bogus%3D1", "")
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should paginate results", func() {
+		var pages [][]string
+		query := url.Values{"limit": {"2"}}
+		for {
+			page := list(results, query)
+			pages = append(pages, names(page))
+			if len(page.Continue) == 0 {
+				break
+			}
+			query.Set("continue", page.Continue)
+		}
+		Expect(pages).To(Equal([][]string{{"other/pods.0", "team/deploy.0"}, {"team/deploy.1", "team/deploy.2"}}))
+
+		rec := serve(handler, http.MethodGet, results+"?limit=1&continue=bogus", "")
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should follow the changes of the reports", func() {
+		rec := serve(handler, http.MethodGet, inTeam+"/deploy.2", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+
+		rec = serve(handler, http.MethodPut, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/team/policyreports/deploy", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"deploy"},
+			"results":[{"policy":"require-labels","rule":"check-team","result":"pass","source":"kyverno"}]}`)
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		Expect(names(list(results, selecting("policy=require-labels,result=fail")))).To(Equal([]string{"other/pods.0"}))
+		rec = serve(handler, http.MethodGet, inTeam+"/deploy.2", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+
+		rec = serve(handler, http.MethodDelete, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/other/policyreports/pods", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		// deletions are not waited for
+		Eventually(func() []string {
+			return names(list(results, selecting("policy=require-labels")))
+		}).Should(Equal([]string{"team/deploy.0"}))
+	})
+
+	It("should print one row per result", func() {
+		store := &resultStore{}
+		table, err := store.ConvertToTable(context.Background(), list(results, nil), &metav1.TableOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(table.ColumnDefinitions).To(Equal(resultColumns))
+		Expect(table.Rows).To(HaveLen(4))
+		Expect(table.Rows[0].Cells[:8]).To(Equal([]interface{}{"pods.0", "pods", "require-labels", "check-team", "fail", "", "Pod/b,Pod/c", ""}))
+		Expect(table.Rows[1].Cells[:8]).To(Equal([]interface{}{"deploy.0", "deploy", "require-labels", "check-team", "fail", "high", "Deployment/a", ""}))
+		Expect(table.Rows[1].Cells[8:10]).To(Equal([]interface{}{"kyverno", ""}))
+		Expect(table.Rows[1].Object.Object).To(BeAssignableToTypeOf(&views.PolicyResult{}))
+	})
+
+	It("should get the results of cluster reports", func() {
+		rec := serve(handler, http.MethodGet, clusterResults+"/nodes.0", "")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		var result views.ClusterPolicyResult
+		Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+		Expect(result.Kind).To(Equal("ClusterPolicyResult"))
+		Expect(result.Report.Kind).To(Equal("ClusterPolicyReport"))
+		Expect(result.Result.Policy).To(Equal("node-check"))
+
+		rec = serve(handler, http.MethodGet, clusterResults+"/deploy.0", "")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should be read-only", func() {
+		for _, method := range []string{http.MethodPost, http.MethodDelete} {
+			rec := serve(handler, method, fmt.Sprintf("%s/deploy.0", inTeam), "{}")
+			Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed), method)
+		}
+	})
+})
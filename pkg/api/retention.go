@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// LastUpdatedAnnotation is set by the server to the time a report was last
+	// created or updated, it is the reference point of its retention.
+	LastUpdatedAnnotation = "policy-server.io/last-updated"
+	// TTLAnnotation overrides the retention TTL of a report, as a duration
+	// such as "72h". A TTL of 0 keeps the report forever.
+	TTLAnnotation = "policy-server.io/ttl"
+)
+
+// Retention configures the expiry of the reports which were not updated for
+// longer than their TTL.
+type Retention struct {
+	// TTL is the default time to live of a report after its last update, 0
+	// keeps reports without a TTL annotation forever.
+	TTL time.Duration
+	// Interval is the period at which reports are checked for expiry, 0
+	// disables retention.
+	Interval time.Duration
+}
+
+// touch records now as the last update of obj.
+func touch(obj runtime.Object, now time.Time) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	annotations := make(map[string]string, len(accessor.GetAnnotations())+1)
+	for k, v := range accessor.GetAnnotations() {
+		annotations[k] = v
+	}
+	annotations[LastUpdatedAnnotation] = now.UTC().Format(time.RFC3339)
+	accessor.SetAnnotations(annotations)
+}
+
+// RetentionTask returns a loop deleting the expired reports of stores until
+// ctx is done. Reports are deleted through the stores, so that watchers see
+// the deletions.
+func RetentionTask(retention Retention, stores ...API) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for _, store := range stores {
+				if err := expire(ctx, store, retention.TTL, time.Now()); err != nil {
+					klog.ErrorS(err, "failed to expire reports", "kind", store.Kind())
+				}
+			}
+		}, retention.Interval)
+	}
+}
+
+// expire deletes the reports of store which expired at now.
+func expire(ctx context.Context, store API, ttl time.Duration, now time.Time) error {
+	list, err := store.List(genericapirequest.WithNamespace(ctx, metav1.NamespaceAll), &metainternalversion.ListOptions{})
+	if err != nil {
+		return err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		if !expired(accessor, ttl, now) {
+			continue
+		}
+		// the preconditions keep reports updated since they were listed
+		options := &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{
+			UID:             ptr.To(accessor.GetUID()),
+			ResourceVersion: ptr.To(accessor.GetResourceVersion()),
+		}}
+		_, _, err = store.Delete(genericapirequest.WithNamespace(ctx, accessor.GetNamespace()), accessor.GetName(), rest.ValidateAllObjectFunc, options)
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			klog.ErrorS(err, "failed to delete expired report", "kind", store.Kind(), "report", klog.KObj(accessor))
+			continue
+		}
+		if err == nil {
+			klog.V(2).InfoS("Deleted expired report", "kind", store.Kind(), "report", klog.KObj(accessor))
+		}
+	}
+	return nil
+}
+
+// expired reports whether the report has outlived its TTL at now. Reports
+// without a last update, such as imported ones, are aged from their creation.
+func expired(report metav1.Object, ttl time.Duration, now time.Time) bool {
+	annotations := report.GetAnnotations()
+	if value, ok := annotations[TTLAnnotation]; ok {
+		override, err := time.ParseDuration(value)
+		if err != nil {
+			klog.ErrorS(err, "ignoring invalid ttl annotation", "report", klog.KObj(report), "ttl", value)
+		} else {
+			ttl = override
+		}
+	}
+	if ttl <= 0 {
+		return false
+	}
+
+	lastUpdated := report.GetCreationTimestamp().Time
+	if value, ok := annotations[LastUpdatedAnnotation]; ok {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			lastUpdated = t
+		}
+	}
+	return now.Sub(lastUpdated) > ttl
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Retention", func() {
+	var (
+		ctx   context.Context
+		store API
+	)
+	BeforeEach(func() {
+		ctx = genericapirequest.WithNamespace(context.Background(), "default")
+		var err error
+		store, err = PolicyReportStore(inmemory.New(), storage.NewUsage("policyreports"), Quota{}, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(store.Destroy)
+	})
+
+	create := func(name, ttl string) {
+		report := &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		if len(ttl) > 0 {
+			report.Annotations = map[string]string{TTLAnnotation: ttl}
+		}
+		_, err := store.Create(ctx, report, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("should stamp the last update of reports", func() {
+		create("a", "")
+		obj, err := store.Get(ctx, "a", &metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.(*v1alpha2.PolicyReport).Annotations).To(HaveKey(LastUpdatedAnnotation))
+	})
+
+	It("should delete the reports which outlived their ttl", func() {
+		create("expired", "")
+		create("kept", "0")
+		create("longer", "3h")
+
+		list, err := store.List(ctx, &metainternalversion.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		watcher, err := store.Watch(ctx, &metainternalversion.ListOptions{ResourceVersion: list.(*v1alpha2.PolicyReportList).ResourceVersion})
+		Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+
+		Expect(expire(ctx, store, time.Hour, time.Now().Add(2*time.Hour))).To(Succeed())
+
+		event := <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Deleted))
+		Expect(event.Object.(*v1alpha2.PolicyReport).Name).To(Equal("expired"))
+
+		Eventually(func() []string {
+			list, err := store.List(ctx, &metainternalversion.ListOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, report := range list.(*v1alpha2.PolicyReportList).Items {
+				names = append(names, report.Name)
+			}
+			return names
+		}).Should(ConsistOf("kept", "longer"))
+	})
+
+	It("should age reports without a last update from their creation", func() {
+		created := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+		report := &metav1.ObjectMeta{CreationTimestamp: created}
+		Expect(expired(report, time.Hour, time.Now())).To(BeTrue())
+		report.Annotations = map[string]string{LastUpdatedAnnotation: time.Now().UTC().Format(time.RFC3339)}
+		Expect(expired(report, time.Hour, time.Now())).To(BeFalse())
+		report.Annotations[TTLAnnotation] = "invalid"
+		Expect(expired(report, time.Hour, time.Now().Add(2*time.Hour))).To(BeTrue())
+	})
+})
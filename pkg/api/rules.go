@@ -0,0 +1,160 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/version"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/cel/environment"
+	"k8s.io/apiserver/pkg/cel/library"
+	"sigs.k8s.io/yaml"
+)
+
+// Rule is a CEL expression every report it applies to must satisfy. The
+// expression sees the report as object, and on updates its previous version
+// as oldObject, which is null on creates.
+type Rule struct {
+	// Name identifies the rule in errors.
+	Name string `json:"name,omitempty"`
+	// Kinds are the kinds of reports the rule applies to, PolicyReport and
+	// ClusterPolicyReport, all of them when empty.
+	Kinds []string `json:"kinds,omitempty"`
+	// Expression must evaluate to true for a report to be valid.
+	Expression string `json:"expression"`
+	// Message is the error returned when the expression is false.
+	Message string `json:"message,omitempty"`
+	// FieldPath is the dotted path of the field the error is reported on,
+	// such as "results", the report itself when empty.
+	FieldPath string `json:"fieldPath,omitempty"`
+}
+
+// RulesFile is the content of a file of rules.
+type RulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rules are compiled rules, the nil Rules accept every report.
+type Rules struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	program cel.Program
+	path    *field.Path
+}
+
+// LoadRules reads and compiles the rules of the YAML or JSON file at path.
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	var file RulesFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules %s: %w", path, err)
+	}
+	return CompileRules(file.Rules)
+}
+
+// CompileRules compiles rules with the CEL libraries of Kubernetes. Rules are
+// configuration, they are compiled with every library stored expressions may use.
+func CompileRules(rules []Rule) (*Rules, error) {
+	envSet, err := environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion()).Extend(environment.VersionedOptions{
+		IntroducedVersion: version.MajorMinor(1, 0),
+		EnvOptions: []cel.EnvOption{
+			cel.Variable("object", cel.DynType),
+			cel.Variable("oldObject", cel.DynType),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	env, err := envSet.Env(environment.StoredExpressions)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, rule := range rules {
+		name := rule.Name
+		if len(name) == 0 {
+			name = fmt.Sprintf("rules[%d]", i)
+		}
+		for _, kind := range rule.Kinds {
+			if kind != "PolicyReport" && kind != "ClusterPolicyReport" {
+				return nil, fmt.Errorf("rule %s: unsupported kind %q", name, kind)
+			}
+		}
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("rule %s: expression must evaluate to a bool, not %v", name, ast.OutputType())
+		}
+		program, err := env.Program(ast, cel.CostTracking(&library.CostEstimator{}), cel.CostLimit(celconfig.PerCallLimit))
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		var path *field.Path
+		if len(rule.FieldPath) > 0 {
+			segments := strings.Split(rule.FieldPath, ".")
+			path = field.NewPath(segments[0], segments[1:]...)
+		}
+		rule.Name = name
+		compiled = append(compiled, compiledRule{Rule: rule, program: program, path: path})
+	}
+	return &Rules{rules: compiled}, nil
+}
+
+// Validate returns the errors of the rules of kind which report, updated from
+// old unless it is nil, does not satisfy.
+func (r *Rules) Validate(kind string, report, old runtime.Object) field.ErrorList {
+	if r == nil || len(r.rules) == 0 {
+		return nil
+	}
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(report)
+	if err != nil {
+		return field.ErrorList{field.InternalError(nil, err)}
+	}
+	activation := map[string]interface{}{"object": object, "oldObject": nil}
+	if old != nil {
+		oldObject, err := runtime.DefaultUnstructuredConverter.ToUnstructured(old)
+		if err != nil {
+			return field.ErrorList{field.InternalError(nil, err)}
+		}
+		activation["oldObject"] = oldObject
+	}
+
+	var allErrs field.ErrorList
+	for _, rule := range r.rules {
+		if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, kind) {
+			continue
+		}
+		val, _, err := rule.program.Eval(activation)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(rule.path, field.OmitValueType{}, fmt.Sprintf("rule %s evaluation error: %v", rule.Name, err)))
+			continue
+		}
+		if valid, ok := val.Value().(bool); !ok {
+			allErrs = append(allErrs, field.Invalid(rule.path, field.OmitValueType{}, fmt.Sprintf("rule %s evaluated to %v, not a bool", rule.Name, val)))
+		} else if !valid {
+			allErrs = append(allErrs, field.Invalid(rule.path, field.OmitValueType{}, rule.message()))
+		}
+	}
+	return allErrs
+}
+
+func (r compiledRule) message() string {
+	if len(r.Message) > 0 {
+		return r.Message
+	}
+	return fmt.Sprintf("failed rule %s: %s", r.Name, r.Expression)
+}
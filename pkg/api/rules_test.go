@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Rules", func() {
+	const file = `
+rules:
+- name: message-size
+  expression: "!has(object.results) || object.results.all(r, !has(r.message) || size(r.message) < 16)"
+  message: result messages must be under 16 bytes
+  fieldPath: results
+- name: source
+  kinds: [PolicyReport]
+  expression: "!has(object.results) || object.results.all(r, has(r.source) && r.source in ['kyverno'])"
+- name: immutable-labels
+  expression: "oldObject == null || !has(oldObject.metadata.labels) || object.metadata.labels == oldObject.metadata.labels"
+  fieldPath: metadata.labels
+`
+	var rules *Rules
+	BeforeEach(func() {
+		path := filepath.Join(GinkgoT().TempDir(), "rules.yaml")
+		Expect(os.WriteFile(path, []byte(file), 0o600)).To(Succeed())
+		var err error
+		rules, err = LoadRules(path)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	report := func(message, source string) *v1alpha2.PolicyReport {
+		return &v1alpha2.PolicyReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"},
+			Results:    []*v1alpha2.PolicyReportResult{{Policy: "p", Result: "pass", Description: message, Source: source}},
+		}
+	}
+
+	It("should accept reports satisfying the rules", func() {
+		Expect(rules.Validate("PolicyReport", report("short", "kyverno"), nil)).To(BeEmpty())
+		Expect(rules.Validate("PolicyReport", &v1alpha2.PolicyReport{}, nil)).To(BeEmpty())
+		Expect((*Rules)(nil).Validate("PolicyReport", report("a long result message", ""), nil)).To(BeEmpty())
+	})
+
+	It("should reject reports failing rules with field paths", func() {
+		errs := rules.Validate("PolicyReport", report("a long result message", "other"), nil)
+		Expect(errs).To(HaveLen(2))
+		Expect(errs[0].Field).To(Equal("results"))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[0].Error()).To(Equal("results: Invalid value: result messages must be under 16 bytes"))
+		Expect(errs[1].Detail).To(ContainSubstring("failed rule source"))
+	})
+
+	It("should only apply rules to their kinds", func() {
+		cluster := &v1alpha2.ClusterPolicyReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "a"},
+			Results:    []*v1alpha2.PolicyReportResult{{Policy: "p", Result: "pass", Source: "other"}},
+		}
+		Expect(rules.Validate("ClusterPolicyReport", cluster, nil)).To(BeEmpty())
+	})
+
+	It("should expose the previous version on updates", func() {
+		old := report("", "kyverno")
+		old.Labels = map[string]string{"a": "b"}
+		updated := old.DeepCopy()
+		Expect(rules.Validate("PolicyReport", updated, old)).To(BeEmpty())
+		updated.Labels = map[string]string{"a": "c"}
+		errs := rules.Validate("PolicyReport", updated, old)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Field).To(Equal("metadata.labels"))
+	})
+
+	It("should reject invalid rules", func() {
+		_, err := CompileRules([]Rule{{Expression: "object.("}})
+		Expect(err).To(MatchError(ContainSubstring("rule rules[0]")))
+		_, err = CompileRules([]Rule{{Name: "string", Expression: "'a'"}})
+		Expect(err).To(MatchError(ContainSubstring("must evaluate to a bool")))
+		_, err = CompileRules([]Rule{{Name: "kind", Kinds: []string{"Pod"}, Expression: "true"}})
+		Expect(err).To(MatchError(ContainSubstring(`unsupported kind "Pod"`)))
+	})
+
+	It("should fail creates and updates of the stores", func() {
+		for _, generic := range []bool{false, true} {
+			handler := newTestServer(inmemory.New(), Options{GenericRegistry: generic, Rules: rules})
+			const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+			rec := serve(handler, http.MethodPost, reports, `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a"},"results":[{"policy":"p","result":"pass","source":"other"}]}`)
+			Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity), rec.Body.String())
+			Expect(rec.Body.String()).To(ContainSubstring("failed rule source"))
+
+			rec = serve(handler, http.MethodPost, reports, `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a","labels":{"a":"b"}}}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+			rec = serve(handler, http.MethodPut, reports+"/a", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a","labels":{"a":"c"}}}`)
+			Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity), rec.Body.String())
+			Expect(rec.Body.String()).To(ContainSubstring("metadata.labels"))
+		}
+	})
+})
@@ -0,0 +1,463 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
+	"github.com/kyverno/policy-server/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+const (
+	// clusterSummaryName is the name of the single cluster summary.
+	clusterSummaryName = "cluster"
+	// policySummaryHashLength is the number of hexadecimal digits of the hash
+	// ending the names of policy summaries.
+	policySummaryHashLength = 10
+)
+
+// summaryIndex totals the results of the reports per namespace and for the
+// whole cluster, and per policy, rule and namespace. It is fed by
+// the reflectors of the report stores, and records every change of a total in
+// the watch caches the totals are served from.
+//
+// Totals are versioned by the backend revision of the latest report change
+// observed, so that their resource versions compare with those of the reports.
+type summaryIndex struct {
+	sync.Mutex
+
+	reports    map[string]reportSummary
+	namespaces map[string]*views.NamespacePolicySummary
+	cluster    *views.ClusterPolicySummary
+	// policies total the results by policy, rule and namespace.
+	policies map[string]map[string]map[string]v1alpha2.PolicyReportSummary
+	// published are the policies with a summary in the watch cache.
+	published sets.Set[string]
+	// revision is the latest backend revision of the reports observed.
+	revision uint64
+
+	namespaceCache *storage.WatchCache
+	clusterCache   *storage.WatchCache
+	policyCache    *storage.WatchCache
+}
+
+type reportSummary struct {
+	kind      string
+	namespace string
+	summary   v1alpha2.PolicyReportSummary
+	// rules are the totals of the results of the report by policy and rule.
+	rules map[ruleKey]v1alpha2.PolicyReportSummary
+}
+
+type ruleKey struct {
+	policy string
+	rule   string
+}
+
+func newSummaryIndex() *summaryIndex {
+	i := &summaryIndex{
+		reports:        make(map[string]reportSummary),
+		namespaces:     make(map[string]*views.NamespacePolicySummary),
+		policies:       make(map[string]map[string]map[string]v1alpha2.PolicyReportSummary),
+		published:      sets.New[string](),
+		revision:       1,
+		namespaceCache: storage.NewWatchCache("namespacepolicysummaries", watchCacheCapacity),
+		clusterCache:   storage.NewWatchCache("clusterpolicysummaries", watchCacheCapacity),
+		policyCache:    storage.NewWatchCache("policysummaries", watchCacheCapacity),
+	}
+	i.cluster = &views.ClusterPolicySummary{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha2.SchemeGroupVersion.String(), Kind: "ClusterPolicySummary"},
+		ObjectMeta: metav1.ObjectMeta{Name: clusterSummaryName, ResourceVersion: "1"},
+	}
+	i.namespaceCache.Replace(map[string]runtime.Object{}, i.revision)
+	i.clusterCache.Replace(map[string]runtime.Object{clusterSummaryName: i.cluster.DeepCopy()}, i.revision)
+	i.policyCache.Replace(map[string]runtime.Object{}, i.revision)
+	return i
+}
+
+// observer returns the observer feeding the index with the reports of kind.
+func (i *summaryIndex) observer(kind string) storage.Observer {
+	return &summaryObserver{index: i, kind: kind}
+}
+
+type summaryObserver struct {
+	index *summaryIndex
+	kind  string
+}
+
+func (o *summaryObserver) Observe(eventType watch.EventType, key string, obj runtime.Object, _ int64) {
+	o.index.Lock()
+	defer o.index.Unlock()
+
+	// the diff of a relist carries the revisions of the reports listed,
+	// which may be older than those already observed
+	if rv, err := strconv.ParseUint(resourceVersionOf(obj), 10, 64); err == nil && rv > o.index.revision {
+		o.index.revision = rv
+	}
+	if eventType == watch.Deleted {
+		o.index.update(key, nil)
+		return
+	}
+	switch report := obj.(type) {
+	case *v1alpha2.PolicyReport:
+		o.index.update(key, summarizeReport(o.kind, report.Namespace, report.Results))
+	case *v1alpha2.ClusterPolicyReport:
+		o.index.update(key, summarizeReport(o.kind, "", report.Results))
+	}
+}
+
+// summarizeReport totals the results of a report by policy and rule, the totals
+// of the report being the sum of those of its rules so that both agree. The
+// summary the report carries is not used.
+func summarizeReport(kind, namespace string, results []*v1alpha2.PolicyReportResult) *reportSummary {
+	report := &reportSummary{kind: kind, namespace: namespace, rules: summarizeRules(results)}
+	for _, summary := range report.rules {
+		addSummary(&report.summary, summary, 1)
+	}
+	return report
+}
+
+// summarizeRules counts results by policy, rule and status.
+func summarizeRules(results []*v1alpha2.PolicyReportResult) map[ruleKey]v1alpha2.PolicyReportSummary {
+	rules := make(map[ruleKey]v1alpha2.PolicyReportSummary)
+	for _, result := range results {
+		if result == nil || len(result.Policy) == 0 {
+			continue
+		}
+		key := ruleKey{policy: result.Policy, rule: result.Rule}
+		summary := rules[key]
+		addSummary(&summary, summarize([]*v1alpha2.PolicyReportResult{result}), 1)
+		rules[key] = summary
+	}
+	return rules
+}
+
+// update replaces the summary of the report at key with next, or removes it
+// when next is nil, and publishes the totals it changes.
+func (i *summaryIndex) update(key string, next *reportSummary) {
+	prev, found := i.reports[key]
+	if !found && next == nil {
+		return
+	}
+	totalsChanged := !found || next == nil || prev.namespace != next.namespace || prev.summary != next.summary
+	rulesChanged := !found || next == nil || prev.namespace != next.namespace || !maps.Equal(prev.rules, next.rules)
+
+	policies := sets.New[string]()
+	if found {
+		delete(i.reports, key)
+		i.addReport(prev, -1, policies)
+	}
+	if next != nil {
+		i.reports[key] = *next
+		i.addReport(*next, 1, policies)
+	}
+
+	if totalsChanged {
+		if found && len(prev.namespace) > 0 {
+			i.publishNamespace(prev.namespace)
+		}
+		if next != nil && len(next.namespace) > 0 && (!found || next.namespace != prev.namespace) {
+			i.publishNamespace(next.namespace)
+		}
+		i.cluster.ResourceVersion = strconv.FormatUint(i.revision, 10)
+		i.clusterCache.Process(clusterSummaryName, watch.Event{Type: watch.Modified, Object: i.cluster}, i.revision)
+	}
+	if rulesChanged {
+		for _, policy := range sets.List(policies) {
+			i.publishPolicy(policy)
+		}
+	}
+}
+
+// addReport adds the totals of report to the totals of the index, or removes
+// them when sign is -1, and records the policies of its results.
+func (i *summaryIndex) addReport(report reportSummary, sign int, policies sets.Set[string]) {
+	i.cluster.Reports += int64(sign)
+	addSummary(&i.cluster.Summary, report.summary, sign)
+	if len(report.namespace) > 0 {
+		namespace, ok := i.namespaces[report.namespace]
+		if !ok {
+			namespace = &views.NamespacePolicySummary{
+				TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha2.SchemeGroupVersion.String(), Kind: "NamespacePolicySummary"},
+				ObjectMeta: metav1.ObjectMeta{Name: report.namespace, Namespace: report.namespace},
+			}
+			i.namespaces[report.namespace] = namespace
+		}
+		namespace.Reports += int64(sign)
+		addSummary(&namespace.Summary, report.summary, sign)
+	}
+
+	for key, summary := range report.rules {
+		policies.Insert(key.policy)
+		rules, ok := i.policies[key.policy]
+		if !ok {
+			rules = make(map[string]map[string]v1alpha2.PolicyReportSummary)
+			i.policies[key.policy] = rules
+		}
+		namespaces, ok := rules[key.rule]
+		if !ok {
+			namespaces = make(map[string]v1alpha2.PolicyReportSummary)
+			rules[key.rule] = namespaces
+		}
+		total := namespaces[report.namespace]
+		addSummary(&total, summary, sign)
+		namespaces[report.namespace] = total
+		if total == (v1alpha2.PolicyReportSummary{}) {
+			delete(namespaces, report.namespace)
+		}
+		if len(namespaces) == 0 {
+			delete(rules, key.rule)
+		}
+		if len(rules) == 0 {
+			delete(i.policies, key.policy)
+		}
+	}
+}
+
+// publishNamespace records the change of the total of namespace, which is
+// deleted once the namespace holds no more reports.
+func (i *summaryIndex) publishNamespace(name string) {
+	namespace := i.namespaces[name]
+	namespace.ResourceVersion = strconv.FormatUint(i.revision, 10)
+	eventType := watch.Modified
+	switch {
+	case namespace.Reports == 0:
+		eventType = watch.Deleted
+		delete(i.namespaces, name)
+	case namespace.CreationTimestamp.IsZero():
+		eventType = watch.Added
+		namespace.CreationTimestamp = metav1.Now()
+	}
+	i.namespaceCache.Process(name, watch.Event{Type: eventType, Object: namespace}, i.revision)
+}
+
+// publishPolicy records the change of the totals of policy, which are deleted
+// once no report holds results of the policy.
+func (i *summaryIndex) publishPolicy(policy string) {
+	name := policySummaryName(policy)
+	summary := &views.PolicySummary{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha2.SchemeGroupVersion.String(), Kind: "PolicySummary"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: strconv.FormatUint(i.revision, 10)},
+		Policy:     policy,
+	}
+	rules, ok := i.policies[policy]
+	if !ok {
+		i.published.Delete(policy)
+		i.policyCache.Process(name, watch.Event{Type: watch.Deleted, Object: summary}, i.revision)
+		return
+	}
+	for _, rule := range sets.List(sets.KeySet(rules)) {
+		ruleSummary := views.PolicyRuleSummary{Rule: rule}
+		for _, namespace := range sets.List(sets.KeySet(rules[rule])) {
+			total := rules[rule][namespace]
+			addSummary(&ruleSummary.Summary, total, 1)
+			ruleSummary.Namespaces = append(ruleSummary.Namespaces, views.PolicyNamespaceSummary{Namespace: namespace, Summary: total})
+		}
+		addSummary(&summary.Summary, ruleSummary.Summary, 1)
+		summary.Rules = append(summary.Rules, ruleSummary)
+	}
+	eventType := watch.Modified
+	if !i.published.Has(policy) {
+		eventType = watch.Added
+		i.published.Insert(policy)
+	}
+	i.policyCache.Process(name, watch.Event{Type: eventType, Object: summary}, i.revision)
+}
+
+// policySummaryName is the name of the summary of policy: the policy with the
+// characters not allowed in object names replaced, followed by a hash of the
+// policy so that policies replaced to the same name do not collide. The policy
+// itself is reported by the Policy field of the summary.
+func policySummaryName(policy string) string {
+	var name strings.Builder
+	separated := true
+	for _, r := range strings.ToLower(policy) {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9':
+			name.WriteRune(r)
+			separated = false
+		case !separated:
+			name.WriteByte('-')
+			separated = true
+		}
+	}
+	hash := sha256.Sum256([]byte(policy))
+	suffix := hex.EncodeToString(hash[:])[:policySummaryHashLength]
+	prefix := name.String()
+	if len(prefix) > validation.DNS1123SubdomainMaxLength-len(suffix)-1 {
+		prefix = prefix[:validation.DNS1123SubdomainMaxLength-len(suffix)-1]
+	}
+	prefix = strings.TrimSuffix(prefix, "-")
+	if len(prefix) == 0 {
+		return suffix
+	}
+	return prefix + "-" + suffix
+}
+
+func addSummary(total *v1alpha2.PolicyReportSummary, summary v1alpha2.PolicyReportSummary, sign int) {
+	total.Pass += sign * summary.Pass
+	total.Fail += sign * summary.Fail
+	total.Warn += sign * summary.Warn
+	total.Error += sign * summary.Error
+	total.Skip += sign * summary.Skip
+}
+
+// summaryStore serves the objects of a watch cache maintained by a
+// summaryIndex as a read-only resource.
+type summaryStore struct {
+	watchCache  *storage.WatchCache
+	resource    string
+	singular    string
+	kind        string
+	shortNames  []string
+	namespaced  bool
+	newFunc     func() runtime.Object
+	newListFunc func() runtime.Object
+	table       func(table *metav1.Table, objects ...runtime.Object)
+}
+
+// stores returns the stores of the namespace, cluster and policy summaries, by
+// resource.
+func (i *summaryIndex) stores() map[string]rest.Storage {
+	return map[string]rest.Storage{
+		"namespacepolicysummaries": &summaryStore{
+			watchCache:  i.namespaceCache,
+			resource:    "namespacepolicysummaries",
+			singular:    "namespacepolicysummary",
+			kind:        "NamespacePolicySummary",
+			shortNames:  []string{"nspsum"},
+			namespaced:  true,
+			newFunc:     func() runtime.Object { return &views.NamespacePolicySummary{} },
+			newListFunc: func() runtime.Object { return &views.NamespacePolicySummaryList{} },
+			table:       addNamespacePolicySummaryToTable,
+		},
+		"clusterpolicysummaries": &summaryStore{
+			watchCache:  i.clusterCache,
+			resource:    "clusterpolicysummaries",
+			singular:    "clusterpolicysummary",
+			kind:        "ClusterPolicySummary",
+			shortNames:  []string{"cpolsum"},
+			newFunc:     func() runtime.Object { return &views.ClusterPolicySummary{} },
+			newListFunc: func() runtime.Object { return &views.ClusterPolicySummaryList{} },
+			table:       addClusterPolicySummaryToTable,
+		},
+		"policysummaries": &summaryStore{
+			watchCache:  i.policyCache,
+			resource:    "policysummaries",
+			singular:    "policysummary",
+			kind:        "PolicySummary",
+			shortNames:  []string{"polsum"},
+			newFunc:     func() runtime.Object { return &views.PolicySummary{} },
+			newListFunc: func() runtime.Object { return &views.PolicySummaryList{} },
+			table:       addPolicySummaryToTable,
+		},
+	}
+}
+
+func (s *summaryStore) New() runtime.Object {
+	return s.newFunc()
+}
+
+func (s *summaryStore) Destroy() {}
+
+func (s *summaryStore) Kind() string {
+	return s.kind
+}
+
+func (s *summaryStore) NewList() runtime.Object {
+	return s.newListFunc()
+}
+
+func (s *summaryStore) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	// summaries are cached by name
+	objects, _, revision := s.watchCache.List(filterFor(genericapirequest.NamespaceValue(ctx), options), "", 0)
+	list := s.newListFunc()
+	if err := meta.SetList(list, objects); err != nil {
+		return nil, err
+	}
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return nil, err
+	}
+	listMeta.SetResourceVersion(strconv.FormatUint(revision, 10))
+	return list, nil
+}
+
+func (s *summaryStore) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	obj, ok := s.watchCache.Get(name)
+	if !ok {
+		return nil, errors.NewNotFound(v1alpha2.Resource(s.resource), name)
+	}
+	if objMeta, err := meta.Accessor(obj); err != nil || objMeta.GetNamespace() != genericapirequest.NamespaceValue(ctx) {
+		return nil, errors.NewNotFound(v1alpha2.Resource(s.resource), name)
+	}
+	return obj, nil
+}
+
+func (s *summaryStore) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	rev, err := revisionFor(options)
+	if err != nil {
+		return nil, err
+	}
+	return s.watchCache.Watch(ctx, rev, filterFor(genericapirequest.NamespaceValue(ctx), options))
+}
+
+func (s *summaryStore) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
+	var table metav1.Table
+	if meta.IsListType(object) {
+		listMeta, err := meta.ListAccessor(object)
+		if err != nil {
+			return nil, err
+		}
+		table.ResourceVersion = listMeta.GetResourceVersion()
+		objects, err := meta.ExtractList(object)
+		if err != nil {
+			return nil, err
+		}
+		s.table(&table, objects...)
+	} else {
+		objMeta, err := meta.Accessor(object)
+		if err != nil {
+			return nil, err
+		}
+		table.ResourceVersion = objMeta.GetResourceVersion()
+		s.table(&table, object)
+	}
+	return &table, nil
+}
+
+func (s *summaryStore) NamespaceScoped() bool {
+	return s.namespaced
+}
+
+func (s *summaryStore) GetSingularName() string {
+	return s.singular
+}
+
+func (s *summaryStore) ShortNames() []string {
+	return s.shortNames
+}
+
+var _ rest.Getter = &summaryStore{}
+var _ rest.Lister = &summaryStore{}
+var _ rest.Watcher = &summaryStore{}
+var _ rest.KindProvider = &summaryStore{}
+var _ rest.Scoper = &summaryStore{}
+var _ rest.SingularNameProvider = &summaryStore{}
+var _ rest.ShortNamesProvider = &summaryStore{}
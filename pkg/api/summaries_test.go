@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Policy summaries", func() {
+	var (
+		polr, cpolr API
+		summaries   map[string]rest.Storage
+	)
+	BeforeEach(func() {
+		index := newSummaryIndex()
+		backend := inmemory.New()
+		var err error
+		polr, err = PolicyReportStore(backend, storage.NewUsage("policyreports"), Quota{}, nil, false, index.observer("PolicyReport"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(polr.Destroy)
+		cpolr, err = ClusterPolicyReportStore(backend, storage.NewUsage("clusterpolicyreports"), Quota{}, nil, false, index.observer("ClusterPolicyReport"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(cpolr.Destroy)
+		summaries = index.stores()
+	})
+
+	results := func(statuses ...string) []*v1alpha2.PolicyReportResult {
+		var results []*v1alpha2.PolicyReportResult
+		for _, status := range statuses {
+			results = append(results, &v1alpha2.PolicyReportResult{Policy: "p", Result: v1alpha2.PolicyResult(status)})
+		}
+		return results
+	}
+	createPolr := func(namespace, name string, statuses ...string) {
+		ctx := genericapirequest.WithNamespace(context.Background(), namespace)
+		report := &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}, Results: results(statuses...)}
+		_, err := polr.Create(ctx, report, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+	namespaces := func(namespace string) []views.NamespacePolicySummary {
+		ctx := genericapirequest.WithNamespace(context.Background(), namespace)
+		list, err := summaries["namespacepolicysummaries"].(rest.Lister).List(ctx, &metainternalversion.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return list.(*views.NamespacePolicySummaryList).Items
+	}
+	cluster := func() *views.ClusterPolicySummary {
+		obj, err := summaries["clusterpolicysummaries"].(rest.Getter).Get(context.Background(), clusterSummaryName, &metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return obj.(*views.ClusterPolicySummary)
+	}
+
+	It("should total the reports per namespace and for the cluster", func() {
+		Expect(namespaces("")).To(BeEmpty())
+		Expect(cluster().Reports).To(BeZero())
+
+		createPolr("a", "one", "pass", "fail")
+		createPolr("a", "two", "fail", "warn")
+		createPolr("b", "one", "error", "skip")
+		_, err := cpolr.Create(context.Background(), &v1alpha2.ClusterPolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "one"}, Results: results("pass")}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		all := namespaces("")
+		Expect(all).To(HaveLen(2))
+		Expect(all[0].Name).To(Equal("a"))
+		Expect(all[0].Namespace).To(Equal("a"))
+		Expect(all[0].Reports).To(BeEquivalentTo(2))
+		Expect(all[0].Summary).To(Equal(v1alpha2.PolicyReportSummary{Pass: 1, Fail: 2, Warn: 1}))
+		Expect(namespaces("b")).To(HaveLen(1))
+		Expect(namespaces("b")[0].Summary).To(Equal(v1alpha2.PolicyReportSummary{Error: 1, Skip: 1}))
+
+		total := cluster()
+		Expect(total.Reports).To(BeEquivalentTo(4))
+		Expect(total.Summary).To(Equal(v1alpha2.PolicyReportSummary{Pass: 2, Fail: 2, Warn: 1, Error: 1, Skip: 1}))
+
+		_, err = summaries["namespacepolicysummaries"].(rest.Getter).Get(genericapirequest.WithNamespace(context.Background(), "c"), "c", &metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should send the changes of the totals to watchers", func() {
+		createPolr("a", "one", "pass")
+		ctx := genericapirequest.WithNamespace(context.Background(), "a")
+		list, err := summaries["namespacepolicysummaries"].(rest.Lister).List(ctx, &metainternalversion.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		watcher, err := summaries["namespacepolicysummaries"].(rest.Watcher).Watch(ctx, &metainternalversion.ListOptions{ResourceVersion: list.(*views.NamespacePolicySummaryList).ResourceVersion})
+		Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+
+		_, _, err = polr.Update(ctx, "one", rest.DefaultUpdatedObjectInfo(&v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "one", Namespace: "a"}, Results: results("fail")}), rest.ValidateAllObjectFunc, rest.ValidateAllObjectUpdateFunc, false, &metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		event := <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Modified))
+		Expect(event.Object.(*views.NamespacePolicySummary).Summary).To(Equal(v1alpha2.PolicyReportSummary{Fail: 1}))
+
+		_, _, err = polr.Delete(ctx, "one", rest.ValidateAllObjectFunc, &metav1.DeleteOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		event = <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Deleted))
+		Expect(event.Object.(*views.NamespacePolicySummary).Name).To(Equal("a"))
+		Eventually(cluster).Should(HaveField("Reports", BeZero()))
+	})
+
+	It("should version the totals by the revision of the reports", func() {
+		ctx := genericapirequest.WithNamespace(context.Background(), "a")
+		created, err := polr.Create(ctx, &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "one", Namespace: "a"}, Results: results("pass")}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		revision := created.(*v1alpha2.PolicyReport).ResourceVersion
+		Expect(cluster().ResourceVersion).To(Equal(revision))
+		Expect(namespaces("a")[0].ResourceVersion).To(Equal(revision))
+		policy, err := summaries["policysummaries"].(rest.Getter).Get(context.Background(), policySummaryName("p"), &metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.(*views.PolicySummary).ResourceVersion).To(Equal(revision))
+
+		list, err := polr.List(ctx, &metainternalversion.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.(*v1alpha2.PolicyReportList).ResourceVersion).To(Equal(revision))
+	})
+
+	It("should total the results per policy, rule and namespace", func() {
+		policies := summaries["policysummaries"].(rest.Lister)
+		get := func(name string) *views.PolicySummary {
+			obj, err := summaries["policysummaries"].(rest.Getter).Get(context.Background(), name, &metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			return obj.(*views.PolicySummary)
+		}
+		list, err := policies.List(context.Background(), &metainternalversion.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		watcher, err := summaries["policysummaries"].(rest.Watcher).Watch(context.Background(), &metainternalversion.ListOptions{ResourceVersion: list.(*views.PolicySummaryList).ResourceVersion})
+		Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+
+		ctx := genericapirequest.WithNamespace(context.Background(), "a")
+		_, err = polr.Create(ctx, &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "one", Namespace: "a"}, Results: []*v1alpha2.PolicyReportResult{
+			{Policy: "require-labels", Rule: "check-team", Result: "fail"},
+			{Policy: "require-labels", Rule: "check-team", Result: "pass"},
+			{Policy: "require-labels", Rule: "check-owner", Result: "pass"},
+			{Policy: "team/restrict", Result: "warn"},
+		}}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = cpolr.Create(context.Background(), &v1alpha2.ClusterPolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "one"}, Results: []*v1alpha2.PolicyReportResult{
+			{Policy: "require-labels", Rule: "check-team", Result: "fail"},
+		}}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		summary := get(policySummaryName("require-labels"))
+		Expect(summary.Policy).To(Equal("require-labels"))
+		Expect(summary.Summary).To(Equal(v1alpha2.PolicyReportSummary{Pass: 2, Fail: 2}))
+		Expect(summary.Rules).To(Equal([]views.PolicyRuleSummary{
+			{Rule: "check-owner", Summary: v1alpha2.PolicyReportSummary{Pass: 1}, Namespaces: []views.PolicyNamespaceSummary{
+				{Namespace: "a", Summary: v1alpha2.PolicyReportSummary{Pass: 1}},
+			}},
+			{Rule: "check-team", Summary: v1alpha2.PolicyReportSummary{Pass: 1, Fail: 2}, Namespaces: []views.PolicyNamespaceSummary{
+				{Summary: v1alpha2.PolicyReportSummary{Fail: 1}},
+				{Namespace: "a", Summary: v1alpha2.PolicyReportSummary{Pass: 1, Fail: 1}},
+			}},
+		}))
+		Expect(get(policySummaryName("team/restrict")).Policy).To(Equal("team/restrict"))
+
+		var events []string
+		for len(events) < 3 {
+			event := <-watcher.ResultChan()
+			events = append(events, string(event.Type)+" "+event.Object.(*views.PolicySummary).Policy)
+		}
+		Expect(events).To(Equal([]string{"ADDED require-labels", "ADDED team/restrict", "MODIFIED require-labels"}))
+
+		_, _, err = polr.Delete(ctx, "one", rest.ValidateAllObjectFunc, &metav1.DeleteOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		events = nil
+		for len(events) < 2 {
+			event := <-watcher.ResultChan()
+			events = append(events, string(event.Type)+" "+event.Object.(*views.PolicySummary).Policy)
+		}
+		Expect(events).To(Equal([]string{"MODIFIED require-labels", "DELETED team/restrict"}))
+		Expect(get(policySummaryName("require-labels")).Rules).To(HaveLen(1))
+	})
+
+	It("should name the policy summaries with valid and distinct names", func() {
+		names := sets.New[string]()
+		for _, policy := range []string{"ns/pol", "ns.pol", "Require Labels", "require-labels", "/", strings.Repeat("p", 300)} {
+			name := policySummaryName(policy)
+			Expect(validation.IsDNS1123Subdomain(name)).To(BeEmpty(), name)
+			names.Insert(name)
+		}
+		Expect(names).To(HaveLen(6))
+	})
+
+	It("should total the reports and the rules from the same results", func() {
+		ctx := genericapirequest.WithNamespace(context.Background(), "a")
+		_, err := polr.Create(ctx, &v1alpha2.PolicyReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "one", Namespace: "a", Annotations: map[string]string{ClientSummaryAnnotation: "true"}},
+			Summary:    v1alpha2.PolicyReportSummary{Pass: 10},
+			Results:    results("fail"),
+		}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(namespaces("a")[0].Summary).To(Equal(v1alpha2.PolicyReportSummary{Fail: 1}))
+		Expect(cluster().Summary).To(Equal(v1alpha2.PolicyReportSummary{Fail: 1}))
+		policy, err := summaries["policysummaries"].(rest.Getter).Get(context.Background(), policySummaryName("p"), &metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.(*views.PolicySummary).Summary).To(Equal(v1alpha2.PolicyReportSummary{Fail: 1}))
+	})
+
+	It("should print the totals as a table", func() {
+		createPolr("a", "one", "pass", "fail")
+		list, err := summaries["namespacepolicysummaries"].(rest.Lister).List(context.Background(), &metainternalversion.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		table, err := summaries["namespacepolicysummaries"].(rest.TableConvertor).ConvertToTable(context.Background(), list, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(table.ColumnDefinitions[1].Name).To(Equal("Reports"))
+		Expect(table.Rows).To(HaveLen(1))
+		Expect(table.Rows[0].Cells).To(Equal([]interface{}{"a", int64(1), 1, 1, 0, 0, 0}))
+	})
+
+	It("should be served next to the reports", func() {
+		for _, generic := range []bool{false, true} {
+			handler := newTestServer(inmemory.New(), Options{GenericRegistry: generic})
+			rec := serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/a/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"one"},"results":[{"policy":"p","result":"fail"}]}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+
+			rec = serve(handler, http.MethodGet, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/a/namespacepolicysummaries/a", "")
+			Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+			var summary views.NamespacePolicySummary
+			Expect(json.Unmarshal(rec.Body.Bytes(), &summary)).To(Succeed())
+			Expect(summary.Summary.Fail).To(Equal(1))
+
+			rec = serve(handler, http.MethodGet, "/apis/wgpolicyk8s.io/v1alpha2/clusterpolicysummaries/cluster", "")
+			Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+			rec = serve(handler, http.MethodDelete, "/apis/wgpolicyk8s.io/v1alpha2/clusterpolicysummaries/cluster", "")
+			Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+		}
+	})
+})
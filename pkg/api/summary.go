@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/warning"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// ClientSummaryAnnotation opts a report out of the summary computed by the
+// server when set to "true", for writers sending a subset of the results. The
+// server keeps the summaries of every report when ClientSummaries is set in
+// its Options.
+const ClientSummaryAnnotation = "policy-server.io/client-summary"
+
+// summarize counts results by status.
+func summarize(results []*v1alpha2.PolicyReportResult) v1alpha2.PolicyReportSummary {
+	var summary v1alpha2.PolicyReportSummary
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		switch result.Result {
+		case "pass":
+			summary.Pass++
+		case "fail":
+			summary.Fail++
+		case "warn":
+			summary.Warn++
+		case "error":
+			summary.Error++
+		case "skip":
+			summary.Skip++
+		}
+	}
+	return summary
+}
+
+// setSummary derives the summary of a report from its results, unless the
+// server keeps client summaries or the report opted out. A warning is returned
+// to the client when the summary it submitted did not match the results.
+// Writers leaving the summary empty, and updates keeping the summary of the
+// previous version of the report, did not submit one.
+func setSummary(ctx context.Context, clientSummaries bool, report metav1.Object, summary, previous *v1alpha2.PolicyReportSummary, results []*v1alpha2.PolicyReportResult) {
+	if clientSummaries || report.GetAnnotations()[ClientSummaryAnnotation] == "true" {
+		return
+	}
+	computed := summarize(results)
+	submitted := *summary != v1alpha2.PolicyReportSummary{} && (previous == nil || *summary != *previous)
+	if submitted && *summary != computed {
+		warning.AddWarning(ctx, "", fmt.Sprintf("summary %+v does not match the results and was replaced with %+v, set the %s annotation to \"true\" to keep it", *summary, computed, ClientSummaryAnnotation))
+	}
+	*summary = computed
+}
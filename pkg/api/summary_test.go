@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Summary", func() {
+	const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+	body := func(name, annotations, summary string) string {
+		return fmt.Sprintf(`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":%q,"annotations":{%s}},"summary":%s,"results":[{"policy":"p","result":"pass"},{"policy":"p","result":"fail"},{"policy":"p","result":"fail"}]}`, name, annotations, summary)
+	}
+	summaryOf := func(body []byte) v1alpha2.PolicyReportSummary {
+		var report v1alpha2.PolicyReport
+		Expect(json.Unmarshal(body, &report)).To(Succeed())
+		return report.Summary
+	}
+
+	var handler http.Handler
+	BeforeEach(func() {
+		handler = newTestServer(inmemory.New(), Options{})
+	})
+
+	It("should derive the summary from the results", func() {
+		rec := serve(handler, http.MethodPost, reports, body("a", "", "{}"))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		Expect(summaryOf(rec.Body.Bytes())).To(Equal(v1alpha2.PolicyReportSummary{Pass: 1, Fail: 2}))
+		// writers leaving the summary to the server are not warned
+		Expect(rec.Header().Values("Warning")).To(BeEmpty())
+
+		// changes of the results are summarized again
+		rec = serve(handler, http.MethodPost, reports+"/a/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults","upsert":[{"policy":"q","result":"warn"}]}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		Expect(summaryOf(rec.Body.Bytes())).To(Equal(v1alpha2.PolicyReportSummary{Pass: 1, Fail: 2, Warn: 1}))
+		Expect(rec.Header().Values("Warning")).To(BeEmpty())
+	})
+
+	It("should warn about a wrong summary", func() {
+		rec := serve(handler, http.MethodPost, reports, body("a", "", `{"pass":3}`))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		Expect(summaryOf(rec.Body.Bytes())).To(Equal(v1alpha2.PolicyReportSummary{Pass: 1, Fail: 2}))
+		Expect(rec.Header().Values("Warning")).To(ConsistOf(ContainSubstring("does not match the results")))
+
+		rec = serve(handler, http.MethodPut, reports+"/a", body("a", "", `{"pass":1,"fail":2}`))
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		Expect(rec.Header().Values("Warning")).To(BeEmpty())
+	})
+
+	It("should keep the summaries of every report with client summaries", func() {
+		handler := newTestServer(inmemory.New(), Options{ClientSummaries: true})
+		rec := serve(handler, http.MethodPost, reports, body("a", "", `{"pass":30,"fail":2}`))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		Expect(summaryOf(rec.Body.Bytes())).To(Equal(v1alpha2.PolicyReportSummary{Pass: 30, Fail: 2}))
+		Expect(rec.Header().Values("Warning")).To(BeEmpty())
+	})
+
+	It("should keep the summary of reports opting out", func() {
+		rec := serve(handler, http.MethodPost, reports, body("a", fmt.Sprintf("%q:%q", ClientSummaryAnnotation, "true"), `{"pass":30,"fail":2}`))
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		Expect(summaryOf(rec.Body.Bytes())).To(Equal(v1alpha2.PolicyReportSummary{Pass: 30, Fail: 2}))
+		Expect(rec.Header().Values("Warning")).To(BeEmpty())
+	})
+})
@@ -15,61 +15,226 @@
 package api
 
 import (
+	"strings"
 	"time"
 
+	"github.com/kyverno/policy-server/pkg/api/views"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
 )
 
-func addPolicyReportToTable(table *metav1beta1.Table, polrs ...v1alpha2.PolicyReport) {
-	for i, polr := range polrs {
-		table.ColumnDefinitions = []metav1beta1.TableColumnDefinition{
-			{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
-			{Name: "Pass", Type: "integer", Format: "string"},
-			{Name: "Fail", Type: "integer", Format: "string"},
-			{Name: "Warn", Type: "integer", Format: "string"},
-			{Name: "Error", Type: "integer", Format: "string"},
-			{Name: "Skip", Type: "integer", Format: "string"},
-			{Name: "Age", Type: "string", Format: "duration"},
+// reportColumns are the columns of the tables of reports, kubectl only prints
+// the columns of priority 1 with -o wide.
+var reportColumns = []metav1beta1.TableColumnDefinition{
+	{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
+	{Name: "Kind", Type: "string", Description: "Kind of the scope of the report"},
+	{Name: "Scope", Type: "string", Description: "Name of the scope of the report"},
+	{Name: "Pass", Type: "integer", Format: "string"},
+	{Name: "Fail", Type: "integer", Format: "string"},
+	{Name: "Warn", Type: "integer", Format: "string"},
+	{Name: "Error", Type: "integer", Format: "string"},
+	{Name: "Skip", Type: "integer", Format: "string"},
+	{Name: "Age", Type: "string", Format: "duration"},
+	{Name: "Source", Type: "string", Priority: 1, Description: "Sources of the results"},
+	{Name: "Scope Namespace", Type: "string", Priority: 1, Description: "Namespace of the scope of the report"},
+	{Name: "Results", Type: "integer", Format: "string", Priority: 1, Description: "Number of results"},
+	{Name: "Last Result", Type: "string", Format: "duration", Priority: 1, Description: "Age of the latest result"},
+}
+
+func addPolicyReportToTable(table *metav1beta1.Table, options runtime.Object, polrs ...v1alpha2.PolicyReport) {
+	setTableColumns(table, options, reportColumns)
+	for i := range polrs {
+		polr := &polrs[i]
+		table.Rows = append(table.Rows, metav1beta1.TableRow{
+			Cells:  reportCells(&polr.ObjectMeta, polr.Scope, polr.Summary, polr.Results),
+			Object: runtime.RawExtension{Object: polr},
+		})
+	}
+}
+
+func addClusterPolicyReportToTable(table *metav1beta1.Table, options runtime.Object, cpolrs ...v1alpha2.ClusterPolicyReport) {
+	setTableColumns(table, options, reportColumns)
+	for i := range cpolrs {
+		cpolr := &cpolrs[i]
+		table.Rows = append(table.Rows, metav1beta1.TableRow{
+			Cells:  reportCells(&cpolr.ObjectMeta, cpolr.Scope, cpolr.Summary, cpolr.Results),
+			Object: runtime.RawExtension{Object: cpolr},
+		})
+	}
+}
+
+// reportCells returns the cells of a report for reportColumns.
+func reportCells(report *metav1.ObjectMeta, scope *corev1.ObjectReference, summary v1alpha2.PolicyReportSummary, results []*v1alpha2.PolicyReportResult) []interface{} {
+	var kind, name, namespace string
+	if scope != nil {
+		kind, name, namespace = scope.Kind, scope.Name, scope.Namespace
+	}
+	sources := sets.New[string]()
+	var last int64
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		if len(result.Source) > 0 {
+			sources.Insert(result.Source)
+		}
+		last = max(last, result.Timestamp.Seconds)
+	}
+	lastResult := "<none>"
+	if last > 0 {
+		lastResult = age(time.Unix(last, 0))
+	}
+	return []interface{}{
+		report.Name, kind, name,
+		summary.Pass, summary.Fail, summary.Warn, summary.Error, summary.Skip,
+		age(report.CreationTimestamp.Time),
+		strings.Join(sets.List(sources), ","), namespace, len(results), lastResult,
+	}
+}
+
+func age(t time.Time) string {
+	return time.Since(t).Truncate(time.Second).String()
+}
+
+// setTableColumns sets the columns of table, unless options ask for no
+// headers as kubectl does past the first event of a watch.
+func setTableColumns(table *metav1beta1.Table, options runtime.Object, columns []metav1beta1.TableColumnDefinition) {
+	if opts, ok := options.(*metav1.TableOptions); ok && opts != nil && opts.NoHeaders {
+		return
+	}
+	table.ColumnDefinitions = columns
+}
+
+func addNamespacePolicySummaryToTable(table *metav1beta1.Table, objects ...runtime.Object) {
+	table.ColumnDefinitions = []metav1beta1.TableColumnDefinition{
+		{Name: "Name", Type: "string", Format: "name", Description: "Name of the namespace"},
+		{Name: "Reports", Type: "integer", Format: "string"},
+		{Name: "Pass", Type: "integer", Format: "string"},
+		{Name: "Fail", Type: "integer", Format: "string"},
+		{Name: "Warn", Type: "integer", Format: "string"},
+		{Name: "Error", Type: "integer", Format: "string"},
+		{Name: "Skip", Type: "integer", Format: "string"},
+	}
+	for _, obj := range objects {
+		summary, ok := obj.(*views.NamespacePolicySummary)
+		if !ok {
+			continue
 		}
-		row := make([]interface{}, 0, len(table.ColumnDefinitions))
-		row = append(row, polr.Name)
-		row = append(row, polr.Summary.Pass)
-		row = append(row, polr.Summary.Fail)
-		row = append(row, polr.Summary.Warn)
-		row = append(row, polr.Summary.Error)
-		row = append(row, polr.Summary.Skip)
-		row = append(row, time.Since(polr.CreationTimestamp.Time).Truncate(time.Second).String())
 		table.Rows = append(table.Rows, metav1beta1.TableRow{
-			Cells:  row,
-			Object: runtime.RawExtension{Object: &polrs[i]},
+			Cells:  []interface{}{summary.Name, summary.Reports, summary.Summary.Pass, summary.Summary.Fail, summary.Summary.Warn, summary.Summary.Error, summary.Summary.Skip},
+			Object: runtime.RawExtension{Object: summary},
 		})
 	}
 }
 
-func addClusterPolicyReportToTable(table *metav1beta1.Table, cpolrs ...v1alpha2.ClusterPolicyReport) {
-	for i, cpolr := range cpolrs {
-		table.ColumnDefinitions = []metav1beta1.TableColumnDefinition{
-			{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
-			{Name: "Pass", Type: "integer", Format: "string"},
-			{Name: "Fail", Type: "integer", Format: "string"},
-			{Name: "Warn", Type: "integer", Format: "string"},
-			{Name: "Error", Type: "integer", Format: "string"},
-			{Name: "Skip", Type: "integer", Format: "string"},
-			{Name: "Age", Type: "string", Format: "duration"},
+func addClusterPolicySummaryToTable(table *metav1beta1.Table, objects ...runtime.Object) {
+	table.ColumnDefinitions = []metav1beta1.TableColumnDefinition{
+		{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
+		{Name: "Reports", Type: "integer", Format: "string"},
+		{Name: "Pass", Type: "integer", Format: "string"},
+		{Name: "Fail", Type: "integer", Format: "string"},
+		{Name: "Warn", Type: "integer", Format: "string"},
+		{Name: "Error", Type: "integer", Format: "string"},
+		{Name: "Skip", Type: "integer", Format: "string"},
+	}
+	for _, obj := range objects {
+		summary, ok := obj.(*views.ClusterPolicySummary)
+		if !ok {
+			continue
+		}
+		table.Rows = append(table.Rows, metav1beta1.TableRow{
+			Cells:  []interface{}{summary.Name, summary.Reports, summary.Summary.Pass, summary.Summary.Fail, summary.Summary.Warn, summary.Summary.Error, summary.Summary.Skip},
+			Object: runtime.RawExtension{Object: summary},
+		})
+	}
+}
+
+func addPolicySummaryToTable(table *metav1beta1.Table, objects ...runtime.Object) {
+	table.ColumnDefinitions = []metav1beta1.TableColumnDefinition{
+		{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
+		{Name: "Policy", Type: "string"},
+		{Name: "Rules", Type: "integer", Format: "string"},
+		{Name: "Pass", Type: "integer", Format: "string"},
+		{Name: "Fail", Type: "integer", Format: "string"},
+		{Name: "Warn", Type: "integer", Format: "string"},
+		{Name: "Error", Type: "integer", Format: "string"},
+		{Name: "Skip", Type: "integer", Format: "string"},
+	}
+	for _, obj := range objects {
+		summary, ok := obj.(*views.PolicySummary)
+		if !ok {
+			continue
+		}
+		table.Rows = append(table.Rows, metav1beta1.TableRow{
+			Cells:  []interface{}{summary.Name, summary.Policy, len(summary.Rules), summary.Summary.Pass, summary.Summary.Fail, summary.Summary.Warn, summary.Summary.Error, summary.Summary.Skip},
+			Object: runtime.RawExtension{Object: summary},
+		})
+	}
+}
+
+func addResourceReportToTable(table *metav1beta1.Table, reports ...views.ResourceReport) {
+	table.ColumnDefinitions = []metav1beta1.TableColumnDefinition{
+		{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
+		{Name: "Kind", Type: "string", Description: "Kind of the resource the results are about"},
+		{Name: "Resource", Type: "string", Description: "Name of the resource the results are about"},
+		{Name: "Pass", Type: "integer", Format: "string"},
+		{Name: "Fail", Type: "integer", Format: "string"},
+		{Name: "Warn", Type: "integer", Format: "string"},
+		{Name: "Error", Type: "integer", Format: "string"},
+		{Name: "Skip", Type: "integer", Format: "string"},
+	}
+	for i, report := range reports {
+		table.Rows = append(table.Rows, metav1beta1.TableRow{
+			Cells:  []interface{}{report.Name, report.Resource.Kind, report.Resource.Name, report.Summary.Pass, report.Summary.Fail, report.Summary.Warn, report.Summary.Error, report.Summary.Skip},
+			Object: runtime.RawExtension{Object: &reports[i]},
+		})
+	}
+}
+
+// resultColumns are the columns of the tables of results, one row per result.
+var resultColumns = []metav1beta1.TableColumnDefinition{
+	{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
+	{Name: "Report", Type: "string", Description: "Name of the report holding the result"},
+	{Name: "Policy", Type: "string"},
+	{Name: "Rule", Type: "string"},
+	{Name: "Result", Type: "string"},
+	{Name: "Severity", Type: "string"},
+	{Name: "Resource", Type: "string", Description: "Resources the result is about, the scope of the report unless the result names its own"},
+	{Name: "Message", Type: "string"},
+	{Name: "Source", Type: "string", Priority: 1},
+	{Name: "Category", Type: "string", Priority: 1},
+	{Name: "Age", Type: "string", Format: "duration", Priority: 1, Description: "Age of the result, or of its report when the result has no timestamp"},
+}
+
+func addPolicyResultToTable(table *metav1beta1.Table, options runtime.Object, results ...views.PolicyResult) {
+	setTableColumns(table, options, resultColumns)
+	for i := range results {
+		result := &results[i]
+		resources := result.Result.Subjects
+		if len(resources) == 0 && result.Scope != nil {
+			resources = []*corev1.ObjectReference{result.Scope}
+		}
+		names := make([]string, 0, len(resources))
+		for _, resource := range resources {
+			if resource != nil {
+				names = append(names, resource.Kind+"/"+resource.Name)
+			}
+		}
+		created := result.CreationTimestamp.Time
+		if result.Result.Timestamp.Seconds > 0 {
+			created = time.Unix(result.Result.Timestamp.Seconds, int64(result.Result.Timestamp.Nanos))
 		}
-		row := make([]interface{}, 0, len(table.ColumnDefinitions))
-		row = append(row, cpolr.Name)
-		row = append(row, cpolr.Summary.Pass)
-		row = append(row, cpolr.Summary.Fail)
-		row = append(row, cpolr.Summary.Warn)
-		row = append(row, cpolr.Summary.Error)
-		row = append(row, cpolr.Summary.Skip)
-		row = append(row, time.Since(cpolr.CreationTimestamp.Time).Truncate(time.Second).String())
 		table.Rows = append(table.Rows, metav1beta1.TableRow{
-			Cells:  row,
-			Object: runtime.RawExtension{Object: &cpolrs[i]},
+			Cells: []interface{}{
+				result.Name, result.Report.Name, result.Result.Policy, result.Result.Rule,
+				string(result.Result.Result), string(result.Result.Severity), strings.Join(names, ","), result.Result.Description,
+				result.Result.Source, result.Result.Category, age(created),
+			},
+			Object: runtime.RawExtension{Object: result},
 		})
 	}
 }
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Tables", func() {
+	report := func() *v1alpha2.PolicyReport {
+		return &v1alpha2.PolicyReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))},
+			Scope:      &corev1.ObjectReference{Kind: "Deployment", Namespace: "default", Name: "nginx"},
+			Summary:    v1alpha2.PolicyReportSummary{Pass: 1, Fail: 1},
+			Results: []*v1alpha2.PolicyReportResult{
+				{Policy: "p", Result: "pass", Source: "kyverno", Timestamp: metav1.Timestamp{Seconds: time.Now().Add(-time.Minute).Unix()}},
+				{Policy: "q", Result: "fail", Source: "trivy"},
+			},
+		}
+	}
+
+	It("should print the scope of reports and wide columns", func() {
+		table, err := (&polrStore{}).ConvertToTable(context.Background(), &v1alpha2.PolicyReportList{Items: []v1alpha2.PolicyReport{*report(), *report()}}, &metav1.TableOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(table.ColumnDefinitions).To(Equal(reportColumns))
+		Expect(table.ColumnDefinitions[9].Priority).To(BeEquivalentTo(1))
+		Expect(table.Rows).To(HaveLen(2))
+		cells := table.Rows[0].Cells
+		Expect(cells).To(HaveLen(len(reportColumns)))
+		Expect(cells[:8]).To(Equal([]interface{}{"a", "Deployment", "nginx", 1, 1, 0, 0, 0}))
+		Expect(cells[8]).To(Equal("1h0m0s"))
+		Expect(cells[9:12]).To(Equal([]interface{}{"kyverno,trivy", "default", 2}))
+		Expect(cells[12]).To(HavePrefix("1m"))
+
+		table, err = (&cpolrStore{}).ConvertToTable(context.Background(), &v1alpha2.ClusterPolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "b"}}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(table.Rows[0].Cells[:3]).To(Equal([]interface{}{"b", "", ""}))
+		Expect(table.Rows[0].Cells[9:]).To(Equal([]interface{}{"", "", 0, "<none>"}))
+	})
+
+	It("should honor the table options", func() {
+		table, err := (&polrStore{}).ConvertToTable(context.Background(), report(), &metav1.TableOptions{NoHeaders: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(table.ColumnDefinitions).To(BeEmpty())
+
+		handler := newTestServer(inmemory.New(), Options{})
+		rec := serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a"}}`)
+		Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+		get := func(query string) metav1.Table {
+			req := httptest.NewRequest(http.MethodGet, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports/a"+query, nil)
+			req.Header.Set("Accept", "application/json;as=Table;v=v1;g=meta.k8s.io")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+			var table metav1.Table
+			Expect(json.Unmarshal(rec.Body.Bytes(), &table)).To(Succeed())
+			Expect(table.Rows).To(HaveLen(1))
+			return table
+		}
+		Expect(string(get("").Rows[0].Object.Raw)).To(ContainSubstring(`"kind":"PartialObjectMetadata"`))
+		Expect(string(get("?includeObject=Object").Rows[0].Object.Raw)).To(ContainSubstring(`"kind":"PolicyReport"`))
+		Expect(get("?includeObject=None").Rows[0].Object.Raw).To(BeEmpty())
+	})
+})
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/admission"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// resultsStore serves the results subresource of reports, which deletes and
+// upserts results without sending the whole report. The changes go through
+// the update of the report store at the version they were applied to, so they
+// are written, summarized and watched as a single update of the report. They
+// are applied again on top of concurrent writes.
+type resultsStore struct {
+	reports rest.Updater
+	// kind and resource of the reports, and the admission chain run on the
+	// updates the changes make to them.
+	kind      schema.GroupVersionKind
+	resource  schema.GroupVersionResource
+	admission admission.Interface
+}
+
+func (r *resultsStore) New() runtime.Object {
+	return &views.PolicyReportResults{}
+}
+
+func (r *resultsStore) Destroy() {}
+
+func (r *resultsStore) Create(ctx context.Context, name string, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	changes, ok := obj.(*views.PolicyReportResults)
+	if !ok {
+		return nil, errors.NewBadRequest(fmt.Sprintf("not a PolicyReportResults: %T", obj))
+	}
+	if errs := validateResultChanges(changes); len(errs) > 0 {
+		return nil, errors.NewInvalid(v1alpha2.SchemeGroupVersion.WithKind("PolicyReportResults").GroupKind(), name, errs)
+	}
+	if createValidation != nil {
+		if err := createValidation(ctx, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	updateOptions := &metav1.UpdateOptions{DryRun: options.DryRun, FieldManager: options.FieldManager}
+	objInfo := &resultChanges{changes: changes, transformers: r.updateMutation(ctx, name, updateOptions)}
+	updateValidation := r.updateValidation(ctx, name, updateOptions)
+	var updated runtime.Object
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		// reports are never created through their results
+		updated, _, err = r.reports.Update(ctx, name, objInfo, rest.ValidateAllObjectFunc, updateValidation, false, updateOptions)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// updateMutation returns the mutating admission of the update of report name
+// made by the changes, run on the changed report as the update of the report
+// runs it on the submitted one. The admission of the request only covers the
+// results subresource.
+func (r *resultsStore) updateMutation(ctx context.Context, name string, options *metav1.UpdateOptions) []rest.TransformFunc {
+	mutation, ok := r.admission.(admission.MutationInterface)
+	if !ok || !mutation.Handles(admission.Update) {
+		return nil
+	}
+	userInfo, _ := genericapirequest.UserFrom(ctx)
+	return []rest.TransformFunc{func(ctx context.Context, newObj, oldObj runtime.Object) (runtime.Object, error) {
+		attributes := admission.NewAttributesRecord(newObj, oldObj, r.kind, genericapirequest.NamespaceValue(ctx), name, r.resource, "", admission.Update, options, slices.Contains(options.DryRun, metav1.DryRunAll), userInfo)
+		return newObj, mutation.Admit(ctx, attributes, admission.NewObjectInterfacesFromScheme(Scheme))
+	}}
+}
+
+// updateValidation returns the validating admission of the update of report
+// name made by the changes.
+func (r *resultsStore) updateValidation(ctx context.Context, name string, options *metav1.UpdateOptions) rest.ValidateObjectUpdateFunc {
+	if r.admission == nil {
+		return rest.ValidateAllObjectUpdateFunc
+	}
+	userInfo, _ := genericapirequest.UserFrom(ctx)
+	attributes := admission.NewAttributesRecord(nil, nil, r.kind, genericapirequest.NamespaceValue(ctx), name, r.resource, "", admission.Update, options, slices.Contains(options.DryRun, metav1.DryRunAll), userInfo)
+	return rest.AdmissionToValidateObjectUpdateFunc(r.admission, attributes, admission.NewObjectInterfacesFromScheme(Scheme))
+}
+
+var _ rest.NamedCreater = &resultsStore{}
+
+func validateResultChanges(changes *views.PolicyReportResults) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, key := range changes.Delete {
+		if len(key.Policy) == 0 {
+			allErrs = append(allErrs, field.Required(field.NewPath("delete").Index(i).Child("policy"), ""))
+		}
+	}
+	for i, result := range changes.Upsert {
+		if len(result.Policy) == 0 {
+			allErrs = append(allErrs, field.Required(field.NewPath("upsert").Index(i).Child("policy"), ""))
+		}
+	}
+	return allErrs
+}
+
+// resultChanges applies the changes of results to the version of a report
+// the update is made on, and then its transformers. The summary is computed
+// again from the changed results, even for clients keeping their own
+// summaries: the summary of the version the changes were applied to no longer
+// matches its results.
+type resultChanges struct {
+	changes      *views.PolicyReportResults
+	transformers []rest.TransformFunc
+}
+
+func (c *resultChanges) Preconditions() *metav1.Preconditions {
+	return nil
+}
+
+func (c *resultChanges) UpdatedObject(ctx context.Context, oldObj runtime.Object) (runtime.Object, error) {
+	var newObj runtime.Object
+	switch report := oldObj.(type) {
+	case *v1alpha2.PolicyReport:
+		report = report.DeepCopy()
+		report.Results = applyResultChanges(report.Results, c.changes)
+		newObj = report
+	case *v1alpha2.ClusterPolicyReport:
+		report = report.DeepCopy()
+		report.Results = applyResultChanges(report.Results, c.changes)
+		newObj = report
+	default:
+		return nil, errors.NewBadRequest(fmt.Sprintf("results cannot be changed on %T", oldObj))
+	}
+	for _, transform := range c.transformers {
+		var err error
+		if newObj, err = transform(ctx, newObj, oldObj); err != nil {
+			return nil, err
+		}
+	}
+	switch report := newObj.(type) {
+	case *v1alpha2.PolicyReport:
+		report.Summary = summarize(report.Results)
+	case *v1alpha2.ClusterPolicyReport:
+		report.Summary = summarize(report.Results)
+	}
+	return newObj, nil
+}
+
+// applyResultChanges removes the results to delete, and then replaces or
+// appends the results to upsert. Results are found by the string form of their
+// key, which leaves UIDs out, so that large batches do not go through every
+// result for each change.
+func applyResultChanges(results []*v1alpha2.PolicyReportResult, changes *views.PolicyReportResults) []*v1alpha2.PolicyReportResult {
+	deletes := make(map[string][]*views.PolicyResultKey, len(changes.Delete))
+	for i := range changes.Delete {
+		key := &changes.Delete[i]
+		deletes[key.String()] = append(deletes[key.String()], key)
+	}
+	kept := make([]*v1alpha2.PolicyReportResult, 0, len(results)+len(changes.Upsert))
+	positions := make(map[string][]int, len(results))
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		key := resultKeyOf(result)
+		if slices.ContainsFunc(deletes[key.String()], func(deleted *views.PolicyResultKey) bool { return matchesResultKey(&key, deleted) }) {
+			continue
+		}
+		positions[key.String()] = append(positions[key.String()], len(kept))
+		kept = append(kept, result)
+	}
+	for i := range changes.Upsert {
+		upsert := changes.Upsert[i].DeepCopy()
+		key := resultKeyOf(upsert)
+		replaced := false
+		for _, j := range positions[key.String()] {
+			if existing := resultKeyOf(kept[j]); matchesResultKey(&existing, &key) {
+				kept[j], replaced = upsert, true
+				break
+			}
+		}
+		if !replaced {
+			positions[key.String()] = append(positions[key.String()], len(kept))
+			kept = append(kept, upsert)
+		}
+	}
+	return kept
+}
+
+func resultKeyOf(result *v1alpha2.PolicyReportResult) views.PolicyResultKey {
+	key := views.PolicyResultKey{Policy: result.Policy, Rule: result.Rule}
+	for _, resource := range result.Subjects {
+		if resource != nil {
+			key.Resources = append(key.Resources, *resource)
+		}
+	}
+	return key
+}
+
+// matchesResultKey reports whether a and b identify the same result.
+func matchesResultKey(a, b *views.PolicyResultKey) bool {
+	if a.Policy != b.Policy || a.Rule != b.Rule || len(a.Resources) != len(b.Resources) {
+		return false
+	}
+	for i := range a.Resources {
+		if !sameResource(&a.Resources[i], &b.Resources[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameResource(a, b *corev1.ObjectReference) bool {
+	if a.Kind != b.Kind || a.Namespace != b.Namespace || a.Name != b.Name {
+		return false
+	}
+	return len(a.UID) == 0 || len(b.UID) == 0 || a.UID == b.UID
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/api/views"
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	corev1 "k8s.io/api/core/v1"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Result upserts", func() {
+	pod := func(name string) *corev1.ObjectReference {
+		return &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: name}
+	}
+
+	It("should delete and then upsert results by policy, rule and resources", func() {
+		results := []*v1alpha2.PolicyReportResult{
+			{Policy: "p", Rule: "r", Result: "fail", Subjects: []*corev1.ObjectReference{pod("a")}},
+			{Policy: "p", Rule: "r", Result: "fail", Subjects: []*corev1.ObjectReference{pod("b")}},
+			{Policy: "q", Result: "warn"},
+		}
+		uid := *pod("a")
+		uid.UID = "1234"
+		changed := applyResultChanges(results, &views.PolicyReportResults{
+			Delete: []views.PolicyResultKey{{Policy: "q"}, {Policy: "p", Rule: "r"}},
+			Upsert: []v1alpha2.PolicyReportResult{
+				{Policy: "p", Rule: "r", Result: "pass", Subjects: []*corev1.ObjectReference{&uid}},
+				{Policy: "p", Rule: "s", Result: "pass", Subjects: []*corev1.ObjectReference{pod("a")}},
+			},
+		})
+		Expect(changed).To(HaveLen(3))
+		Expect(changed[0].Result).To(BeEquivalentTo("pass"))
+		Expect(changed[0].Subjects[0].UID).To(BeEquivalentTo("1234"))
+		Expect(changed[1].Subjects[0].Name).To(Equal("b"))
+		Expect(changed[2].Rule).To(Equal("s"))
+		// the results of the report are left untouched
+		Expect(results[0].Result).To(BeEquivalentTo("fail"))
+	})
+
+	It("should change the results of reports through their subresource", func() {
+		for _, generic := range []bool{false, true} {
+			handler := newTestServer(inmemory.New(), Options{GenericRegistry: generic})
+			for _, report := range []struct{ path, body string }{
+				{"/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a"},
+					"results":[{"policy":"p","rule":"r","result":"fail","resources":[{"kind":"Pod","namespace":"default","name":"a"}]},{"policy":"q","result":"warn"}]}`},
+				{"/apis/wgpolicyk8s.io/v1alpha2/clusterpolicyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"ClusterPolicyReport","metadata":{"name":"a"}}`},
+			} {
+				rec := serve(handler, http.MethodPost, report.path, report.body)
+				Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+			}
+
+			rec := serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports/a/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults",
+				"delete":[{"policy":"q"}],
+				"upsert":[{"policy":"p","rule":"r","result":"pass","resources":[{"kind":"Pod","namespace":"default","name":"a"}]},{"policy":"p","rule":"s","result":"fail"}]}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+			var polr v1alpha2.PolicyReport
+			Expect(json.Unmarshal(rec.Body.Bytes(), &polr)).To(Succeed())
+			Expect(polr.Results).To(HaveLen(2))
+			Expect(polr.Summary).To(Equal(v1alpha2.PolicyReportSummary{Pass: 1, Fail: 1}))
+
+			rec = serve(handler, http.MethodGet, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports/a", "")
+			Expect(json.Unmarshal(rec.Body.Bytes(), &polr)).To(Succeed())
+			Expect(polr.Results[0].Result).To(BeEquivalentTo("pass"))
+			Expect(polr.Results[1].Rule).To(Equal("s"))
+
+			rec = serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/clusterpolicyreports/a/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults","upsert":[{"policy":"p","result":"error"}]}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+			var cpolr v1alpha2.ClusterPolicyReport
+			Expect(json.Unmarshal(rec.Body.Bytes(), &cpolr)).To(Succeed())
+			Expect(cpolr.Summary.Error).To(Equal(1))
+
+			rec = serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports/a/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults","upsert":[{"result":"pass"}]}`)
+			Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity), rec.Body.String())
+			rec = serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports/missing/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults","delete":[{"policy":"p"}]}`)
+			Expect(rec.Code).To(Equal(http.StatusNotFound), rec.Body.String())
+		}
+	})
+
+	It("should summarize the changed results of reports keeping client summaries", func() {
+		for _, clientSummaries := range []bool{false, true} {
+			handler := newTestServer(inmemory.New(), Options{ClientSummaries: clientSummaries})
+			rec := serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport",
+				"metadata":{"name":"a","annotations":{"policy-server.io/client-summary":"true"}},"results":[{"policy":"p","result":"fail"}],"summary":{"fail":1}}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+
+			rec = serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports/a/results", `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReportResults",
+				"upsert":[{"policy":"p","result":"pass"},{"policy":"q","result":"warn"}]}`)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+			var polr v1alpha2.PolicyReport
+			Expect(json.Unmarshal(rec.Body.Bytes(), &polr)).To(Succeed())
+			Expect(polr.Summary).To(Equal(v1alpha2.PolicyReportSummary{Pass: 1, Warn: 1}))
+		}
+	})
+
+	It("should report conflicting writes as conflicts, for the changes to be retried", func() {
+		for _, generic := range []bool{false, true} {
+			handler := newTestServer(inmemory.New(), Options{GenericRegistry: generic})
+			const reports = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports"
+			body := `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a"}}`
+			rec := serve(handler, http.MethodPost, reports, body)
+			Expect(rec.Code).To(Equal(http.StatusCreated), rec.Body.String())
+			var created v1alpha2.PolicyReport
+			Expect(json.Unmarshal(rec.Body.Bytes(), &created)).To(Succeed())
+			rec = serve(handler, http.MethodPost, reports, body)
+			Expect(rec.Code).To(Equal(http.StatusConflict), rec.Body.String())
+			Expect(rec.Body.String()).To(ContainSubstring(`policyreports.wgpolicyk8s.io \"a\" already exists`))
+
+			update := `{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a","resourceVersion":"` + created.ResourceVersion + `"}}`
+			rec = serve(handler, http.MethodPut, reports+"/a", update)
+			Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+			rec = serve(handler, http.MethodPut, reports+"/a", update)
+			Expect(rec.Code).To(Equal(http.StatusConflict), rec.Body.String())
+			Expect(rec.Body.String()).To(ContainSubstring(`Operation cannot be fulfilled on policyreports.wgpolicyk8s.io \"a\"`))
+		}
+	})
+
+	It("should send a single event for the changes", func() {
+		ctx := genericapirequest.WithNamespace(context.Background(), "default")
+		store, err := PolicyReportStore(inmemory.New(), storage.NewUsage("policyreports"), Quota{}, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(store.Destroy)
+		created, err := store.Create(ctx, &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		watcher, err := store.Watch(ctx, &metainternalversion.ListOptions{ResourceVersion: created.(*v1alpha2.PolicyReport).ResourceVersion})
+		Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+
+		_, err = (&resultsStore{reports: store}).Create(ctx, "a", &views.PolicyReportResults{Upsert: []v1alpha2.PolicyReportResult{
+			{Policy: "p", Result: "pass"}, {Policy: "q", Result: "fail"},
+		}}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		event := <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Modified))
+		Expect(event.Object.(*v1alpha2.PolicyReport).Results).To(HaveLen(2))
+		Expect(event.Object.(*v1alpha2.PolicyReport).Summary).To(Equal(v1alpha2.PolicyReportSummary{Pass: 1, Fail: 1}))
+		Consistently(watcher.ResultChan(), "100ms").ShouldNot(Receive())
+	})
+
+	It("should apply the changes on top of the writes of other replicas", func() {
+		ctx := genericapirequest.WithNamespace(context.Background(), "default")
+		backend := inmemory.New()
+		var replicas []API
+		for i := 0; i < 2; i++ {
+			store, err := PolicyReportStore(backend, storage.NewUsage("policyreports"), Quota{}, nil, false)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(store.Destroy)
+			replicas = append(replicas, store)
+		}
+		_, err := replicas[0].Create(ctx, &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"}}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		for i, policy := range []string{"p", "q", "r", "s"} {
+			_, err = (&resultsStore{reports: replicas[i%2]}).Create(ctx, "a", &views.PolicyReportResults{Upsert: []v1alpha2.PolicyReportResult{
+				{Policy: policy, Result: "pass"},
+			}}, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		report, err := replicas[0].Get(ctx, "a", &metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.(*v1alpha2.PolicyReport).Results).To(HaveLen(4))
+	})
+})
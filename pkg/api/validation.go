@@ -0,0 +1,93 @@
+package api
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
+	"k8s.io/apimachinery/pkg/api/validation/path"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var (
+	// Results are the supported results of a policy, they are also the enum
+	// of the result field in the OpenAPI schema.
+	Results = []v1alpha2.PolicyResult{"pass", "fail", "warn", "error", "skip"}
+	// Severities are the supported severities of a policy result, they are
+	// also the enum of the severity field in the OpenAPI schema.
+	Severities = []v1alpha2.PolicyResultSeverity{"critical", "high", "medium", "low", "info"}
+)
+
+// ValidatePolicyReport returns the problems of report.
+func ValidatePolicyReport(report *v1alpha2.PolicyReport) field.ErrorList {
+	allErrs := apimachineryvalidation.ValidateObjectMeta(&report.ObjectMeta, true, path.ValidatePathSegmentName, field.NewPath("metadata"))
+	allErrs = append(allErrs, validateScope(report.Scope, report.ScopeSelector, report.Namespace)...)
+	return append(allErrs, validateResults(report.Results, field.NewPath("results"))...)
+}
+
+// ValidatePolicyReportUpdate returns the problems of an update of old to report.
+func ValidatePolicyReportUpdate(report, old *v1alpha2.PolicyReport) field.ErrorList {
+	allErrs := apimachineryvalidation.ValidateObjectMetaUpdate(&report.ObjectMeta, &old.ObjectMeta, field.NewPath("metadata"))
+	return append(allErrs, ValidatePolicyReport(report)...)
+}
+
+// ValidateClusterPolicyReport returns the problems of report.
+func ValidateClusterPolicyReport(report *v1alpha2.ClusterPolicyReport) field.ErrorList {
+	allErrs := apimachineryvalidation.ValidateObjectMeta(&report.ObjectMeta, false, path.ValidatePathSegmentName, field.NewPath("metadata"))
+	allErrs = append(allErrs, validateScope(report.Scope, report.ScopeSelector, "")...)
+	return append(allErrs, validateResults(report.Results, field.NewPath("results"))...)
+}
+
+// ValidateClusterPolicyReportUpdate returns the problems of an update of old to report.
+func ValidateClusterPolicyReportUpdate(report, old *v1alpha2.ClusterPolicyReport) field.ErrorList {
+	allErrs := apimachineryvalidation.ValidateObjectMetaUpdate(&report.ObjectMeta, &old.ObjectMeta, field.NewPath("metadata"))
+	return append(allErrs, ValidateClusterPolicyReport(report)...)
+}
+
+// validateScope validates the scope of a report in namespace, the scope of
+// a namespaced report has to be in its namespace.
+func validateScope(scope *corev1.ObjectReference, selector *metav1.LabelSelector, namespace string) field.ErrorList {
+	var allErrs field.ErrorList
+	if scope != nil && selector != nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("scopeSelector"), "may not be specified together with scope"))
+	}
+	if scope != nil && len(namespace) > 0 && len(scope.Namespace) > 0 && scope.Namespace != namespace {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("scope", "namespace"), scope.Namespace, "must match the namespace of the report"))
+	}
+	if selector != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(selector, metav1validation.LabelSelectorValidationOptions{}, field.NewPath("scopeSelector"))...)
+	}
+	return allErrs
+}
+
+func validateResults(results []*v1alpha2.PolicyReportResult, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, result := range results {
+		idxPath := fldPath.Index(i)
+		if result == nil {
+			allErrs = append(allErrs, field.Required(idxPath, ""))
+			continue
+		}
+		if len(result.Policy) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("policy"), ""))
+		}
+		if len(result.Result) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("result"), ""))
+		} else if !slices.Contains(Results, result.Result) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("result"), result.Result, Results))
+		}
+		if len(result.Severity) > 0 && !slices.Contains(Severities, result.Severity) {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("severity"), result.Severity, Severities))
+		}
+		if len(result.Subjects) > 0 && result.SubjectSelector != nil {
+			allErrs = append(allErrs, field.Forbidden(idxPath.Child("resourceSelector"), "may not be specified together with resources"))
+		}
+		if result.SubjectSelector != nil {
+			allErrs = append(allErrs, metav1validation.ValidateLabelSelector(result.SubjectSelector, metav1validation.LabelSelectorValidationOptions{}, idxPath.Child("resourceSelector"))...)
+		}
+	}
+	return allErrs
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Validation", func() {
+	fields := func(errs field.ErrorList) []string {
+		var fields []string
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+		return fields
+	}
+
+	It("should accept valid reports", func() {
+		report := &v1alpha2.PolicyReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default"},
+			Scope:      &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "a"},
+			Results: []*v1alpha2.PolicyReportResult{
+				{Policy: "p", Result: "pass", Severity: "high"},
+				{Policy: "p", Result: "fail"},
+			},
+		}
+		Expect(ValidatePolicyReport(report)).To(BeEmpty())
+	})
+
+	It("should list every problem of a report", func() {
+		report := &v1alpha2.PolicyReport{
+			ObjectMeta:    metav1.ObjectMeta{Name: "a", Namespace: "default"},
+			Scope:         &corev1.ObjectReference{Kind: "Pod", Namespace: "other", Name: "a"},
+			ScopeSelector: &metav1.LabelSelector{},
+			Results: []*v1alpha2.PolicyReportResult{
+				{Policy: "p", Result: "passed"},
+				{Result: "pass", Severity: "urgent"},
+				nil,
+			},
+		}
+		Expect(fields(ValidatePolicyReport(report))).To(ConsistOf(
+			"scopeSelector", "scope.namespace", "results[0].result", "results[1].policy", "results[1].severity", "results[2]",
+		))
+
+		cluster := &v1alpha2.ClusterPolicyReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "a"},
+			Results:    []*v1alpha2.PolicyReportResult{{Policy: "p"}},
+		}
+		Expect(fields(ValidateClusterPolicyReport(cluster))).To(ConsistOf("results[0].result"))
+	})
+
+	It("should reject invalid reports with field paths", func() {
+		handler := newTestServer(inmemory.New(), Options{})
+		rec := serve(handler, http.MethodPost, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports",
+			`{"apiVersion":"wgpolicyk8s.io/v1alpha2","kind":"PolicyReport","metadata":{"name":"a"},"results":[{"policy":"p","result":"passed","severity":"urgent"}]}`)
+		Expect(rec.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(rec.Body.String()).To(ContainSubstring(`results[0].result`))
+		Expect(rec.Body.String()).To(ContainSubstring(`results[0].severity`))
+	})
+
+	It("should publish the supported values in the OpenAPI schema", func() {
+		definitions := GetOpenAPIDefinitions(func(path string) spec.Ref { return spec.MustCreateRef(path) })
+		properties := definitions[policyReportResultDefinition].Schema.Properties
+		Expect(properties["result"].Enum).To(ConsistOf("pass", "fail", "warn", "error", "skip"))
+		Expect(properties["severity"].Enum).To(ConsistOf("critical", "high", "medium", "low", "info"))
+		Expect(definitions[policyReportDefinition].Schema.Properties).NotTo(HaveKey("configuration"))
+	})
+})
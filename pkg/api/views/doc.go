@@ -0,0 +1,6 @@
+// Package views defines the read-only resources policy-server computes from
+// the reports it stores. They are served in the wgpolicyk8s.io group, next to
+// the reports.
+// +k8s:openapi-gen=true
+// +k8s:deepcopy-gen=package
+package views
@@ -0,0 +1,307 @@
+package views
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// AddToScheme registers the views in the group version of the reports.
+func AddToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(v1alpha2.SchemeGroupVersion,
+		&PolicyResult{},
+		&PolicyResultList{},
+		&ClusterPolicyResult{},
+		&ClusterPolicyResultList{},
+		&NamespacePolicySummary{},
+		&NamespacePolicySummaryList{},
+		&ClusterPolicySummary{},
+		&ClusterPolicySummaryList{},
+		&PolicySummary{},
+		&PolicySummaryList{},
+		&ResourceReport{},
+		&ResourceReportList{},
+		&ClusterResourceReport{},
+		&ClusterResourceReportList{},
+		&PolicyReportResults{},
+	)
+	return nil
+}
+
+// PolicyResult is a result of a PolicyReport. It is named after its report and
+// its position in the report, and carries the labels of the report.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type PolicyResult struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Report references the report holding the result.
+	Report corev1.ObjectReference `json:"report"`
+
+	// Scope is the scope of the report, if any.
+	// +optional
+	Scope *corev1.ObjectReference `json:"scope,omitempty"`
+
+	// Result is the result, as found in the report.
+	Result v1alpha2.PolicyReportResult `json:"result"`
+}
+
+// PolicyResultList is a list of results.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type PolicyResultList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []PolicyResult `json:"items"`
+}
+
+// ClusterPolicyResult is a result of a ClusterPolicyReport, named as policy
+// results are.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterPolicyResult struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Report references the report holding the result.
+	Report corev1.ObjectReference `json:"report"`
+
+	// Scope is the scope of the report, if any.
+	// +optional
+	Scope *corev1.ObjectReference `json:"scope,omitempty"`
+
+	// Result is the result, as found in the report.
+	Result v1alpha2.PolicyReportResult `json:"result"`
+}
+
+// ClusterPolicyResultList is a list of cluster results.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterPolicyResultList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ClusterPolicyResult `json:"items"`
+}
+
+// NamespacePolicySummary totals the results of the policy reports of a
+// namespace. It is named after its namespace, and exists as long as the
+// namespace holds reports.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NamespacePolicySummary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Reports is the number of policy reports in the namespace.
+	Reports int64 `json:"reports"`
+
+	// Summary totals the results of the policy reports in the namespace.
+	Summary v1alpha2.PolicyReportSummary `json:"summary"`
+}
+
+// NamespacePolicySummaryList is a list of namespace summaries.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type NamespacePolicySummaryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []NamespacePolicySummary `json:"items"`
+}
+
+// ClusterPolicySummary totals the results of every report of the cluster,
+// policy reports and cluster policy reports. There is a single summary, named
+// cluster.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterPolicySummary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Reports is the number of reports in the cluster.
+	Reports int64 `json:"reports"`
+
+	// Summary totals the results of the reports in the cluster.
+	Summary v1alpha2.PolicyReportSummary `json:"summary"`
+}
+
+// ClusterPolicySummaryList is a list of cluster summaries.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterPolicySummaryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ClusterPolicySummary `json:"items"`
+}
+
+// PolicySummary totals the results of a policy across the reports of the
+// cluster, by rule and namespace. It is named after its policy, with the
+// characters not allowed in names replaced and a hash of the policy appended,
+// and exists as long as reports hold results of the policy.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type PolicySummary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Policy is the name of the policy.
+	Policy string `json:"policy"`
+
+	// Summary totals the results of the policy.
+	Summary v1alpha2.PolicyReportSummary `json:"summary"`
+
+	// Rules total the results of each rule of the policy, sorted by rule.
+	// +optional
+	Rules []PolicyRuleSummary `json:"rules,omitempty"`
+}
+
+// PolicyRuleSummary totals the results of a rule of a policy.
+type PolicyRuleSummary struct {
+	// Rule is the name of the rule, empty for results without one.
+	// +optional
+	Rule string `json:"rule,omitempty"`
+
+	// Summary totals the results of the rule.
+	Summary v1alpha2.PolicyReportSummary `json:"summary"`
+
+	// Namespaces total the results of the rule in each namespace, sorted by
+	// namespace.
+	// +optional
+	Namespaces []PolicyNamespaceSummary `json:"namespaces,omitempty"`
+}
+
+// PolicyNamespaceSummary totals the results of a rule in a namespace.
+type PolicyNamespaceSummary struct {
+	// Namespace is the namespace of the reports, empty for cluster reports.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Summary totals the results of the rule in the namespace.
+	Summary v1alpha2.PolicyReportSummary `json:"summary"`
+}
+
+// PolicySummaryList is a list of policy summaries.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type PolicySummaryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []PolicySummary `json:"items"`
+}
+
+// ResourceReport merges the results every report holds about a namespaced
+// resource, the scope of the report or one of the resources of a result. It is
+// named after the UID of the resource, or after its kind, API group and name,
+// as deployment.apps:nginx, when no report knows its UID, in the namespace of
+// the resource. Results which do not name the UID of their resource are merged
+// into the reports of every resource of that kind and name with a known UID.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ResourceReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Resource references the resource, with its UID when a report knows it.
+	Resource corev1.ObjectReference `json:"resource"`
+
+	// Summary totals the results about the resource.
+	Summary v1alpha2.PolicyReportSummary `json:"summary"`
+
+	// Results are the results about the resource, in the order of their
+	// reports.
+	// +optional
+	Results []ResourceResult `json:"results,omitempty"`
+}
+
+// ResourceResult is a result about a resource, with the report holding it.
+type ResourceResult struct {
+	// Report references the report holding the result.
+	Report corev1.ObjectReference `json:"report"`
+
+	// Result is the result, as found in the report.
+	Result v1alpha2.PolicyReportResult `json:"result"`
+}
+
+// ResourceReportList is a list of resource reports.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ResourceReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ResourceReport `json:"items"`
+}
+
+// ClusterResourceReport merges the results every report holds about a
+// cluster-scoped resource, named as resource reports are.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterResourceReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Resource references the resource, with its UID when a report knows it.
+	Resource corev1.ObjectReference `json:"resource"`
+
+	// Summary totals the results about the resource.
+	Summary v1alpha2.PolicyReportSummary `json:"summary"`
+
+	// Results are the results about the resource, in the order of their
+	// reports.
+	// +optional
+	Results []ResourceResult `json:"results,omitempty"`
+}
+
+// ClusterResourceReportList is a list of cluster resource reports.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type ClusterResourceReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ClusterResourceReport `json:"items"`
+}
+
+// PolicyReportResults deletes and upserts results of a report in a single
+// write, when posted to the results subresource of a policy report or a
+// cluster policy report. Results are identified by their policy, rule and
+// resources.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type PolicyReportResults struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Delete identifies the results to remove from the report, results
+	// missing from the report are ignored.
+	// +optional
+	Delete []PolicyResultKey `json:"delete,omitempty"`
+
+	// Upsert are the results to add to the report once the deletions are
+	// applied. Each replaces the result with the same policy, rule and
+	// resources if the report has one.
+	// +optional
+	Upsert []v1alpha2.PolicyReportResult `json:"upsert,omitempty"`
+}
+
+// PolicyResultKey identifies a result of a report.
+type PolicyResultKey struct {
+	// Policy is the policy of the result.
+	Policy string `json:"policy"`
+
+	// Rule is the rule of the result, if any.
+	// +optional
+	Rule string `json:"rule,omitempty"`
+
+	// Resources are the resources of the result, in order. A resource
+	// matches by kind, namespace and name, and by UID when both have one.
+	// +optional
+	Resources []corev1.ObjectReference `json:"resources,omitempty"`
+}
+
+// String returns the policy, rule and resources of the key, without their
+// UIDs.
+func (k *PolicyResultKey) String() string {
+	var b strings.Builder
+	b.WriteString(k.Policy)
+	b.WriteString("/")
+	b.WriteString(k.Rule)
+	for _, resource := range k.Resources {
+		fmt.Fprintf(&b, "/%s:%s:%s", resource.Kind, resource.Namespace, resource.Name)
+	}
+	return b.String()
+}
@@ -0,0 +1,397 @@
+// Package backup dumps the policy reports of a storage backend to a portable
+// archive and loads them back, possibly into another backend.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/k3s-io/kine/pkg/client"
+	"github.com/kyverno/policy-server/pkg/api"
+	"github.com/kyverno/policy-server/pkg/storage"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+	"sigs.k8s.io/yaml"
+)
+
+// Format is the format of an archive.
+type Format string
+
+const (
+	// NDJSON archives hold one report per line, as JSON.
+	NDJSON Format = "ndjson"
+	// Tar archives hold a multi-document YAML file per namespace, and one for
+	// the cluster policy reports.
+	Tar Format = "tar"
+)
+
+const (
+	clusterFile    = "cluster.yaml"
+	namespacesDir  = "namespaces"
+	yamlSeparator  = "---\n"
+	maxLineSizeMiB = 64
+	// pageSize is the number of reports listed from the store at a time.
+	pageSize = 500
+)
+
+// Formats lists the supported archive formats.
+var Formats = []Format{NDJSON, Tar}
+
+// RestoreResult counts the reports handled by Restore.
+type RestoreResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// Backup writes every report of store to w in the given format. The reports
+// are listed in pages at a single revision of the store, so the archive is a
+// consistent view of it, and written one at a time. It returns the number of
+// reports written.
+func Backup(ctx context.Context, store storage.Storage, w io.Writer, format Format) (int, error) {
+	var archive archiveWriter
+	switch format {
+	case NDJSON:
+		archive = &ndjsonWriter{w: w}
+	case Tar:
+		archive = &tarWriter{tw: tar.NewWriter(w), now: time.Now()}
+	default:
+		return 0, fmt.Errorf("unsupported format %q", format)
+	}
+	defer archive.Abort()
+
+	revision, err := store.Revision(ctx)
+	if err != nil {
+		return 0, err
+	}
+	klog.InfoS("Backing up reports", "revision", revision)
+	count := 0
+	err = storage.ListPages(ctx, store, api.KeyRoot(), revision, pageSize, func(vals []client.Value) error {
+		for _, val := range vals {
+			report, err := decode(val)
+			if err != nil {
+				return err
+			}
+			if report == nil {
+				continue
+			}
+			if err := archive.Write(report); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, archive.Close()
+}
+
+// Restore loads the reports of the archive read from r into store one at a
+// time, see Load.
+func Restore(ctx context.Context, store storage.Storage, r io.Reader, format Format) (RestoreResult, error) {
+	l := &loader{store: store}
+	load := func(report *unstructured.Unstructured) error {
+		return l.load(ctx, report)
+	}
+	var err error
+	switch format {
+	case NDJSON:
+		err = readNDJSON(r, load)
+	case Tar:
+		err = readTar(r, load)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	return l.result, err
+}
+
+// Load creates or updates reports in store. Reports already holding the same
+// content are left untouched, so loading them twice has the same effect as
+// loading them once.
+func Load(ctx context.Context, store storage.Storage, reports []*unstructured.Unstructured) (RestoreResult, error) {
+	l := &loader{store: store}
+	for _, report := range reports {
+		if err := l.load(ctx, report); err != nil {
+			return l.result, err
+		}
+	}
+	return l.result, nil
+}
+
+// loader loads reports into a store and counts them.
+type loader struct {
+	store  storage.Storage
+	result RestoreResult
+}
+
+func (l *loader) load(ctx context.Context, report *unstructured.Unstructured) error {
+	key, err := keyFor(report)
+	if err != nil {
+		return err
+	}
+	// the resource version is the revision of the backend it was read from
+	report.SetResourceVersion("")
+	data, err := report.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	existing, err := l.store.Get(ctx, key)
+	switch {
+	case errors.Is(err, client.ErrNotFound) || apierrors.IsNotFound(err):
+		if err := l.store.Create(ctx, key, data); err != nil {
+			return fmt.Errorf("failed to load %s: %w", key, err)
+		}
+		l.result.Created++
+	case err != nil:
+		return fmt.Errorf("failed to load %s: %w", key, err)
+	case unchanged(existing, report):
+		l.result.Unchanged++
+	default:
+		if err := l.store.Update(ctx, key, existing.Modified, data); err != nil {
+			return fmt.Errorf("failed to load %s: %w", key, err)
+		}
+		l.result.Updated++
+	}
+	return nil
+}
+
+// decode returns the report stored in val, with its type set so that the
+// archive is readable on its own. Values of other resources are skipped.
+func decode(val client.Value) (*unstructured.Unstructured, error) {
+	var kind string
+	switch path.Base(path.Dir(string(val.Key))) {
+	case "policyreports":
+		kind = "PolicyReport"
+	case "clusterpolicyreports":
+		kind = "ClusterPolicyReport"
+	default:
+		return nil, nil
+	}
+
+	// stored reports may lack their type, which the unstructured decoder requires
+	report := &unstructured.Unstructured{}
+	if err := utiljson.Unmarshal(val.Data, &report.Object); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", val.Key, err)
+	}
+	report.SetAPIVersion(v1alpha2.SchemeGroupVersion.String())
+	report.SetKind(kind)
+	report.SetResourceVersion("")
+	return report, nil
+}
+
+// unchanged reports whether the stored value already holds report.
+func unchanged(val client.Value, report *unstructured.Unstructured) bool {
+	current, err := decode(val)
+	return err == nil && current != nil && equality.Semantic.DeepEqual(current.Object, report.Object)
+}
+
+func keyFor(report *unstructured.Unstructured) (string, error) {
+	if report.GetAPIVersion() != v1alpha2.SchemeGroupVersion.String() {
+		return "", fmt.Errorf("unsupported apiVersion %q of %s", report.GetAPIVersion(), report.GetName())
+	}
+	if len(report.GetName()) == 0 {
+		return "", fmt.Errorf("report without a name")
+	}
+	switch report.GetKind() {
+	case "PolicyReport":
+		if len(report.GetNamespace()) == 0 {
+			return "", fmt.Errorf("policy report %s without a namespace", report.GetName())
+		}
+		return api.PolicyReportKey(report.GetNamespace(), report.GetName()), nil
+	case "ClusterPolicyReport":
+		return api.ClusterPolicyReportKey(report.GetName()), nil
+	default:
+		return "", fmt.Errorf("unsupported kind %q of %s", report.GetKind(), report.GetName())
+	}
+}
+
+// archiveWriter writes the reports of a backup to an archive, in the order of
+// their keys.
+type archiveWriter interface {
+	Write(report *unstructured.Unstructured) error
+	// Close completes the archive.
+	Close() error
+	// Abort releases what the writer holds, once the archive is complete or
+	// the backup failed.
+	Abort()
+}
+
+type ndjsonWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonWriter) Write(report *unstructured.Unstructured) error {
+	data, err := report.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	_, err = n.w.Write(append(data, '\n'))
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+func (n *ndjsonWriter) Abort() {}
+
+// tarWriter writes a YAML file per namespace. The size of a file is written
+// before its content, so the documents of the current file are spooled to a
+// temporary file until the reports of the next one come. Reports come in the
+// order of their keys, which groups them by namespace.
+type tarWriter struct {
+	tw    *tar.Writer
+	now   time.Time
+	name  string
+	spool *os.File
+}
+
+func (t *tarWriter) Write(report *unstructured.Unstructured) error {
+	name := clusterFile
+	if len(report.GetNamespace()) != 0 {
+		name = path.Join(namespacesDir, report.GetNamespace()+".yaml")
+	}
+	if name != t.name {
+		if err := t.flush(); err != nil {
+			return err
+		}
+		t.name = name
+	}
+	if t.spool == nil {
+		spool, err := os.CreateTemp("", "policy-server-backup-")
+		if err != nil {
+			return err
+		}
+		t.spool = spool
+	}
+	data, err := yaml.Marshal(report.Object)
+	if err != nil {
+		return err
+	}
+	if _, err := t.spool.WriteString(yamlSeparator); err != nil {
+		return err
+	}
+	_, err = t.spool.Write(data)
+	return err
+}
+
+// flush writes the spooled file to the archive.
+func (t *tarWriter) flush() error {
+	if t.spool == nil {
+		return nil
+	}
+	size, err := t.spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		return nil
+	}
+	if _, err := t.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := t.tw.WriteHeader(&tar.Header{Name: t.name, Mode: 0o644, Size: size, ModTime: t.now}); err != nil {
+		return err
+	}
+	if _, err := io.CopyN(t.tw, t.spool, size); err != nil {
+		return err
+	}
+	if _, err := t.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return t.spool.Truncate(0)
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.flush(); err != nil {
+		return err
+	}
+	return t.tw.Close()
+}
+
+func (t *tarWriter) Abort() {
+	if t.spool != nil {
+		t.spool.Close()
+		os.Remove(t.spool.Name())
+		t.spool = nil
+	}
+}
+
+// readNDJSON calls load with each report of r, one line at a time.
+func readNDJSON(r io.Reader, load func(*unstructured.Unstructured) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSizeMiB<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		report := &unstructured.Unstructured{}
+		if err := report.UnmarshalJSON(scanner.Bytes()); err != nil {
+			return fmt.Errorf("invalid report at line %d: %w", line, err)
+		}
+		if err := load(report); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readTar calls load with each report of the YAML files of r, one document at
+// a time.
+func readTar(r io.Reader, load func(*unstructured.Unstructured) error) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || path.Ext(header.Name) != ".yaml" {
+			continue
+		}
+		documents := utilyaml.NewYAMLReader(bufio.NewReader(tr))
+		for i := 0; ; i++ {
+			doc, err := documents.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("invalid document %d of %s: %w", i, header.Name, err)
+			}
+			if len(bytes.TrimSpace(doc)) == 0 {
+				continue
+			}
+			data, err := yaml.YAMLToJSON(doc)
+			if err != nil {
+				return fmt.Errorf("invalid report in document %d of %s: %w", i, header.Name, err)
+			}
+			// documents holding only comments or a separator are empty
+			if bytes.Equal(data, []byte("null")) {
+				continue
+			}
+			report := &unstructured.Unstructured{}
+			if err := report.UnmarshalJSON(data); err != nil {
+				return fmt.Errorf("invalid report in document %d of %s: %w", i, header.Name, err)
+			}
+			if err := load(report); err != nil {
+				return err
+			}
+		}
+	}
+}
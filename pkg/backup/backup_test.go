@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/api"
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+func TestBackup(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Backup Test")
+}
+
+var _ = Describe("Backup", func() {
+	ctx := context.Background()
+
+	var store storage.Storage
+	BeforeEach(func() {
+		store = inmemory.New()
+		for _, ns := range []string{"a", "b"} {
+			polr := v1alpha2.PolicyReport{
+				ObjectMeta: metav1.ObjectMeta{Name: "polr", Namespace: ns, UID: types.UID("uid-" + ns)},
+				Summary:    v1alpha2.PolicyReportSummary{Pass: 2},
+			}
+			data, err := json.Marshal(polr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.Create(ctx, api.PolicyReportKey(ns, "polr"), data)).To(Succeed())
+		}
+		data, err := json.Marshal(v1alpha2.ClusterPolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "cpolr"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Create(ctx, api.ClusterPolicyReportKey("cpolr"), data)).To(Succeed())
+	})
+
+	for _, format := range Formats {
+		format := format
+		It("should restore a "+string(format)+" backup idempotently", func() {
+			archive := &bytes.Buffer{}
+			count, err := Backup(ctx, store, archive, format)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(3))
+
+			target := inmemory.New()
+			result, err := Restore(ctx, target, bytes.NewReader(archive.Bytes()), format)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(RestoreResult{Created: 3}))
+
+			val, err := target.Get(ctx, api.PolicyReportKey("b", "polr"))
+			Expect(err).NotTo(HaveOccurred())
+			var polr v1alpha2.PolicyReport
+			Expect(json.Unmarshal(val.Data, &polr)).To(Succeed())
+			Expect(string(polr.UID)).To(Equal("uid-b"))
+			Expect(polr.Summary.Pass).To(Equal(2))
+
+			for _, s := range []storage.Storage{target, store} {
+				result, err = Restore(ctx, s, bytes.NewReader(archive.Bytes()), format)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(RestoreResult{Unchanged: 3}))
+			}
+		})
+	}
+
+	It("should restore values holding document separators", func() {
+		polr := v1alpha2.PolicyReport{
+			ObjectMeta: metav1.ObjectMeta{Name: "separator", Namespace: "a"},
+			Results:    []*v1alpha2.PolicyReportResult{{Policy: "p", Result: "fail", Description: "a\n---\nb\n---\n"}},
+		}
+		data, err := json.Marshal(polr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Create(ctx, api.PolicyReportKey("a", "separator"), data)).To(Succeed())
+
+		archive := &bytes.Buffer{}
+		_, err = Backup(ctx, store, archive, Tar)
+		Expect(err).NotTo(HaveOccurred())
+		target := inmemory.New()
+		result, err := Restore(ctx, target, archive, Tar)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(RestoreResult{Created: 4}))
+
+		val, err := target.Get(ctx, api.PolicyReportKey("a", "separator"))
+		Expect(err).NotTo(HaveOccurred())
+		var restored v1alpha2.PolicyReport
+		Expect(json.Unmarshal(val.Data, &restored)).To(Succeed())
+		Expect(restored.Results[0].Description).To(Equal("a\n---\nb\n---\n"))
+	})
+})
@@ -0,0 +1,329 @@
+// Package gc deletes the reports whose scope or owners no longer exist. The
+// kube garbage collector does not handle the objects of aggregated API
+// servers, so policy-server collects its reports itself.
+package gc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kyverno/policy-server/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// syncTimeout bounds how long a collection waits for the informer of a scope
+// kind to sync. References to kinds which did not sync are kept alive, and
+// the informer is started again by the next collection.
+const syncTimeout = 30 * time.Second
+
+// reference is an object a report depends on.
+type reference struct {
+	apiVersion string
+	kind       string
+	namespace  string
+	name       string
+	uid        types.UID
+}
+
+// Collector deletes the reports of its stores once every object they
+// reference, their scope and their owners, is gone. Reports without any
+// reference are never collected.
+type Collector struct {
+	client metadata.Interface
+	mapper meta.RESTMapper
+	stores []api.API
+
+	lock      sync.Mutex
+	started   bool
+	informers map[schema.GroupVersionResource]*informer
+	// skipped are the resources whose informers failed or did not sync during
+	// the current collection, which are not waited on again.
+	skipped map[schema.GroupVersionResource]bool
+	running sync.WaitGroup
+}
+
+// informer is the informer of a resource, which runs until it is stopped.
+type informer struct {
+	cache.SharedIndexInformer
+	stop context.CancelFunc
+	// failed is closed when listing the resource failed before it synced.
+	failed     chan struct{}
+	failedOnce sync.Once
+}
+
+// New returns a collector looking up the referenced objects with client,
+// through informers on their kinds.
+func New(client metadata.Interface, mapper meta.RESTMapper, stores ...api.API) *Collector {
+	return &Collector{
+		client: client,
+		mapper: mapper,
+		stores: stores,
+	}
+}
+
+// Task returns a loop collecting the orphaned reports every interval until
+// ctx is done. The informers it starts live as long as the loop.
+func (c *Collector) Task(interval time.Duration) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		c.start()
+		defer c.stop()
+		wait.UntilWithContext(ctx, func(ctx context.Context) {
+			if err := c.Collect(ctx); err != nil {
+				klog.ErrorS(err, "failed to collect orphaned reports")
+			}
+		}, interval)
+	}
+}
+
+// Collect deletes the orphaned reports of every store once. Reports are
+// deleted through the stores, so that watchers see the deletions.
+func (c *Collector) Collect(ctx context.Context) error {
+	c.lock.Lock()
+	started := c.started
+	c.skipped = make(map[schema.GroupVersionResource]bool)
+	c.lock.Unlock()
+	if !started {
+		c.start()
+		defer c.stop()
+	}
+	// kinds installed since the last collection are mapped from fresh discovery
+	if mapper, ok := c.mapper.(meta.ResettableRESTMapper); ok {
+		mapper.Reset()
+	}
+	for _, store := range c.stores {
+		list, err := store.List(genericapirequest.WithNamespace(ctx, metav1.NamespaceAll), &metainternalversion.ListOptions{})
+		if err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := c.collect(ctx, store, item); err != nil {
+				klog.ErrorS(err, "failed to collect report", "kind", store.Kind())
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Collector) collect(ctx context.Context, store api.API, report runtime.Object) error {
+	accessor, err := meta.Accessor(report)
+	if err != nil {
+		return err
+	}
+	references := referencesOf(report, accessor)
+	if len(references) == 0 {
+		return nil
+	}
+	for _, ref := range references {
+		if c.exists(ctx, ref) {
+			return nil
+		}
+	}
+
+	// the preconditions keep reports updated since they were listed
+	options := &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{
+		UID:             ptr.To(accessor.GetUID()),
+		ResourceVersion: ptr.To(accessor.GetResourceVersion()),
+	}}
+	_, _, err = store.Delete(genericapirequest.WithNamespace(ctx, accessor.GetNamespace()), accessor.GetName(), rest.ValidateAllObjectFunc, options)
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete report %s: %w", klog.KObj(accessor), err)
+	}
+	klog.V(2).InfoS("Deleted orphaned report", "kind", store.Kind(), "report", klog.KObj(accessor))
+	return nil
+}
+
+// exists reports whether the object referenced by ref exists. When this can't
+// be told, because its kind is unknown or can't be listed, it is assumed to.
+// Objects missing from the informer are looked up live, as it may not have
+// observed objects created since it synced.
+func (c *Collector) exists(ctx context.Context, ref reference) bool {
+	gv, err := schema.ParseGroupVersion(ref.apiVersion)
+	if err != nil || len(ref.kind) == 0 || len(ref.name) == 0 {
+		return true
+	}
+	mapping, err := c.mapper.RESTMapping(gv.WithKind(ref.kind).GroupKind(), gv.Version)
+	if err != nil {
+		klog.V(4).InfoS("Unknown kind of report reference", "apiVersion", ref.apiVersion, "kind", ref.kind, "err", err)
+		return true
+	}
+	informer, ok := c.informerFor(ctx, mapping.Resource)
+	if !ok {
+		return true
+	}
+
+	key := ref.name
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		key = ref.namespace + "/" + ref.name
+	}
+	obj, found, err := informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return true
+	}
+	if found {
+		object, err := meta.Accessor(obj)
+		if err != nil || len(ref.uid) == 0 || object.GetUID() == ref.uid {
+			return true
+		}
+	}
+
+	resource := c.client.Resource(mapping.Resource)
+	var object *metav1.PartialObjectMetadata
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		object, err = resource.Namespace(ref.namespace).Get(ctx, ref.name, metav1.GetOptions{})
+	} else {
+		object, err = resource.Get(ctx, ref.name, metav1.GetOptions{})
+	}
+	if errors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		klog.V(4).InfoS("Failed to get report reference", "resource", mapping.Resource, "name", ref.name, "err", err)
+		return true
+	}
+	return len(ref.uid) == 0 || object.UID == ref.uid
+}
+
+// informerFor returns the synced informer of resource, starting it first if
+// needed. Informers which fail to list the resource or do not sync within
+// syncTimeout are stopped and skipped for the rest of the collection.
+func (c *Collector) informerFor(ctx context.Context, resource schema.GroupVersionResource) (cache.SharedIndexInformer, bool) {
+	c.lock.Lock()
+	if c.skipped[resource] {
+		c.lock.Unlock()
+		return nil, false
+	}
+	i, ok := c.informers[resource]
+	if !ok {
+		i = c.run(resource)
+		c.informers[resource] = i
+	}
+	c.lock.Unlock()
+
+	if i.HasSynced() {
+		return i, true
+	}
+	ctx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-i.failed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if cache.WaitForCacheSync(ctx.Done(), i.HasSynced) {
+		return i, true
+	}
+	klog.InfoS("Informer of report references did not sync", "resource", resource)
+	c.lock.Lock()
+	c.skipped[resource] = true
+	if c.informers[resource] == i {
+		delete(c.informers, resource)
+	}
+	c.lock.Unlock()
+	i.stop()
+	return nil, false
+}
+
+// run starts the informer of resource, c.lock is held.
+func (c *Collector) run(resource schema.GroupVersionResource) *informer {
+	ctx, cancel := context.WithCancel(context.Background())
+	i := &informer{
+		SharedIndexInformer: metadatainformer.NewFilteredMetadataInformer(c.client, resource, metav1.NamespaceAll, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil).Informer(),
+		stop:                cancel,
+		failed:              make(chan struct{}),
+	}
+	_ = i.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+		if !i.HasSynced() {
+			i.failedOnce.Do(func() { close(i.failed) })
+		}
+	})
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		i.Run(ctx.Done())
+	}()
+	return i
+}
+
+func (c *Collector) start() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.started = true
+	c.informers = make(map[schema.GroupVersionResource]*informer)
+}
+
+// stop stops the informers and waits for them to return.
+func (c *Collector) stop() {
+	c.lock.Lock()
+	for _, i := range c.informers {
+		i.stop()
+	}
+	c.started, c.informers = false, nil
+	c.lock.Unlock()
+
+	c.running.Wait()
+}
+
+// referencesOf returns the scope and the owners of report. Namespaced objects
+// are referenced in the namespace of the report unless its scope tells otherwise.
+func referencesOf(report runtime.Object, accessor metav1.Object) []reference {
+	var references []reference
+	var scope *corev1.ObjectReference
+	switch r := report.(type) {
+	case *v1alpha2.PolicyReport:
+		scope = r.Scope
+	case *v1alpha2.ClusterPolicyReport:
+		scope = r.Scope
+	}
+	if scope != nil {
+		namespace := scope.Namespace
+		if len(namespace) == 0 {
+			namespace = accessor.GetNamespace()
+		}
+		references = append(references, reference{
+			apiVersion: scope.APIVersion,
+			kind:       scope.Kind,
+			namespace:  namespace,
+			name:       scope.Name,
+			uid:        scope.UID,
+		})
+	}
+	for _, owner := range accessor.GetOwnerReferences() {
+		references = append(references, reference{
+			apiVersion: owner.APIVersion,
+			kind:       owner.Kind,
+			namespace:  accessor.GetNamespace(),
+			name:       owner.Name,
+			uid:        owner.UID,
+		})
+	}
+	return references
+}
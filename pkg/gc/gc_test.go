@@ -0,0 +1,161 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/api"
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+func TestGC(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "GC Test")
+}
+
+var _ = Describe("Collector", func() {
+	object := func(kind, namespace, name string, uid types.UID) runtime.Object {
+		return &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: kind},
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: uid},
+		}
+	}
+	names := func(store api.API) []string {
+		list, err := store.List(genericapirequest.WithNamespace(context.Background(), ""), &metainternalversion.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		items, err := meta.ExtractList(list)
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, item := range items {
+			accessor, err := meta.Accessor(item)
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, accessor.GetName())
+		}
+		return names
+	}
+
+	It("should delete the reports whose scope and owners are gone", func() {
+		ctx := genericapirequest.WithNamespace(context.Background(), "default")
+		backend := inmemory.New()
+		polr, err := api.PolicyReportStore(backend, storage.NewUsage("policyreports"), api.Quota{}, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		defer polr.Destroy()
+		cpolr, err := api.ClusterPolicyReportStore(backend, storage.NewUsage("clusterpolicyreports"), api.Quota{}, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		defer cpolr.Destroy()
+
+		pod := func(name string, uid types.UID) *corev1.ObjectReference {
+			return &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "default", Name: name, UID: uid}
+		}
+		for _, report := range []*v1alpha2.PolicyReport{
+			{ObjectMeta: metav1.ObjectMeta{Name: "live"}, Scope: pod("live", "1")},
+			{ObjectMeta: metav1.ObjectMeta{Name: "deleted"}, Scope: pod("deleted", "2")},
+			// a pod recreated under the same name is another pod
+			{ObjectMeta: metav1.ObjectMeta{Name: "recreated"}, Scope: pod("recreated", "3")},
+			{ObjectMeta: metav1.ObjectMeta{Name: "unscoped"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "unknown"}, Scope: &corev1.ObjectReference{APIVersion: "example.com/v1", Kind: "Unknown", Name: "x"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "owned", OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "v1", Kind: "Pod", Name: "deleted", UID: "2"},
+				{APIVersion: "v1", Kind: "Pod", Name: "live", UID: "1"},
+			}}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "orphan", OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "v1", Kind: "Pod", Name: "deleted", UID: "2"},
+			}}},
+		} {
+			_, err := polr.Create(ctx, report, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		for _, report := range []*v1alpha2.ClusterPolicyReport{
+			{ObjectMeta: metav1.ObjectMeta{Name: "live"}, Scope: &corev1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: "default"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "deleted"}, Scope: &corev1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: "deleted"}},
+		} {
+			_, err := cpolr.Create(ctx, report, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		scheme := fake.NewTestScheme()
+		Expect(metav1.AddMetaToScheme(scheme)).To(Succeed())
+		client := fake.NewSimpleMetadataClient(scheme,
+			object("Pod", "default", "live", "1"),
+			object("Pod", "default", "recreated", "4"),
+			object("Namespace", "", "default", "5"),
+		)
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+
+		Expect(New(client, mapper, polr, cpolr).Collect(context.Background())).To(Succeed())
+
+		Eventually(func() []string { return names(polr) }).Should(ConsistOf("live", "unscoped", "unknown", "owned"))
+		Eventually(func() []string { return names(cpolr) }).Should(ConsistOf("live"))
+	})
+
+	It("should keep the reports about objects its informers did not observe yet", func() {
+		ctx := genericapirequest.WithNamespace(context.Background(), "default")
+		polr, err := api.PolicyReportStore(inmemory.New(), storage.NewUsage("policyreports"), api.Quota{}, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		defer polr.Destroy()
+		for _, name := range []string{"created", "deleted"} {
+			report := &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: name}, Scope: &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "default", Name: name}}
+			_, err := polr.Create(ctx, report, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		scheme := fake.NewTestScheme()
+		Expect(metav1.AddMetaToScheme(scheme)).To(Succeed())
+		client := fake.NewSimpleMetadataClient(scheme, object("Pod", "default", "created", "1"))
+		// the pod is created after the informer listed the pods
+		client.PrependReactor("list", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			return true, &metav1.List{}, nil
+		})
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+
+		Expect(New(client, mapper, polr).Collect(context.Background())).To(Succeed())
+
+		Eventually(func() []string { return names(polr) }).Should(ConsistOf("created"))
+	})
+
+	It("should skip the kinds it fails to list for the rest of the collection", func() {
+		ctx := genericapirequest.WithNamespace(context.Background(), "default")
+		polr, err := api.PolicyReportStore(inmemory.New(), storage.NewUsage("policyreports"), api.Quota{}, nil, false)
+		Expect(err).NotTo(HaveOccurred())
+		defer polr.Destroy()
+		for _, name := range []string{"a", "b"} {
+			report := &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: name}, Scope: &corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "default", Name: name}}
+			_, err := polr.Create(ctx, report, rest.ValidateAllObjectFunc, &metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		scheme := fake.NewTestScheme()
+		Expect(metav1.AddMetaToScheme(scheme)).To(Succeed())
+		client := fake.NewSimpleMetadataClient(scheme)
+		client.PrependReactor("list", "pods", func(action clienttesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(corev1.Resource("pods"), "", nil)
+		})
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Pod"), meta.RESTScopeNamespace)
+
+		start := time.Now()
+		Expect(New(client, mapper, polr).Collect(context.Background())).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", syncTimeout))
+		Expect(names(polr)).To(ConsistOf("a", "b"))
+	})
+})
@@ -0,0 +1,68 @@
+// Package importer copies the policy reports stored as custom resources by the
+// Kubernetes API server into policy-server storage, so that switching the
+// wgpolicyk8s.io group from its CRDs to the aggregated API keeps the reports.
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kyverno/policy-server/pkg/backup"
+	"github.com/kyverno/policy-server/pkg/storage"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+// Resources are the custom resources imported, in order.
+var Resources = []string{"policyreports", "clusterpolicyreports"}
+
+// Import reads the reports served by the custom resources through client, a
+// page of pageSize objects at a time, and writes them into store. It must run
+// before the aggregated API takes over the group, the custom resources are not
+// reachable anymore once it did. Reports imported by an earlier run are left
+// untouched, so an interrupted import can be run again.
+func Import(ctx context.Context, client dynamic.Interface, store storage.Storage, pageSize int64) (backup.RestoreResult, error) {
+	var total backup.RestoreResult
+	for _, resource := range Resources {
+		gvr := v1alpha2.SchemeGroupVersion.WithResource(resource)
+		options := metav1.ListOptions{Limit: pageSize}
+		for {
+			list, err := client.Resource(gvr).List(ctx, options)
+			if err != nil {
+				return total, fmt.Errorf("failed to list %s: %w", resource, err)
+			}
+
+			reports := make([]*unstructured.Unstructured, 0, len(list.Items))
+			for i := range list.Items {
+				reports = append(reports, clean(&list.Items[i]))
+			}
+			result, err := backup.Load(ctx, store, reports)
+			total.Created += result.Created
+			total.Updated += result.Updated
+			total.Unchanged += result.Unchanged
+			if err != nil {
+				return total, err
+			}
+			klog.InfoS("Imported reports", "resource", resource, "count", len(reports))
+
+			options.Continue = list.GetContinue()
+			if len(options.Continue) == 0 {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// clean drops the metadata owned by the API server of the custom resources,
+// the name, UID, labels and creation timestamp of the report are kept.
+func clean(report *unstructured.Unstructured) *unstructured.Unstructured {
+	report.SetResourceVersion("")
+	report.SetManagedFields(nil)
+	report.SetGeneration(0)
+	report.SetSelfLink("")
+	return report
+}
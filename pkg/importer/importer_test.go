@@ -0,0 +1,58 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/api"
+	"github.com/kyverno/policy-server/pkg/backup"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+func TestImporter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Importer Test")
+}
+
+var _ = Describe("Import", func() {
+	ctx := context.Background()
+
+	It("should import the reports of the custom resources", func() {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha2.AddToScheme(scheme)).To(Succeed())
+		client := dynamicfake.NewSimpleDynamicClient(scheme,
+			&v1alpha2.PolicyReport{
+				ObjectMeta: metav1.ObjectMeta{Name: "polr", Namespace: "default", UID: "uid", ResourceVersion: "42"},
+				Summary:    v1alpha2.PolicyReportSummary{Fail: 1},
+			},
+			&v1alpha2.ClusterPolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "cpolr"}},
+		)
+		store := inmemory.New()
+
+		result, err := Import(ctx, client, store, 500)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(backup.RestoreResult{Created: 2}))
+
+		val, err := store.Get(ctx, api.PolicyReportKey("default", "polr"))
+		Expect(err).NotTo(HaveOccurred())
+		var polr v1alpha2.PolicyReport
+		Expect(json.Unmarshal(val.Data, &polr)).To(Succeed())
+		Expect(string(polr.UID)).To(Equal("uid"))
+		Expect(polr.ResourceVersion).To(BeEmpty())
+		Expect(polr.Summary.Fail).To(Equal(1))
+		_, err = store.Get(ctx, api.ClusterPolicyReportKey("cpolr"))
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err = Import(ctx, client, store, 500)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(backup.RestoreResult{Unchanged: 2}))
+	})
+})
@@ -0,0 +1,190 @@
+// Package leaderelection elects, among the replicas of policy-server, the one
+// running the background loops which must not run concurrently, such as
+// retention or garbage collection. Every replica keeps serving the API
+// whether it leads or not.
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	componentbaseconfig "k8s.io/component-base/config"
+	"k8s.io/klog/v2"
+)
+
+// Task is a background loop run by the leader until ctx is done.
+type Task func(ctx context.Context)
+
+// Elector runs the registered tasks while this replica holds the lease.
+type Elector struct {
+	sync.Mutex
+
+	config   componentbaseconfig.LeaderElectionConfiguration
+	client   kubernetes.Interface
+	identity string
+	tasks    map[string]Task
+	watchdog *leaderelection.HealthzAdaptor
+}
+
+// DefaultConfiguration returns the default leader election configuration,
+// leader election is enabled so that replicas don't run the tasks
+// concurrently.
+func DefaultConfiguration() componentbaseconfig.LeaderElectionConfiguration {
+	return componentbaseconfig.LeaderElectionConfiguration{
+		LeaderElect:       true,
+		LeaseDuration:     metav1.Duration{Duration: 15 * time.Second},
+		RenewDeadline:     metav1.Duration{Duration: 10 * time.Second},
+		RetryPeriod:       metav1.Duration{Duration: 2 * time.Second},
+		ResourceLock:      resourcelock.LeasesResourceLock,
+		ResourceName:      "policy-server",
+		ResourceNamespace: "kyverno",
+	}
+}
+
+// New returns an elector using a lease described by config. The client is
+// only used when leader election is enabled.
+func New(config componentbaseconfig.LeaderElectionConfiguration, client kubernetes.Interface) (*Elector, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get hostname: %w", err)
+	}
+	return &Elector{
+		config:   config,
+		client:   client,
+		identity: hostname + "_" + string(uuid.NewUUID()),
+		tasks:    make(map[string]Task),
+		// a leader which failed to renew for this long is reported unhealthy
+		watchdog: leaderelection.NewLeaderHealthzAdaptor(20 * time.Second),
+	}, nil
+}
+
+// Add registers a task to run on the leader. Tasks must be added before Run.
+func (e *Elector) Add(name string, task Task) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.tasks[name] = task
+}
+
+// Watchdog is a health check failing when this replica leads without
+// renewing its lease.
+func (e *Elector) Watchdog() *leaderelection.HealthzAdaptor {
+	return e.watchdog
+}
+
+// Run runs for election until ctx is done, running the tasks whenever this
+// replica leads. Without leader election, the tasks run right away.
+func (e *Elector) Run(ctx context.Context) error {
+	if !e.config.LeaderElect {
+		e.runTasks(ctx)
+		return nil
+	}
+
+	lock, err := resourcelock.New(
+		e.config.ResourceLock,
+		e.config.ResourceNamespace,
+		e.config.ResourceName,
+		e.client.CoreV1(),
+		e.client.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: e.identity},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to create resource lock: %w", err)
+	}
+
+	// Losing the lease only stops the tasks, the replica keeps serving and
+	// runs for election again once they returned.
+	for ctx.Err() == nil {
+		t := &term{done: make(chan struct{})}
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   e.config.LeaseDuration.Duration,
+			RenewDeadline:   e.config.RenewDeadline.Duration,
+			RetryPeriod:     e.config.RetryPeriod.Duration,
+			ReleaseOnCancel: true,
+			Name:            e.config.ResourceName,
+			WatchDog:        e.watchdog,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					if !t.start() {
+						return
+					}
+					defer close(t.done)
+					klog.InfoS("Started leading", "identity", e.identity)
+					e.runTasks(ctx)
+				},
+				OnStoppedLeading: func() {
+					klog.InfoS("Stopped leading", "identity", e.identity)
+				},
+				OnNewLeader: func(identity string) {
+					klog.InfoS("New leader elected", "identity", identity)
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		elector.Run(ctx)
+		t.end()
+	}
+	return nil
+}
+
+// term is a run for election. The elector starts the tasks in a goroutine of
+// its own, which may only be scheduled after the term ended.
+type term struct {
+	sync.Mutex
+	started, ended bool
+	// done is closed once the tasks of the term returned.
+	done chan struct{}
+}
+
+// start reports whether the tasks of the term should start, they don't once
+// it ended.
+func (t *term) start() bool {
+	t.Lock()
+	defer t.Unlock()
+	t.started = !t.ended
+	return t.started
+}
+
+// end ends the term and waits for its tasks to return.
+func (t *term) end() {
+	t.Lock()
+	t.ended = true
+	started := t.started
+	t.Unlock()
+	if started {
+		<-t.done
+	}
+}
+
+// runTasks runs every task until ctx is done and they all returned.
+func (e *Elector) runTasks(ctx context.Context) {
+	e.Lock()
+	tasks := make(map[string]Task, len(e.tasks))
+	for name, task := range e.tasks {
+		tasks[name] = task
+	}
+	e.Unlock()
+
+	var wg sync.WaitGroup
+	for name, task := range tasks {
+		wg.Add(1)
+		go func(name string, task Task) {
+			defer wg.Done()
+			klog.V(2).InfoS("Starting leader task", "task", name)
+			task(ctx)
+			klog.V(2).InfoS("Leader task stopped", "task", name)
+		}(name, task)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,76 @@
+package leaderelection
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLeaderElection(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Leader Election Test")
+}
+
+var _ = Describe("Elector", func() {
+	run := func(leaderElect bool) *fake.Clientset {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		config := DefaultConfiguration()
+		config.LeaderElect = leaderElect
+		client := fake.NewSimpleClientset()
+		elector, err := New(config, client)
+		Expect(err).NotTo(HaveOccurred())
+
+		started := make(chan struct{})
+		elector.Add("test", func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+		})
+		done := make(chan error)
+		go func() {
+			done <- elector.Run(ctx)
+		}()
+
+		Eventually(started).Should(BeClosed())
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+		return client
+	}
+
+	It("should run the tasks once it holds the lease", func() {
+		client := run(true)
+		lease, err := client.CoordinationV1().Leases("kyverno").Get(context.Background(), "policy-server", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lease.Spec.HolderIdentity).NotTo(BeNil())
+	})
+
+	It("should run the tasks right away without leader election", func() {
+		client := run(false)
+		leases, err := client.CoordinationV1().Leases("kyverno").List(context.Background(), metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leases.Items).To(BeEmpty())
+	})
+
+	It("should not start the tasks of a term which already ended", func() {
+		t := &term{done: make(chan struct{})}
+		t.end()
+		Expect(t.start()).To(BeFalse())
+
+		t = &term{done: make(chan struct{})}
+		Expect(t.start()).To(BeTrue())
+		ended := make(chan struct{})
+		go func() {
+			defer close(ended)
+			t.end()
+		}()
+		Consistently(ended).ShouldNot(BeClosed())
+		close(t.done)
+		Eventually(ended).Should(BeClosed())
+	})
+})
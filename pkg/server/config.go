@@ -5,10 +5,18 @@ import (
 	"time"
 
 	"github.com/kyverno/policy-server/pkg/api"
+	"github.com/kyverno/policy-server/pkg/gc"
+	"github.com/kyverno/policy-server/pkg/leaderelection"
 	"github.com/kyverno/policy-server/pkg/storage"
 	apimetrics "k8s.io/apiserver/pkg/endpoints/metrics"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	componentbaseconfig "k8s.io/component-base/config"
 	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/legacyregistry"
 	_ "k8s.io/component-base/metrics/prometheus/restclient" // for client-go metrics registration
@@ -17,8 +25,16 @@ import (
 type Config struct {
 	Apiserver        *genericapiserver.Config
 	Rest             *rest.Config
+	Informers        informers.SharedInformerFactory
 	MetricResolution time.Duration
 	Debug            bool
+	GenericRegistry  bool
+	LeaderElection   componentbaseconfig.LeaderElectionConfiguration
+	Quota            api.Quota
+	Rules            *api.Rules
+	ClientSummaries  bool
+	Retention        api.Retention
+	GCInterval       time.Duration
 }
 
 func (c Config) Complete() (*server, error) {
@@ -28,7 +44,11 @@ func (c Config) Complete() (*server, error) {
 	if err != nil {
 		return nil, err
 	}
-	genericServer, err := c.Apiserver.Complete(nil).New("policy-server", genericapiserver.NewEmptyDelegate())
+	// the configuration of reports is read from the body before it is decoded
+	c.Apiserver.BuildHandlerChainFunc = func(handler http.Handler, config *genericapiserver.Config) http.Handler {
+		return genericapiserver.DefaultBuildHandlerChain(api.WithConfiguration(handler), config)
+	}
+	genericServer, err := c.Apiserver.Complete(c.Informers).New("policy-server", genericapiserver.NewEmptyDelegate())
 	if err != nil {
 		return nil, err
 	}
@@ -38,14 +58,44 @@ func (c Config) Complete() (*server, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := api.Install(store, genericServer); err != nil {
+	stores, err := api.Install(store, genericServer, api.Options{
+		GenericRegistry: c.GenericRegistry,
+		Admission:       c.Apiserver.AdmissionControl,
+		Quota:           c.Quota,
+		Rules:           c.Rules,
+		ClientSummaries: c.ClientSummaries,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(c.Rest)
+	if err != nil {
+		return nil, err
+	}
+	elector, err := leaderelection.New(c.LeaderElection, kubeClient)
+	if err != nil {
 		return nil, err
 	}
 
 	s := NewServer(
 		genericServer,
 		store,
+		elector,
 	)
+	s.AddLeaderTask("deletion", api.DeletionTask(stores.PolicyReports, stores.ClusterPolicyReports))
+	if c.Retention.Interval > 0 {
+		s.AddLeaderTask("retention", api.RetentionTask(c.Retention, stores.PolicyReports, stores.ClusterPolicyReports))
+	}
+	if c.GCInterval > 0 {
+		metadataClient, err := metadata.NewForConfig(c.Rest)
+		if err != nil {
+			return nil, err
+		}
+		mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(kubeClient.Discovery()))
+		collector := gc.New(metadataClient, mapper, stores.PolicyReports, stores.ClusterPolicyReports)
+		s.AddLeaderTask("garbage-collection", collector.Task(c.GCInterval))
+	}
 	err = s.RegisterProbes()
 	if err != nil {
 		return nil, err
@@ -4,9 +4,12 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/kyverno/policy-server/pkg/leaderelection"
 	"github.com/kyverno/policy-server/pkg/storage"
 	"github.com/kyverno/policy-server/pkg/utils"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
 
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	"k8s.io/apiserver/pkg/server/healthz"
@@ -37,20 +40,34 @@ func RegisterServerMetrics(registrationFunc func(metrics.Registerable) error, re
 func NewServer(
 	apiserver *genericapiserver.GenericAPIServer,
 	storage storage.Storage,
+	elector *leaderelection.Elector,
 ) *server {
 	return &server{
 		GenericAPIServer: apiserver,
 		storage:          storage,
+		elector:          elector,
 	}
 }
 
 type server struct {
 	*genericapiserver.GenericAPIServer
 	storage storage.Storage
+	elector *leaderelection.Elector
 }
 
-// RunUntil starts background scraping goroutine and runs apiserver serving metrics.
+// AddLeaderTask registers a background loop which only runs on the replica
+// holding the leader election lease.
+func (s *server) AddLeaderTask(name string, task leaderelection.Task) {
+	s.elector.Add(name, task)
+}
+
+// RunUntil runs for leader election in the background and runs apiserver serving metrics.
 func (s *server) RunUntil(stopCh <-chan struct{}) error {
+	go func() {
+		if err := s.elector.Run(wait.ContextForChannel(stopCh)); err != nil {
+			klog.ErrorS(err, "leader election failed")
+		}
+	}()
 	return s.GenericAPIServer.PrepareRun().Run(stopCh)
 }
 
@@ -59,7 +76,7 @@ func (s *server) RegisterProbes() error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return s.AddHealthChecks(s.elector.Watchdog())
 }
 
 func (s *server) probeMetricStorageReady(name string) healthz.HealthChecker {
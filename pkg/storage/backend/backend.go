@@ -0,0 +1,56 @@
+// Package backend defines what policy-server expects from a storage backend
+// on top of the kine client: a stream of the changes made to its keys, so that
+// every replica observes the writes of every other replica.
+package backend
+
+import (
+	"context"
+
+	"github.com/k3s-io/kine/pkg/client"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Event is a change made to a key of the backend. The value of a deletion is
+// the last value of the key, with the revision of the deletion.
+type Event struct {
+	Type  watch.EventType
+	Value client.Value
+}
+
+// Watcher is implemented by backends which can stream their changes.
+type Watcher interface {
+	// Revision returns the current revision of the backend.
+	Revision(ctx context.Context) (int64, error)
+	// Watch streams the changes made to the keys under prefix after revision.
+	// The channel is closed when the stream ends, watchers are expected to
+	// list again and resume from the revision they listed at.
+	Watch(ctx context.Context, prefix string, revision int64) <-chan Event
+}
+
+// Writer is implemented by backends which report the revision of their writes,
+// the modified revision of the written value or the revision of the deletion.
+// Failed writes return NotFound, AlreadyExists and Conflict errors of
+// k8s.io/apimachinery.
+type Writer interface {
+	CreateRevision(ctx context.Context, key string, value []byte) (int64, error)
+	UpdateRevision(ctx context.Context, key string, revision int64, value []byte) (int64, error)
+	DeleteRevision(ctx context.Context, key string, revision int64) (int64, error)
+}
+
+// Pager is implemented by backends which list their keys in pages, so that
+// large prefixes are never held in memory at once.
+type Pager interface {
+	// ListPage returns at most limit values under prefix, sorted by key and
+	// starting at key start, as of revision, or the current one if zero. It
+	// also reports whether more values follow. Revisions which are no longer
+	// kept fail with an expired error.
+	ListPage(ctx context.Context, prefix, start string, revision, limit int64) ([]client.Value, bool, error)
+}
+
+// Client is a storage backend whose changes can be watched.
+type Client interface {
+	client.Client
+	Watcher
+	Writer
+	Pager
+}
@@ -0,0 +1,348 @@
+// Package generic adapts the policy-server storage backends to the
+// k8s.io/apiserver storage.Interface, so resources can be served by the
+// upstream generic registry.
+package generic
+
+import (
+	"context"
+	"errors"
+	"path"
+	"reflect"
+	"sort"
+
+	"github.com/k3s-io/kine/pkg/client"
+	"github.com/kyverno/policy-server/pkg/storage"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	apistorage "k8s.io/apiserver/pkg/storage"
+)
+
+type store struct {
+	client    storage.Storage
+	codec     runtime.Codec
+	versioner apistorage.Versioner
+	resource  string
+	keyFunc   func(obj runtime.Object) (string, error)
+	newFunc   func() runtime.Object
+}
+
+// New returns a storage.Interface for resource on top of client. Objects are
+// encoded with codec and carry the modified revision of the backend as their
+// resource version. Writes are conditional on the revision they were read at,
+// so the writes of other replicas made in between are retried on, the same as
+// with etcd.
+func New(client storage.Storage, codec runtime.Codec, resource string, keyFunc func(obj runtime.Object) (string, error), newFunc func() runtime.Object) apistorage.Interface {
+	return &store{
+		client:    client,
+		codec:     codec,
+		versioner: apistorage.APIObjectVersioner{},
+		resource:  resource,
+		keyFunc:   keyFunc,
+		newFunc:   newFunc,
+	}
+}
+
+func (s *store) Versioner() apistorage.Versioner {
+	return s.versioner
+}
+
+func (s *store) Create(ctx context.Context, key string, obj, out runtime.Object, ttl uint64) error {
+	if err := s.versioner.PrepareObjectForStorage(obj); err != nil {
+		return err
+	}
+	data, err := runtime.Encode(s.codec, obj)
+	if err != nil {
+		return err
+	}
+	revision, err := s.client.CreateRevision(ctx, key, data)
+	if err != nil {
+		return storageError(err, key, 0)
+	}
+	return s.decode(client.Value{Key: []byte(key), Data: data, Modified: revision}, out)
+}
+
+func (s *store) Delete(ctx context.Context, key string, out runtime.Object, preconditions *apistorage.Preconditions, validateDeletion apistorage.ValidateObjectFunc, cachedExistingObject runtime.Object) error {
+	for {
+		val, err := s.client.Get(ctx, key)
+		if err != nil {
+			return storageError(err, key, 0)
+		}
+		if err := s.decode(val, out); err != nil {
+			return err
+		}
+		if preconditions != nil {
+			if err := preconditions.Check(key, out); err != nil {
+				return err
+			}
+		}
+		if err := validateDeletion(ctx, out); err != nil {
+			return err
+		}
+		_, err = s.client.DeleteRevision(ctx, key, val.Modified)
+		// the key was written since it was read, the checks run again on its
+		// current value
+		if apierrors.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return storageError(err, key, val.Modified)
+		}
+		return nil
+	}
+}
+
+// Watch follows the change stream of the backend, so it observes the writes of
+// every replica. A zero resource version first sends the current state as
+// ADDED events.
+func (s *store) Watch(ctx context.Context, key string, opts apistorage.ListOptions) (watch.Interface, error) {
+	revision, err := s.versioner.ParseResourceVersion(opts.ResourceVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var initial []watch.Event
+	if revision == 0 {
+		current, err := s.client.Revision(ctx)
+		if err != nil {
+			return nil, apistorage.NewInternalError(err.Error())
+		}
+		revision = uint64(current)
+		vals, err := s.list(ctx, key, opts.Recursive)
+		if err != nil {
+			return nil, err
+		}
+		for _, val := range vals {
+			if val.Modified > current {
+				continue
+			}
+			obj := s.newFunc()
+			if err := s.decode(val, obj); err != nil {
+				return nil, err
+			}
+			initial = append(initial, watch.Event{Type: watch.Added, Object: obj})
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watcher{result: make(chan watch.Event), cancel: cancel}
+	go func() {
+		defer close(w.result)
+		for _, event := range initial {
+			if !s.send(ctx, w, event, opts.Predicate) {
+				return
+			}
+		}
+		for event := range s.client.Watch(ctx, key, int64(revision)) {
+			objKey := string(event.Value.Key)
+			if path.Base(path.Dir(objKey)) != s.resource || !opts.Recursive && objKey != key {
+				continue
+			}
+			obj := s.newFunc()
+			if err := s.decode(event.Value, obj); err != nil {
+				return
+			}
+			if !s.send(ctx, w, watch.Event{Type: event.Type, Object: obj}, opts.Predicate) {
+				return
+			}
+		}
+	}()
+	return w, nil
+}
+
+func (s *store) send(ctx context.Context, w *watcher, event watch.Event, predicate apistorage.SelectionPredicate) bool {
+	if matches, err := predicate.Matches(event.Object); err != nil || !matches {
+		return err == nil
+	}
+	select {
+	case w.result <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type watcher struct {
+	result chan watch.Event
+	cancel context.CancelFunc
+}
+
+func (w *watcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *watcher) Stop() {
+	w.cancel()
+}
+
+func (s *store) Get(ctx context.Context, key string, opts apistorage.GetOptions, objPtr runtime.Object) error {
+	err := s.get(ctx, key, objPtr)
+	if apistorage.IsNotFound(err) && opts.IgnoreNotFound {
+		return runtime.SetZeroValue(objPtr)
+	}
+	return err
+}
+
+func (s *store) GetList(ctx context.Context, key string, opts apistorage.ListOptions, listObj runtime.Object) error {
+	listPtr, err := meta.GetItemsPtr(listObj)
+	if err != nil {
+		return err
+	}
+	v, err := conversion.EnforcePtr(listPtr)
+	if err != nil || v.Kind() != reflect.Slice {
+		return errors.New("need a pointer to slice as list items")
+	}
+
+	vals, err := s.list(ctx, key, opts.Recursive)
+	if err != nil {
+		return err
+	}
+
+	// A zero revision is not a valid resource version, so an empty backend
+	// is reported at the first one.
+	revision, err := s.client.Revision(ctx)
+	if err != nil {
+		return apistorage.NewInternalError(err.Error())
+	}
+	revision = max(revision, 1)
+	for _, val := range vals {
+		obj := s.newFunc()
+		if err := s.decode(val, obj); err != nil {
+			return err
+		}
+		if matches, err := opts.Predicate.Matches(obj); err != nil {
+			return err
+		} else if matches {
+			v.Set(reflect.Append(v, reflect.ValueOf(obj).Elem()))
+		}
+	}
+	return s.versioner.UpdateList(listObj, uint64(revision), "", nil)
+}
+
+func (s *store) GuaranteedUpdate(ctx context.Context, key string, destination runtime.Object, ignoreNotFound bool, preconditions *apistorage.Preconditions, tryUpdate apistorage.UpdateFunc, cachedExistingObject runtime.Object) error {
+	for {
+		existing := s.newFunc()
+		val, err := s.client.Get(ctx, key)
+		found := err == nil
+		if err != nil && !isNotFound(err) {
+			return storageError(err, key, 0)
+		}
+		if !found && !ignoreNotFound {
+			return apistorage.NewKeyNotFoundError(key, 0)
+		}
+		if found {
+			if err := s.decode(val, existing); err != nil {
+				return err
+			}
+		}
+		if preconditions != nil {
+			if err := preconditions.Check(key, existing); err != nil {
+				return err
+			}
+		}
+
+		updated, _, err := tryUpdate(existing, apistorage.ResponseMeta{ResourceVersion: uint64(val.Modified)})
+		if err != nil {
+			return err
+		}
+		if err := s.versioner.PrepareObjectForStorage(updated); err != nil {
+			return err
+		}
+		data, err := runtime.Encode(s.codec, updated)
+		if err != nil {
+			return err
+		}
+
+		var revision int64
+		if found {
+			revision, err = s.client.UpdateRevision(ctx, key, val.Modified, data)
+		} else {
+			revision, err = s.client.CreateRevision(ctx, key, data)
+		}
+		// another write got in between, tryUpdate runs again on top of it
+		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) || found && isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return storageError(err, key, val.Modified)
+		}
+		return s.decode(client.Value{Key: []byte(key), Data: data, Modified: revision}, destination)
+	}
+}
+
+func (s *store) Count(key string) (int64, error) {
+	vals, err := s.list(context.TODO(), key, true)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(vals)), nil
+}
+
+func (s *store) RequestWatchProgress(ctx context.Context) error {
+	return nil
+}
+
+func (s *store) get(ctx context.Context, key string, objPtr runtime.Object) error {
+	val, err := s.client.Get(ctx, key)
+	if err != nil {
+		return storageError(err, key, 0)
+	}
+	return s.decode(val, objPtr)
+}
+
+// list returns the values of this resource stored under key, sorted by key.
+func (s *store) list(ctx context.Context, key string, recursive bool) ([]client.Value, error) {
+	if !recursive {
+		val, err := s.client.Get(ctx, key)
+		if isNotFound(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, apistorage.NewInternalError(err.Error())
+		}
+		return []client.Value{val}, nil
+	}
+
+	vals, err := s.client.List(ctx, key, 0)
+	if err != nil {
+		return nil, apistorage.NewInternalError(err.Error())
+	}
+	owned := make([]client.Value, 0, len(vals))
+	for _, val := range vals {
+		// prefixes of namespaced resources span every resource of a namespace
+		if path.Base(path.Dir(string(val.Key))) == s.resource {
+			owned = append(owned, val)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return string(owned[i].Key) < string(owned[j].Key)
+	})
+	return owned, nil
+}
+
+func (s *store) decode(val client.Value, objPtr runtime.Object) error {
+	if _, _, err := s.codec.Decode(val.Data, nil, objPtr); err != nil {
+		return apistorage.NewInternalError(err.Error())
+	}
+	return s.versioner.UpdateObject(objPtr, uint64(val.Modified))
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, client.ErrNotFound) || apierrors.IsNotFound(err)
+}
+
+// storageError translates an error of the backend about key to the errors of
+// k8s.io/apiserver/pkg/storage, which the generic registry turns into the API
+// errors of the resource.
+func storageError(err error, key string, revision int64) error {
+	switch {
+	case isNotFound(err):
+		return apistorage.NewKeyNotFoundError(key, revision)
+	case apierrors.IsAlreadyExists(err):
+		return apistorage.NewKeyExistsError(key, revision)
+	case apierrors.IsConflict(err):
+		return apistorage.NewResourceVersionConflictsError(key, revision)
+	}
+	return apistorage.NewInternalError(err.Error())
+}
@@ -0,0 +1,137 @@
+package generic
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage"
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	apistorage "k8s.io/apiserver/pkg/storage"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+func TestGeneric(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Generic Storage Test")
+}
+
+var _ = Describe("Store", func() {
+	const key = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/default/policyreports/a"
+
+	var s apistorage.Interface
+	var db storage.Storage
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha2.AddToScheme(scheme)).To(Succeed())
+		codec := serializer.NewCodecFactory(scheme).LegacyCodec(v1alpha2.SchemeGroupVersion)
+		keyFunc := func(obj runtime.Object) (string, error) {
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				return "", err
+			}
+			return "/apis/wgpolicyk8s.io/v1alpha2/namespaces/" + accessor.GetNamespace() + "/policyreports/" + accessor.GetName(), nil
+		}
+		db = inmemory.New()
+		s = New(db, codec, "policyreports", keyFunc, func() runtime.Object { return &v1alpha2.PolicyReport{} })
+	})
+
+	create := func() *v1alpha2.PolicyReport {
+		out := &v1alpha2.PolicyReport{}
+		in := &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", UID: "uid"}}
+		Expect(s.Create(ctx, key, in, out, 0)).To(Succeed())
+		return out
+	}
+
+	It("should set the backend revision as resource version", func() {
+		out := create()
+		Expect(out.ResourceVersion).To(Equal("1"))
+
+		got := &v1alpha2.PolicyReport{}
+		Expect(s.Get(ctx, key, apistorage.GetOptions{}, got)).To(Succeed())
+		Expect(got.ResourceVersion).To(Equal("1"))
+		Expect(apistorage.IsExist(s.Create(ctx, key, out.DeepCopy(), &v1alpha2.PolicyReport{}, 0))).To(BeTrue())
+	})
+
+	It("should update through tryUpdate", func() {
+		create()
+		out := &v1alpha2.PolicyReport{}
+		err := s.GuaranteedUpdate(ctx, key, out, false, nil, func(input runtime.Object, _ apistorage.ResponseMeta) (runtime.Object, *uint64, error) {
+			polr := input.(*v1alpha2.PolicyReport)
+			polr.Summary.Fail = 1
+			return polr, nil, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.Summary.Fail).To(Equal(1))
+		Expect(out.ResourceVersion).To(Equal("2"))
+	})
+
+	It("should run tryUpdate again on top of the writes made in between", func() {
+		create()
+		calls := 0
+		out := &v1alpha2.PolicyReport{}
+		err := s.GuaranteedUpdate(ctx, key, out, false, nil, func(input runtime.Object, _ apistorage.ResponseMeta) (runtime.Object, *uint64, error) {
+			calls++
+			polr := input.(*v1alpha2.PolicyReport)
+			if calls == 1 {
+				val, err := db.Get(ctx, key)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(db.Update(ctx, key, val.Modified, val.Data)).To(Succeed())
+			}
+			polr.Summary.Fail = 1
+			return polr, nil, nil
+		}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls).To(Equal(2))
+		Expect(out.ResourceVersion).To(Equal("3"))
+	})
+
+	It("should report missing keys as not found", func() {
+		err := s.GuaranteedUpdate(ctx, key, &v1alpha2.PolicyReport{}, false, nil, func(input runtime.Object, _ apistorage.ResponseMeta) (runtime.Object, *uint64, error) {
+			return input, nil, nil
+		}, nil)
+		Expect(apistorage.IsNotFound(err)).To(BeTrue())
+		validate := func(context.Context, runtime.Object) error { return nil }
+		Expect(apistorage.IsNotFound(s.Delete(ctx, key, &v1alpha2.PolicyReport{}, nil, validate, nil))).To(BeTrue())
+	})
+
+	It("should watch the writes made to the backend", func() {
+		out := create()
+		w, err := s.Watch(ctx, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/", apistorage.ListOptions{
+			ResourceVersion: out.ResourceVersion,
+			Recursive:       true,
+			Predicate:       apistorage.Everything,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer w.Stop()
+
+		validate := func(context.Context, runtime.Object) error { return nil }
+		Expect(s.Delete(ctx, key, &v1alpha2.PolicyReport{}, nil, validate, nil)).To(Succeed())
+		event := <-w.ResultChan()
+		Expect(event.Type).To(Equal(watch.Deleted))
+		Expect(event.Object.(*v1alpha2.PolicyReport).ResourceVersion).To(Equal("2"))
+	})
+
+	It("should enforce delete preconditions", func() {
+		create()
+		uid := types.UID("other")
+		validate := func(context.Context, runtime.Object) error { return nil }
+		err := s.Delete(ctx, key, &v1alpha2.PolicyReport{}, &apistorage.Preconditions{UID: &uid}, validate, nil)
+		Expect(apistorage.IsInvalidObj(err)).To(BeTrue())
+
+		Expect(s.Delete(ctx, key, &v1alpha2.PolicyReport{}, nil, validate, nil)).To(Succeed())
+		list := &v1alpha2.PolicyReportList{}
+		Expect(s.GetList(ctx, "/apis/wgpolicyk8s.io/v1alpha2/namespaces/", apistorage.ListOptions{Recursive: true, Predicate: apistorage.Everything}, list)).To(Succeed())
+		Expect(list.Items).To(BeEmpty())
+	})
+})
@@ -2,16 +2,22 @@ package inmemory
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/k3s-io/kine/pkg/client"
+	"github.com/kyverno/policy-server/pkg/storage/backend"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
 )
 
+// historySize is the number of events kept for watchers to resume from.
+const historySize = 1000
+
 var (
 	groupResource = v1alpha2.SchemeGroupVersion.WithResource("policyreportsa").GroupResource()
 )
@@ -20,11 +26,24 @@ type inMemoryDb struct {
 	sync.Mutex
 
 	db map[string]client.Value
+	// revision is bumped on every write and recorded as the modified revision
+	// of the written value, like the mod revision of etcd.
+	revision int64
+
+	history       []backend.Event
+	watchers      map[int]*memoryWatcher
+	nextWatcherID int
 }
 
-func New() client.Client {
+type memoryWatcher struct {
+	prefix string
+	events chan backend.Event
+}
+
+func New() backend.Client {
 	inMemoryDb := &inMemoryDb{
-		db: make(map[string]client.Value),
+		db:       make(map[string]client.Value),
+		watchers: make(map[int]*memoryWatcher),
 	}
 	return inMemoryDb
 }
@@ -46,6 +65,29 @@ func (i *inMemoryDb) List(ctx context.Context, prefix string, rev int) ([]client
 	return res, nil
 }
 
+// ListPage lists the current values, the database keeps no older ones.
+func (i *inMemoryDb) ListPage(ctx context.Context, prefix, start string, revision, limit int64) ([]client.Value, bool, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	var keys []string
+	for k := range i.db {
+		if strings.HasPrefix(k, prefix) && k >= start {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	more := limit > 0 && int64(len(keys)) > limit
+	if more {
+		keys = keys[:limit]
+	}
+	vals := make([]client.Value, 0, len(keys))
+	for _, k := range keys {
+		vals = append(vals, i.db[k])
+	}
+	return vals, more, nil
+}
+
 func (i *inMemoryDb) Get(ctx context.Context, key string) (client.Value, error) {
 	i.Lock()
 	defer i.Unlock()
@@ -65,66 +107,171 @@ func (i *inMemoryDb) Put(ctx context.Context, key string, value []byte) error {
 	defer i.Unlock()
 
 	klog.Infof("putting data for key:%s valuelength:%d", key, len(value))
+	eventType := watch.Added
+	if _, found := i.db[key]; found {
+		eventType = watch.Modified
+	}
 	i.db[key] = client.Value{
 		Key:      []byte(key),
 		Data:     value,
-		Modified: time.Now().Unix(),
+		Modified: i.nextRevision(),
 	}
+	i.notify(eventType, i.db[key])
 	klog.Infof("value put for key:%s", key)
 
 	return nil
 }
 
 func (i *inMemoryDb) Create(ctx context.Context, key string, value []byte) error {
+	_, err := i.CreateRevision(ctx, key, value)
+	return err
+}
+
+func (i *inMemoryDb) CreateRevision(ctx context.Context, key string, value []byte) (int64, error) {
 	i.Lock()
 	defer i.Unlock()
 
 	klog.Infof("creating entry for key:%s valuelength:%d", key, len(value))
 	if _, found := i.db[key]; found {
 		klog.Errorf("entry already exists k:%s", key)
-		return errors.NewAlreadyExists(groupResource, key)
-	} else {
-		i.db[key] = client.Value{
-			Key:      []byte(key),
-			Data:     value,
-			Modified: time.Now().Unix(),
-		}
-		klog.Infof("entry created for key:%s", key)
-		return nil
+		return 0, errors.NewAlreadyExists(groupResource, key)
+	}
+	i.db[key] = client.Value{
+		Key:      []byte(key),
+		Data:     value,
+		Modified: i.nextRevision(),
 	}
+	i.notify(watch.Added, i.db[key])
+	klog.Infof("entry created for key:%s", key)
+	return i.revision, nil
 }
 
 func (i *inMemoryDb) Update(ctx context.Context, key string, revision int64, value []byte) error {
+	_, err := i.UpdateRevision(ctx, key, revision, value)
+	return err
+}
+
+func (i *inMemoryDb) UpdateRevision(ctx context.Context, key string, revision int64, value []byte) (int64, error) {
 	i.Lock()
 	defer i.Unlock()
 
 	klog.Infof("updating entry for key:%s valuelength:%d", key, len(value))
-	if _, found := i.db[key]; !found {
-		klog.Errorf("entry does not exist k:%s", key)
-		return errors.NewNotFound(groupResource, key)
-	} else {
-		i.db[key] = client.Value{
-			Key:      []byte(key),
-			Data:     value,
-			Modified: time.Now().Unix(),
-		}
-		klog.Infof("entry updated for key:%s", key)
-		return nil
+	if err := i.check(key, revision); err != nil {
+		return 0, err
+	}
+	i.db[key] = client.Value{
+		Key:      []byte(key),
+		Data:     value,
+		Modified: i.nextRevision(),
 	}
+	i.notify(watch.Modified, i.db[key])
+	klog.Infof("entry updated for key:%s", key)
+	return i.revision, nil
 }
 
 func (i *inMemoryDb) Delete(ctx context.Context, key string, revision int64) error {
+	_, err := i.DeleteRevision(ctx, key, revision)
+	return err
+}
+
+func (i *inMemoryDb) DeleteRevision(ctx context.Context, key string, revision int64) (int64, error) {
 	i.Lock()
 	defer i.Unlock()
 
 	klog.Infof("deleting entry for key:%s", key)
-	if _, found := i.db[key]; !found {
+	if err := i.check(key, revision); err != nil {
+		return 0, err
+	}
+	val := i.db[key]
+	delete(i.db, key)
+	val.Modified = i.nextRevision()
+	i.notify(watch.Deleted, val)
+	klog.Infof("entry deleted for key:%s", key)
+	return i.revision, nil
+}
+
+// check returns an error unless key exists at revision. It must be called with
+// the lock held.
+func (i *inMemoryDb) check(key string, revision int64) error {
+	val, found := i.db[key]
+	if !found {
 		klog.Errorf("entry does not exist k:%s", key)
 		return errors.NewNotFound(groupResource, key)
-	} else {
-		delete(i.db, key)
-		klog.Infof("entry deleted for key:%s", key)
-		return nil
+	}
+	if val.Modified != revision {
+		klog.Errorf("entry was modified k:%s revision:%d current:%d", key, revision, val.Modified)
+		return errors.NewConflict(groupResource, key, fmt.Errorf("revision %d does not match %d", revision, val.Modified))
+	}
+	return nil
+}
+
+func (i *inMemoryDb) nextRevision() int64 {
+	i.revision++
+	return i.revision
+}
+
+func (i *inMemoryDb) Revision(ctx context.Context) (int64, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	return i.revision, nil
+}
+
+// Watch replays the recorded events after revision and then streams the new
+// ones. A revision older than the history closes the stream right away, as
+// does a watcher which does not keep up, so that it lists again.
+func (i *inMemoryDb) Watch(ctx context.Context, prefix string, revision int64) <-chan backend.Event {
+	i.Lock()
+	defer i.Unlock()
+
+	w := &memoryWatcher{
+		prefix: prefix,
+		events: make(chan backend.Event, 2*historySize),
+	}
+	if len(i.history) > 0 && revision < i.history[0].Value.Modified-1 {
+		close(w.events)
+		return w.events
+	}
+	for _, event := range i.history {
+		if event.Value.Modified > revision && strings.HasPrefix(string(event.Value.Key), prefix) {
+			w.events <- event
+		}
+	}
+
+	id := i.nextWatcherID
+	i.nextWatcherID++
+	i.watchers[id] = w
+	go func() {
+		<-ctx.Done()
+		i.Lock()
+		defer i.Unlock()
+		if _, found := i.watchers[id]; found {
+			delete(i.watchers, id)
+			close(w.events)
+		}
+	}()
+	return w.events
+}
+
+// notify records an event and sends it to the watchers of its key, it must be
+// called with the lock held.
+func (i *inMemoryDb) notify(eventType watch.EventType, val client.Value) {
+	event := backend.Event{Type: eventType, Value: val}
+	i.history = append(i.history, event)
+	if len(i.history) > historySize {
+		i.history = i.history[len(i.history)-historySize:]
+	}
+	for id, w := range i.watchers {
+		if !strings.HasPrefix(string(val.Key), w.prefix) {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+			klog.Errorf("watcher for prefix:%s is not keeping up, closing it", w.prefix)
+			delete(i.watchers, id)
+			close(w.events)
+		}
 	}
 }
 
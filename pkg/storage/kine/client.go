@@ -1,12 +1,30 @@
 package kine
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/k3s-io/kine/pkg/client"
 	"github.com/k3s-io/kine/pkg/endpoint"
 	"github.com/k3s-io/kine/pkg/tls"
+	"github.com/kyverno/policy-server/pkg/storage/backend"
 	"github.com/kyverno/policy-server/pkg/utils"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
 )
 
+// watchBufferSize is the number of events buffered for a slow consumer.
+const watchBufferSize = 100
+
+// keys is the resource of the errors of failed writes, which are about keys
+// of the backend.
+var keys = schema.GroupResource{Resource: "keys"}
+
 type clientConfigOpts func(*endpoint.ETCDConfig)
 
 func buildKineOpts(opts ...clientConfigOpts) endpoint.ETCDConfig {
@@ -27,13 +45,181 @@ func buildKineOpts(opts ...clientConfigOpts) endpoint.ETCDConfig {
 	return cfg
 }
 
-func New(opts ...clientConfigOpts) (client.Client, error) {
-	kClient, err := client.New(buildKineOpts(opts...))
+// kineClient adds the change stream of kine to its client. Every replica
+// watching the same endpoints observes the writes of every other replica,
+// whatever SQL database kine runs on.
+type kineClient struct {
+	client.Client
+
+	etcd *clientv3.Client
+}
+
+func New(opts ...clientConfigOpts) (backend.Client, error) {
+	cfg := buildKineOpts(opts...)
+	kClient, err := client.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// the kine client does not expose its connection, open one for watches
+	tlsConfig, err := cfg.TLSConfig.ClientConfig()
 	if err != nil {
 		return nil, err
 	}
+	etcd, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		DialTimeout: 5 * time.Second,
+		TLS:         tlsConfig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &kineClient{Client: kClient, etcd: etcd}, nil
+}
+
+func (k *kineClient) Revision(ctx context.Context) (int64, error) {
+	resp, err := k.etcd.Get(ctx, "/", clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return 0, err
+	}
+	return resp.Header.Revision, nil
+}
+
+func (k *kineClient) Watch(ctx context.Context, prefix string, revision int64) <-chan backend.Event {
+	events := make(chan backend.Event, watchBufferSize)
+	go func() {
+		defer close(events)
+
+		ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+		defer cancel()
+		for resp := range k.etcd.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(revision+1), clientv3.WithPrevKV()) {
+			if err := resp.Err(); err != nil {
+				klog.ErrorS(err, "watch failed", "prefix", prefix, "revision", revision)
+				return
+			}
+			for _, e := range resp.Events {
+				event := backend.Event{
+					Type: watch.Modified,
+					Value: client.Value{
+						Key:      e.Kv.Key,
+						Data:     e.Kv.Value,
+						Modified: e.Kv.ModRevision,
+					},
+				}
+				switch {
+				case e.Type == clientv3.EventTypeDelete:
+					event.Type = watch.Deleted
+					if e.PrevKv != nil {
+						event.Value.Data = e.PrevKv.Value
+					}
+				case e.IsCreate():
+					event.Type = watch.Added
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+func (k *kineClient) ListPage(ctx context.Context, prefix, start string, revision, limit int64) ([]client.Value, bool, error) {
+	resp, err := k.etcd.Get(ctx, start, clientv3.WithRange(clientv3.GetPrefixRangeEnd(prefix)), clientv3.WithRev(revision), clientv3.WithLimit(limit))
+	if err == rpctypes.ErrCompacted {
+		return nil, false, errors.NewResourceExpired(fmt.Sprintf("revision %d of %s was compacted", revision, prefix))
+	} else if err != nil {
+		return nil, false, err
+	}
+	vals := make([]client.Value, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		vals = append(vals, client.Value{Key: kv.Key, Data: kv.Value, Modified: kv.ModRevision})
+	}
+	return vals, resp.More, nil
+}
+
+func (k *kineClient) Create(ctx context.Context, key string, value []byte) error {
+	_, err := k.CreateRevision(ctx, key, value)
+	return err
+}
+
+func (k *kineClient) CreateRevision(ctx context.Context, key string, value []byte) (int64, error) {
+	resp, err := k.etcd.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(value))).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, errors.NewAlreadyExists(keys, key)
+	}
+	return resp.Header.Revision, nil
+}
+
+func (k *kineClient) Update(ctx context.Context, key string, revision int64, value []byte) error {
+	_, err := k.UpdateRevision(ctx, key, revision, value)
+	return err
+}
+
+func (k *kineClient) UpdateRevision(ctx context.Context, key string, revision int64, value []byte) (int64, error) {
+	resp, err := k.etcd.Txn(ctx).
+		If(matches(key, revision)).
+		Then(clientv3.OpPut(key, string(value))).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, failure(resp, key, revision)
+	}
+	return resp.Header.Revision, nil
+}
 
-	return kClient, nil
+func (k *kineClient) Delete(ctx context.Context, key string, revision int64) error {
+	_, err := k.DeleteRevision(ctx, key, revision)
+	return err
+}
+
+func (k *kineClient) DeleteRevision(ctx context.Context, key string, revision int64) (int64, error) {
+	resp, err := k.etcd.Txn(ctx).
+		If(matches(key, revision)).
+		Then(clientv3.OpDelete(key)).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, failure(resp, key, revision)
+	}
+	return resp.Header.Revision, nil
+}
+
+// matches compares key with revision, kine only supports equality.
+func matches(key string, revision int64) clientv3.Cmp {
+	return clientv3.Compare(clientv3.ModRevision(key), "=", revision)
+}
+
+// failure returns the error of a write of key at revision which did not
+// succeed, from the current value read by the transaction.
+func failure(resp *clientv3.TxnResponse, key string, revision int64) error {
+	if len(resp.Responses) == 0 || len(resp.Responses[0].GetResponseRange().Kvs) == 0 {
+		return errors.NewNotFound(keys, key)
+	}
+	current := resp.Responses[0].GetResponseRange().Kvs[0].ModRevision
+	return errors.NewConflict(keys, key, fmt.Errorf("revision %d does not match %d", revision, current))
+}
+
+func (k *kineClient) Close() error {
+	if err := k.etcd.Close(); err != nil {
+		klog.ErrorS(err, "failed to close watch connection")
+	}
+	return k.Client.Close()
 }
 
 func WithEndpoints(endpoints []string) clientConfigOpts {
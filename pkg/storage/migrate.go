@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/k3s-io/kine/pkg/client"
+	"k8s.io/klog/v2"
+)
+
+// migratePageSize is the number of keys listed from the source at a time.
+const migratePageSize = 500
+
+// MigrateResult counts the keys handled by Migrate.
+type MigrateResult struct {
+	Created int
+	Updated int
+	// Skipped keys already held the same value in the destination, from an
+	// earlier run that was interrupted for instance.
+	Skipped int
+}
+
+// Migrate copies every key under prefix from one backend to another. Values
+// are copied as they are stored, so metadata such as UIDs and creation
+// timestamps is preserved, and keys already copied are skipped so that an
+// interrupted migration can be run again. The source is read one page at a
+// time at a single revision, and the destination is verified to hold every
+// value of that revision once done.
+func Migrate(ctx context.Context, from, to Storage, prefix string) (MigrateResult, error) {
+	var result MigrateResult
+
+	revision, err := from.Revision(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to get the revision of source: %w", err)
+	}
+	klog.InfoS("Migrating keys", "prefix", prefix, "revision", revision)
+
+	err = ListPages(ctx, from, prefix, revision, migratePageSize, func(vals []client.Value) error {
+		for _, val := range vals {
+			if err := migrate(ctx, to, val, &result); err != nil {
+				return fmt.Errorf("failed to migrate %s: %w", val.Key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = ListPages(ctx, from, prefix, revision, migratePageSize, func(vals []client.Value) error {
+		for _, val := range vals {
+			migrated, err := to.Get(ctx, string(val.Key))
+			if err != nil && !IsNotFound(err) {
+				return fmt.Errorf("failed to get %s from destination: %w", val.Key, err)
+			}
+			if err != nil || !bytes.Equal(migrated.Data, val.Data) {
+				return fmt.Errorf("verification failed, %s differs in destination", val.Key)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+// migrate writes val to the destination unless it already holds it, and
+// counts the write once made.
+func migrate(ctx context.Context, to Storage, val client.Value, result *MigrateResult) error {
+	key := string(val.Key)
+	existing, err := to.Get(ctx, key)
+	switch {
+	case IsNotFound(err):
+		if err := to.Create(ctx, key, val.Data); err != nil {
+			return err
+		}
+		result.Created++
+	case err != nil:
+		return err
+	case bytes.Equal(existing.Data, val.Data):
+		result.Skipped++
+		return nil
+	default:
+		if err := to.Update(ctx, key, existing.Modified, val.Data); err != nil {
+			return err
+		}
+		result.Updated++
+	}
+	klog.V(4).InfoS("Migrated key", "key", key)
+	return nil
+}
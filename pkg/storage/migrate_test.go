@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+)
+
+var _ = Describe("Migrate", func() {
+	ctx := context.Background()
+
+	It("should copy every key and skip the ones already copied", func() {
+		from, to := inmemory.New(), inmemory.New()
+		Expect(from.Create(ctx, "/apis/a", []byte("a"))).To(Succeed())
+		Expect(from.Create(ctx, "/apis/b", []byte("b"))).To(Succeed())
+		Expect(from.Create(ctx, "/other/c", []byte("c"))).To(Succeed())
+		Expect(to.Create(ctx, "/apis/a", []byte("a"))).To(Succeed())
+
+		result, err := Migrate(ctx, from, to, "/apis/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(MigrateResult{Created: 1, Skipped: 1}))
+
+		Expect(from.Update(ctx, "/apis/b", 2, []byte("changed"))).To(Succeed())
+		result, err = Migrate(ctx, from, to, "/apis/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(MigrateResult{Updated: 1, Skipped: 1}))
+
+		val, err := to.Get(ctx, "/apis/b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(val.Data)).To(Equal("changed"))
+		_, err = to.Get(ctx, "/other/c")
+		Expect(IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should copy the keys of every page", func() {
+		from, to := inmemory.New(), inmemory.New()
+		for i := 0; i < 2*migratePageSize+1; i++ {
+			Expect(from.Create(ctx, fmt.Sprintf("/apis/%04d", i), []byte("a"))).To(Succeed())
+		}
+
+		result, err := Migrate(ctx, from, to, "/apis/")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(MigrateResult{Created: 2*migratePageSize + 1}))
+	})
+
+	It("should only count the keys it wrote", func() {
+		from := inmemory.New()
+		Expect(from.Create(ctx, "/apis/a", []byte("a"))).To(Succeed())
+
+		result, err := Migrate(ctx, from, failingCreates{inmemory.New()}, "/apis/")
+		Expect(err).To(MatchError(ContainSubstring("failed to migrate /apis/a")))
+		Expect(result).To(Equal(MigrateResult{}))
+	})
+
+	It("should only accept memory and kine urls", func() {
+		_, err := NewStorageFromURL("memory://")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = NewStorageFromURL("postgres://localhost/db")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// failingCreates is a backend failing to create keys.
+type failingCreates struct {
+	Storage
+}
+
+func (failingCreates) Create(ctx context.Context, key string, value []byte) error {
+	return errors.New("create failed")
+}
@@ -28,10 +28,33 @@ var (
 		},
 		[]string{"type"},
 	)
+	namespaceReports = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "policy_server",
+			Subsystem: "storage",
+			Name:      "namespace_reports",
+			Help:      "Number of reports stored per namespace",
+		},
+		[]string{"resource", "namespace"},
+	)
+	namespaceBytes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "policy_server",
+			Subsystem: "storage",
+			Name:      "namespace_bytes",
+			Help:      "Size of the encoded reports stored per namespace",
+		},
+		[]string{"resource", "namespace"},
+	)
 )
 
 // RegisterStorageMetrics registers a gauge metric for the number of metrics
-// points stored.
+// points stored and the storage usage per namespace.
 func RegisterStorageMetrics(registrationFunc func(metrics.Registerable) error) error {
-	return registrationFunc(pointsStored)
+	for _, m := range []metrics.Registerable{pointsStored, namespaceReports, namespaceBytes} {
+		if err := registrationFunc(m); err != nil {
+			return err
+		}
+	}
+	return nil
 }
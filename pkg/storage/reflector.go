@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/k3s-io/kine/pkg/client"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+)
+
+// listPageSize is the number of values read from the backend at a time by
+// lists without a limit.
+const listPageSize = 500
+
+// DecodeFunc decodes a value stored in the backend.
+type DecodeFunc func(data []byte) (runtime.Object, error)
+
+// Reflector keeps a WatchCache in sync with the keys of a resource in the
+// backend. It lists them at the current revision of the backend, then follows
+// its change stream from that revision on. When the stream ends, it resumes
+// from the last revision it processed, and lists again once the backend no
+// longer serves the stream from there. Writes made by any replica sharing the
+// backend reach the cache this way.
+type Reflector struct {
+	store      Storage
+	resource   string
+	prefix     string
+	watchCache *WatchCache
+	decode     DecodeFunc
+	observers  []Observer
+}
+
+// NewReflector returns a reflector for the values of resource stored under
+// prefix. Observers are notified of every value.
+func NewReflector(store Storage, resource, prefix string, watchCache *WatchCache, decode DecodeFunc, observers ...Observer) *Reflector {
+	return &Reflector{
+		store:      store,
+		resource:   resource,
+		prefix:     prefix,
+		watchCache: watchCache,
+		decode:     decode,
+		observers:  observers,
+	}
+}
+
+// Load lists the resource into the watch cache and returns the revision it
+// was listed at. Observers are notified of the changes from the previous
+// content of the cache.
+func (r *Reflector) Load(ctx context.Context) (int64, error) {
+	revision, err := r.store.Revision(ctx)
+	if err != nil {
+		return 0, err
+	}
+	vals, err := r.store.List(ctx, r.prefix, int(revision))
+	if err != nil {
+		return 0, err
+	}
+
+	objects := make(map[string]runtime.Object, len(vals))
+	sizes := make(map[string]int64, len(vals))
+	for _, val := range vals {
+		if !r.owns(val) {
+			continue
+		}
+		obj, err := r.object(val)
+		if err != nil {
+			return 0, err
+		}
+		objects[string(val.Key)] = obj
+		sizes[string(val.Key)] = int64(len(val.Data))
+	}
+	changes := r.watchCache.Replace(objects, uint64(revision))
+	for _, observer := range r.observers {
+		for key, event := range changes {
+			observer.Observe(event.Type, key, event.Object, sizes[key])
+		}
+	}
+	return revision, nil
+}
+
+// List lists the objects of the resource accepted by filter from the backend
+// at revision, in the order of their keys under prefix from start, for the
+// lists the watch cache cannot serve. If limit is positive, at most limit
+// objects are returned, along with the key of the last one when more follow.
+func (r *Reflector) List(ctx context.Context, prefix, start string, revision, limit int64, filter FilterFunc) ([]runtime.Object, string, error) {
+	if len(start) == 0 {
+		start = prefix
+	}
+	pageSize := limit
+	if pageSize <= 0 {
+		pageSize = listPageSize
+	}
+	var objects []runtime.Object
+	var last string
+	for {
+		vals, more, err := r.store.ListPage(ctx, prefix, start, revision, pageSize)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, val := range vals {
+			if !r.owns(val) {
+				continue
+			}
+			obj, err := r.object(val)
+			if err != nil {
+				return nil, "", err
+			}
+			if !filter(obj) {
+				continue
+			}
+			if limit > 0 && int64(len(objects)) == limit {
+				return objects, last, nil
+			}
+			objects = append(objects, obj)
+			last = string(val.Key)
+		}
+		if !more || len(vals) == 0 {
+			return objects, "", nil
+		}
+		start = string(vals[len(vals)-1].Key) + "\x00"
+	}
+}
+
+// Run follows the change stream from revision until ctx is done. A stream
+// which ends after delivering events is resumed right away from the last one,
+// one which ends without any is listed again after a backoff.
+func (r *Reflector) Run(ctx context.Context, revision int64) {
+	backoff := wait.Backoff{Duration: time.Second, Factor: 2, Steps: 6, Cap: 30 * time.Second}
+	for {
+		if last, received := r.watch(ctx, revision); received {
+			revision = last
+			backoff = wait.Backoff{Duration: time.Second, Factor: 2, Steps: 6, Cap: 30 * time.Second}
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff.Step()):
+		}
+
+		listed, err := r.Load(ctx)
+		if err != nil {
+			klog.ErrorS(err, "failed to list", "resource", r.resource)
+			continue
+		}
+		revision = listed
+	}
+}
+
+// watch processes the change stream from revision until it ends, and returns
+// the revision of the last event received, if any.
+func (r *Reflector) watch(ctx context.Context, revision int64) (int64, bool) {
+	received := false
+	for event := range r.store.Watch(ctx, r.prefix, revision) {
+		received = true
+		revision = max(revision, event.Value.Modified)
+		if !r.owns(event.Value) {
+			continue
+		}
+		key := string(event.Value.Key)
+		obj, err := r.object(event.Value)
+		if err != nil {
+			klog.ErrorS(err, "failed to decode event", "resource", r.resource, "key", key)
+			continue
+		}
+		// observers see the event first, so that a write visible in the
+		// watch cache is visible to them as well
+		for _, observer := range r.observers {
+			observer.Observe(event.Type, key, obj, int64(len(event.Value.Data)))
+		}
+		r.watchCache.Process(key, watch.Event{Type: event.Type, Object: obj}, uint64(event.Value.Modified))
+	}
+	return revision, received
+}
+
+// owns reports whether val belongs to the resource, prefixes of namespaced
+// resources span every resource of a namespace.
+func (r *Reflector) owns(val client.Value) bool {
+	return path.Base(path.Dir(string(val.Key))) == r.resource
+}
+
+func (r *Reflector) object(val client.Value) (runtime.Object, error) {
+	obj, err := r.decode(val.Data)
+	if err != nil {
+		return nil, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	accessor.SetResourceVersion(fmt.Sprint(val.Modified))
+	return obj, nil
+}
+
+func resourceVersionOf(obj runtime.Object) string {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return accessor.GetResourceVersion()
+}
+
+func namespaceOf(obj runtime.Object) string {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return accessor.GetNamespace()
+}
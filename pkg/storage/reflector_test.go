@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kyverno/policy-server/pkg/storage/inmemory"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+var _ = Describe("Reflector", func() {
+	const prefix = "/apis/wgpolicyk8s.io/v1alpha2/namespaces/"
+
+	everything := func(runtime.Object) bool { return true }
+	decode := func(data []byte) (runtime.Object, error) {
+		var polr v1alpha2.PolicyReport
+		return &polr, json.Unmarshal(data, &polr)
+	}
+	put := func(store Storage, name string) {
+		data, err := json.Marshal(report(name, "default"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Put(context.Background(), prefix+"default/policyreports/"+name, data)).To(Succeed())
+	}
+
+	It("should propagate the writes of other replicas", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		store := inmemory.New()
+		put(store, "a")
+		Expect(store.Put(ctx, prefix+"default/other/a", []byte("{}"))).To(Succeed())
+
+		// each replica has its own watch cache on top of the shared backend
+		caches := []*WatchCache{NewWatchCache("policyreports", 10), NewWatchCache("policyreports", 10)}
+		for _, w := range caches {
+			r := NewReflector(store, "policyreports", prefix, w, decode)
+			revision, err := r.Load(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			go r.Run(ctx, revision)
+
+			objs, _, _ := w.List(everything, "", 0)
+			Expect(objs).To(HaveLen(1))
+		}
+
+		watcher, err := caches[1].Watch(ctx, caches[1].Revision(), everything)
+		Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+
+		put(store, "b")
+		Expect(caches[0].WaitForRevision(ctx, 3)).To(Succeed())
+		event := <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Added))
+		Expect(event.Object.(*v1alpha2.PolicyReport).Name).To(Equal("b"))
+		Expect(event.Object.(*v1alpha2.PolicyReport).ResourceVersion).To(Equal("3"))
+
+		Expect(store.Delete(ctx, prefix+"default/policyreports/a", 1)).To(Succeed())
+		event = <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Deleted))
+		Expect(event.Object.(*v1alpha2.PolicyReport).Name).To(Equal("a"))
+	})
+
+	It("should list the objects of the resource from the backend, a page at a time", func() {
+		ctx := context.Background()
+		store := inmemory.New()
+		for _, name := range []string{"c", "a", "d", "b"} {
+			put(store, name)
+		}
+		Expect(store.Put(ctx, prefix+"default/other/a", []byte("{}"))).To(Succeed())
+		notB := func(obj runtime.Object) bool { return obj.(*v1alpha2.PolicyReport).Name != "b" }
+		names := func(objs []runtime.Object) []string {
+			var names []string
+			for _, obj := range objs {
+				names = append(names, obj.(*v1alpha2.PolicyReport).Name)
+			}
+			return names
+		}
+
+		r := NewReflector(store, "policyreports", prefix, NewWatchCache("policyreports", 10), decode)
+		objs, last, err := r.List(ctx, prefix, "", 0, 2, notB)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(objs)).To(Equal([]string{"a", "c"}))
+		Expect(last).To(Equal(prefix + "default/policyreports/c"))
+		objs, last, err = r.List(ctx, prefix, last+"\x00", 0, 2, notB)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(objs)).To(Equal([]string{"d"}))
+		Expect(last).To(BeEmpty())
+	})
+})
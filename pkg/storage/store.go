@@ -1,14 +1,22 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
 	"github.com/k3s-io/kine/pkg/client"
+	"github.com/kyverno/policy-server/pkg/storage/backend"
 	"github.com/kyverno/policy-server/pkg/storage/inmemory"
 	"github.com/kyverno/policy-server/pkg/storage/kine"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/klog/v2"
 )
 
 type Storage interface {
-	client.Client
+	backend.Client
 }
 
 func NewStorage(debug bool) (Storage, error) {
@@ -22,3 +30,57 @@ func NewStorage(debug bool) (Storage, error) {
 	}
 	return kineClient, nil
 }
+
+// NewStorageFromURL returns the backend addressed by rawURL, either memory://
+// for the in-memory database or the comma separated http(s) endpoints of kine.
+func NewStorageFromURL(rawURL string) (Storage, error) {
+	if rawURL == "memory://" {
+		return inmemory.New(), nil
+	}
+
+	endpoints := strings.Split(rawURL, ",")
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid storage url %q: %w", endpoint, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid storage url %q: scheme should be memory, http or https", endpoint)
+		}
+	}
+	return kine.New(kine.WithEndpoints(endpoints))
+}
+
+// ListPages calls fn with the values under prefix one page of at most
+// pageSize values at a time, in the order of their keys. Every page is listed
+// at revision, or at the current revision of the backend if zero, so that they
+// make up a consistent view of it.
+func ListPages(ctx context.Context, store Storage, prefix string, revision, pageSize int64, fn func([]client.Value) error) error {
+	if revision == 0 {
+		var err error
+		if revision, err = store.Revision(ctx); err != nil {
+			return err
+		}
+	}
+	start := prefix
+	for {
+		vals, more, err := store.ListPage(ctx, prefix, start, revision, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(vals) > 0 {
+			if err := fn(vals); err != nil {
+				return err
+			}
+		}
+		if !more || len(vals) == 0 {
+			return nil
+		}
+		start = string(vals[len(vals)-1].Key) + "\x00"
+	}
+}
+
+// IsNotFound reports whether err is the error of a backend for a missing key.
+func IsNotFound(err error) bool {
+	return errors.Is(err, client.ErrNotFound) || apierrors.IsNotFound(err)
+}
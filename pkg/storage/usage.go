@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Observer is notified by a Reflector of the values it loads and of their
+// changes, along with their decoded object and encoded size. A relist only
+// notifies the values which changed since the previous list. Objects are
+// shared with the watch cache and must not be modified.
+type Observer interface {
+	Observe(eventType watch.EventType, key string, obj runtime.Object, size int64)
+}
+
+// NamespaceUsage is the storage used by the objects of a namespace.
+type NamespaceUsage struct {
+	Reports int64 `json:"reports"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// Usage tracks the storage used by each namespace for a resource. Fed by a
+// Reflector, it accounts for the writes of every replica.
+type Usage struct {
+	sync.RWMutex
+
+	resource   string
+	entries    map[string]usageEntry
+	namespaces map[string]NamespaceUsage
+}
+
+type usageEntry struct {
+	namespace string
+	size      int64
+}
+
+// NewUsage returns an empty usage tracker for resource.
+func NewUsage(resource string) *Usage {
+	return &Usage{
+		resource:   resource,
+		entries:    make(map[string]usageEntry),
+		namespaces: make(map[string]NamespaceUsage),
+	}
+}
+
+func (u *Usage) Observe(eventType watch.EventType, key string, obj runtime.Object, size int64) {
+	u.Lock()
+	defer u.Unlock()
+
+	namespace := namespaceOf(obj)
+	if old, ok := u.entries[key]; ok {
+		delete(u.entries, key)
+		u.add(old.namespace, -1, -old.size)
+	}
+	if eventType != watch.Deleted {
+		u.entries[key] = usageEntry{namespace: namespace, size: size}
+		u.add(namespace, 1, size)
+	}
+}
+
+func (u *Usage) add(namespace string, reports, bytes int64) {
+	usage := u.namespaces[namespace]
+	usage.Reports += reports
+	usage.Bytes += bytes
+	if usage.Reports == 0 {
+		delete(u.namespaces, namespace)
+		u.forget(namespace)
+		return
+	}
+	u.namespaces[namespace] = usage
+	namespaceReports.WithLabelValues(u.resource, namespace).Set(float64(usage.Reports))
+	namespaceBytes.WithLabelValues(u.resource, namespace).Set(float64(usage.Bytes))
+}
+
+func (u *Usage) forget(namespace string) {
+	labels := map[string]string{"resource": u.resource, "namespace": namespace}
+	namespaceReports.Delete(labels)
+	namespaceBytes.Delete(labels)
+}
+
+// Namespace returns the usage of namespace.
+func (u *Usage) Namespace(namespace string) NamespaceUsage {
+	u.RLock()
+	defer u.RUnlock()
+
+	return u.namespaces[namespace]
+}
+
+// Namespaces returns the usage of every namespace holding objects.
+func (u *Usage) Namespaces() map[string]NamespaceUsage {
+	u.RLock()
+	defer u.RUnlock()
+
+	namespaces := make(map[string]NamespaceUsage, len(u.namespaces))
+	for namespace, usage := range u.namespaces {
+		namespaces[namespace] = usage
+	}
+	return namespaces
+}
+
+// Size returns the encoded size of the object stored under key.
+func (u *Usage) Size(key string) int64 {
+	u.RLock()
+	defer u.RUnlock()
+
+	return u.entries[key].size
+}
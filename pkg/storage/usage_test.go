@@ -0,0 +1,35 @@
+package storage
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var _ = Describe("Usage", func() {
+	inNamespace := func(namespace string) runtime.Object {
+		return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: namespace}}
+	}
+
+	It("should account for every change per namespace", func() {
+		usage := NewUsage("policyreports")
+		usage.Observe(watch.Added, "a", inNamespace("default"), 10)
+		usage.Observe(watch.Added, "b", inNamespace("default"), 20)
+		usage.Observe(watch.Added, "c", inNamespace("other"), 5)
+		usage.Observe(watch.Modified, "a", inNamespace("default"), 15)
+		// events replayed after a relist must not be counted twice
+		usage.Observe(watch.Modified, "a", inNamespace("default"), 15)
+		Expect(usage.Namespace("default")).To(Equal(NamespaceUsage{Reports: 2, Bytes: 35}))
+		Expect(usage.Size("a")).To(Equal(int64(15)))
+
+		usage.Observe(watch.Deleted, "c", inNamespace("other"), 5)
+		Expect(usage.Namespaces()).To(HaveLen(1))
+
+		usage.Observe(watch.Deleted, "a", inNamespace("default"), 15)
+		usage.Observe(watch.Deleted, "b", inNamespace("default"), 20)
+		Expect(usage.Namespaces()).To(BeEmpty())
+	})
+})
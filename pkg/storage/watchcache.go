@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+)
+
+const watcherBufferSize = 100
+
+// FilterFunc reports whether obj should be served to a list or watch request.
+type FilterFunc func(obj runtime.Object) bool
+
+// WatchCache keeps every object of a resource in memory, in the spirit of the
+// kube-apiserver cacher. It is loaded from storage and then fed with the change
+// stream of the backend by a Reflector, so that lists are served from memory at
+// a known revision and watches can resume from any revision still held in its
+// event window.
+type WatchCache struct {
+	sync.RWMutex
+
+	resource string
+	capacity int
+	// loaded is set once the cache is fed, the revision of an empty backend
+	// may be zero.
+	loaded   bool
+	revision uint64
+	// since is the revision from which the event window is complete.
+	since   uint64
+	objects map[string]runtime.Object
+	events  []watchCacheEvent
+	// changed is closed and replaced whenever the revision moves forward.
+	changed chan struct{}
+
+	watchers      map[int]*cacheWatcher
+	nextWatcherID int
+}
+
+type watchCacheEvent struct {
+	event watch.Event
+	// prev is the object before the event, nil if it did not exist.
+	prev     runtime.Object
+	revision uint64
+}
+
+// forWatcher returns the event as seen by a watcher with filter, following the
+// cacher semantics: an object which starts to match is ADDED, one which stops
+// to match is DELETED, and events about objects matching neither before nor
+// after are not sent.
+func (e *watchCacheEvent) forWatcher(filter FilterFunc) (watch.Event, bool) {
+	prevMatches := e.prev != nil && filter(e.prev)
+	if e.event.Type == watch.Deleted {
+		if prevMatches || (e.prev == nil && filter(e.event.Object)) {
+			return e.event, true
+		}
+		return watch.Event{}, false
+	}
+	curMatches := filter(e.event.Object)
+	switch {
+	case prevMatches && curMatches:
+		return watch.Event{Type: watch.Modified, Object: e.event.Object}, true
+	case curMatches:
+		return watch.Event{Type: watch.Added, Object: e.event.Object}, true
+	case prevMatches:
+		// the last state the watcher saw, at the revision it left the filter
+		obj := e.prev.DeepCopyObject()
+		if accessor, err := meta.Accessor(obj); err == nil {
+			accessor.SetResourceVersion(fmt.Sprint(e.revision))
+		}
+		return watch.Event{Type: watch.Deleted, Object: obj}, true
+	}
+	return watch.Event{}, false
+}
+
+// NewWatchCache returns an empty watch cache for the given resource which
+// keeps the last capacity events for watchers to resume from.
+func NewWatchCache(resource string, capacity int) *WatchCache {
+	return &WatchCache{
+		resource: resource,
+		capacity: capacity,
+		objects:  make(map[string]runtime.Object),
+		changed:  make(chan struct{}),
+		watchers: make(map[int]*cacheWatcher),
+	}
+}
+
+// Replace sets the content of the cache to objects, as of revision, and
+// returns the changes from its previous content by key. Once the cache is
+// loaded, the changes are recorded as events at revision and sent to watchers,
+// so that they do not miss what changed while the cache was not fed.
+func (w *WatchCache) Replace(objects map[string]runtime.Object, revision uint64) map[string]watch.Event {
+	w.Lock()
+	defer w.Unlock()
+
+	changes := make(map[string]watch.Event)
+	for key, prev := range w.objects {
+		if _, ok := objects[key]; !ok {
+			obj := prev.DeepCopyObject()
+			if accessor, err := meta.Accessor(obj); err == nil {
+				accessor.SetResourceVersion(fmt.Sprint(revision))
+			}
+			changes[key] = watch.Event{Type: watch.Deleted, Object: obj}
+		}
+	}
+	for key, obj := range objects {
+		prev, ok := w.objects[key]
+		switch {
+		case !ok:
+			changes[key] = watch.Event{Type: watch.Added, Object: obj}
+		case resourceVersionOf(prev) != resourceVersionOf(obj):
+			changes[key] = watch.Event{Type: watch.Modified, Object: obj}
+		}
+	}
+
+	if !w.loaded {
+		w.objects = objects
+		w.since = revision
+		w.setRevision(revision)
+		klog.InfoS("Watch cache initialized", "resource", w.resource, "objects", len(objects), "revision", revision)
+		return changes
+	}
+	// events are ordered by revision, a list is never older than the cache
+	revision = max(revision, w.revision)
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.record(key, changes[key], revision)
+	}
+	w.objects = objects
+	if revision > w.revision {
+		w.setRevision(revision)
+	}
+	klog.InfoS("Watch cache relisted", "resource", w.resource, "objects", len(objects), "changes", len(changes), "revision", revision)
+	return changes
+}
+
+// Revision returns the revision of the latest event recorded by the cache.
+func (w *WatchCache) Revision() uint64 {
+	w.RLock()
+	defer w.RUnlock()
+
+	return w.revision
+}
+
+// WaitForRevision blocks until the cache has observed revision, so that a
+// client reading after its own write sees it.
+func (w *WatchCache) WaitForRevision(ctx context.Context, revision uint64) error {
+	for {
+		w.RLock()
+		current, changed := w.revision, w.changed
+		w.RUnlock()
+		if current >= revision {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Process records event for key at revision and sends it to watchers, each of
+// which sees it relative to its filter. Events below the revision of the cache
+// were already observed and are dropped, events at the revision are changes of
+// other keys made by the same write.
+func (w *WatchCache) Process(key string, event watch.Event, revision uint64) {
+	w.Lock()
+	defer w.Unlock()
+
+	if revision < w.revision {
+		return
+	}
+	w.setRevision(revision)
+	event.Object = event.Object.DeepCopyObject()
+	w.record(key, event, revision)
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		w.objects[key] = event.Object
+	case watch.Deleted:
+		delete(w.objects, key)
+	}
+}
+
+// record appends the event for key to the window and sends it to watchers,
+// before the event is applied to the objects. It must be called with the lock
+// held.
+func (w *WatchCache) record(key string, event watch.Event, revision uint64) {
+	e := watchCacheEvent{event: event, prev: w.objects[key], revision: revision}
+	w.events = append(w.events, e)
+	if len(w.events) > w.capacity {
+		evicted := len(w.events) - w.capacity
+		w.since = w.events[evicted-1].revision
+		w.events = w.events[evicted:]
+	}
+
+	for id, watcher := range w.watchers {
+		event, ok := e.forWatcher(watcher.filter)
+		if !ok {
+			continue
+		}
+		select {
+		case watcher.input <- event:
+		default:
+			// The watcher is not keeping up, terminate it so the client
+			// re-lists instead of blocking every other watcher.
+			klog.V(2).InfoS("Terminating slow watcher", "resource", w.resource, "revision", revision)
+			delete(w.watchers, id)
+			watcher.stop()
+		}
+	}
+}
+
+func (w *WatchCache) setRevision(revision uint64) {
+	w.loaded = true
+	w.revision = revision
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// Get returns a copy of the object cached under key.
+func (w *WatchCache) Get(key string) (runtime.Object, bool) {
+	w.RLock()
+	defer w.RUnlock()
+
+	obj, ok := w.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return obj.DeepCopyObject(), true
+}
+
+// List returns copies of the cached objects accepted by filter in the order
+// of their keys from start, along with the revision they were read at. If
+// limit is positive, at most limit objects are returned, along with the key
+// of the last one when more follow.
+func (w *WatchCache) List(filter FilterFunc, start string, limit int64) ([]runtime.Object, string, uint64) {
+	w.RLock()
+	defer w.RUnlock()
+
+	keys := make([]string, 0, len(w.objects))
+	for key := range w.objects {
+		if key >= start {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var objects []runtime.Object
+	var last string
+	for _, key := range keys {
+		obj := w.objects[key]
+		if !filter(obj) {
+			continue
+		}
+		if limit > 0 && int64(len(objects)) == limit {
+			return objects, last, w.revision
+		}
+		objects = append(objects, obj.DeepCopyObject())
+		last = key
+	}
+	return objects, "", w.revision
+}
+
+// Watch starts a watch of the objects accepted by filter. A zero revision
+// first sends the current state of the cache as ADDED events, any other
+// revision replays the events recorded after it.
+func (w *WatchCache) Watch(ctx context.Context, revision uint64, filter FilterFunc) (watch.Interface, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	var initEvents []watch.Event
+	if revision == 0 {
+		for _, obj := range w.objects {
+			if filter(obj) {
+				initEvents = append(initEvents, watch.Event{Type: watch.Added, Object: obj})
+			}
+		}
+	} else {
+		if revision > w.revision {
+			return nil, errors.NewTimeoutError(fmt.Sprintf("too large resource version: %d, current: %d", revision, w.revision), 1)
+		}
+		if revision < w.since {
+			return nil, errors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (%d)", revision, w.since))
+		}
+		// backend revisions are shared by every key, they are not contiguous
+		first := sort.Search(len(w.events), func(i int) bool {
+			return w.events[i].revision > revision
+		})
+		for _, e := range w.events[first:] {
+			if event, ok := e.forWatcher(filter); ok {
+				initEvents = append(initEvents, event)
+			}
+		}
+	}
+
+	id := w.nextWatcherID
+	w.nextWatcherID++
+	watcher := &cacheWatcher{
+		input:  make(chan watch.Event, watcherBufferSize),
+		result: make(chan watch.Event),
+		done:   make(chan struct{}),
+		filter: filter,
+		forget: func() {
+			w.Lock()
+			defer w.Unlock()
+			delete(w.watchers, id)
+		},
+	}
+	w.watchers[id] = watcher
+	go watcher.run(ctx, initEvents)
+
+	return watcher, nil
+}
+
+type cacheWatcher struct {
+	input    chan watch.Event
+	result   chan watch.Event
+	done     chan struct{}
+	stopOnce sync.Once
+	filter   FilterFunc
+	forget   func()
+}
+
+func (c *cacheWatcher) ResultChan() <-chan watch.Event {
+	return c.result
+}
+
+func (c *cacheWatcher) Stop() {
+	c.stop()
+	c.forget()
+}
+
+func (c *cacheWatcher) stop() {
+	c.stopOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *cacheWatcher) run(ctx context.Context, initEvents []watch.Event) {
+	defer close(c.result)
+
+	for _, event := range initEvents {
+		if !c.send(ctx, event) {
+			return
+		}
+	}
+	for {
+		select {
+		case event := <-c.input:
+			if !c.send(ctx, event) {
+				return
+			}
+		case <-c.done:
+			return
+		case <-ctx.Done():
+			c.Stop()
+			return
+		}
+	}
+}
+
+func (c *cacheWatcher) send(ctx context.Context, event watch.Event) bool {
+	select {
+	case c.result <- event:
+		return true
+	case <-c.done:
+		return false
+	case <-ctx.Done():
+		c.Stop()
+		return false
+	}
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/wg-policy-prototypes/policy-report/pkg/api/wgpolicyk8s.io/v1alpha2"
+)
+
+func TestStorage(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Storage Test")
+}
+
+func report(name, namespace string) *v1alpha2.PolicyReport {
+	return &v1alpha2.PolicyReport{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+}
+
+var _ = Describe("WatchCache", func() {
+	everything := func(runtime.Object) bool { return true }
+
+	write := func(w *WatchCache, eventType watch.EventType, name string) {
+		revision := w.Revision() + 1
+		obj := report(name, "default")
+		obj.ResourceVersion = fmt.Sprint(revision)
+		w.Process(name, watch.Event{Type: eventType, Object: obj}, revision)
+	}
+
+	It("should list the current objects at the latest revision", func() {
+		w := NewWatchCache("policyreports", 10)
+		write(w, watch.Added, "a")
+		write(w, watch.Added, "b")
+		write(w, watch.Deleted, "a")
+
+		objs, _, rev := w.List(everything, "", 0)
+		Expect(rev).To(Equal(uint64(3)))
+		Expect(objs).To(HaveLen(1))
+	})
+
+	It("should list the objects in the order of their keys, a page at a time", func() {
+		w := NewWatchCache("policyreports", 10)
+		for _, name := range []string{"d", "b", "e", "a", "c"} {
+			write(w, watch.Added, name)
+		}
+		names := func(objs []runtime.Object) []string {
+			var names []string
+			for _, obj := range objs {
+				names = append(names, obj.(*v1alpha2.PolicyReport).Name)
+			}
+			return names
+		}
+		notC := func(obj runtime.Object) bool { return obj.(*v1alpha2.PolicyReport).Name != "c" }
+
+		objs, last, _ := w.List(notC, "", 2)
+		Expect(names(objs)).To(Equal([]string{"a", "b"}))
+		Expect(last).To(Equal("b"))
+		objs, last, _ = w.List(notC, last+"\x00", 2)
+		Expect(names(objs)).To(Equal([]string{"d", "e"}))
+		Expect(last).To(BeEmpty())
+	})
+
+	It("should replay the events after the requested revision", func() {
+		w := NewWatchCache("policyreports", 10)
+		write(w, watch.Added, "a")
+		write(w, watch.Added, "b")
+
+		watcher, err := w.Watch(context.Background(), 1, everything)
+		Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+		write(w, watch.Modified, "a")
+
+		event := <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Added))
+		Expect(event.Object.(interface{ GetName() string }).GetName()).To(Equal("b"))
+		event = <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Modified))
+	})
+
+	It("should send objects entering and leaving the filter as added and deleted", func() {
+		w := NewWatchCache("policyreports", 10)
+		labeled := func(obj runtime.Object) bool {
+			return obj.(*v1alpha2.PolicyReport).Labels["app"] == "a"
+		}
+		relabel := func(value string, revision uint64) {
+			obj := report("a", "default")
+			obj.Labels = map[string]string{"app": value}
+			obj.ResourceVersion = fmt.Sprint(revision)
+			w.Process("a", watch.Event{Type: watch.Modified, Object: obj}, revision)
+		}
+		write(w, watch.Added, "a")
+
+		watcher, err := w.Watch(context.Background(), 1, labeled)
+		Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+		relabel("a", 2)
+		relabel("a", 3)
+		relabel("b", 4)
+		relabel("c", 5)
+
+		var events []watch.EventType
+		for i := 0; i < 3; i++ {
+			event := <-watcher.ResultChan()
+			events = append(events, event.Type)
+			if event.Type == watch.Deleted {
+				Expect(event.Object.(*v1alpha2.PolicyReport).ResourceVersion).To(Equal("4"))
+			}
+		}
+		Expect(events).To(Equal([]watch.EventType{watch.Added, watch.Modified, watch.Deleted}))
+		Consistently(watcher.ResultChan()).ShouldNot(Receive())
+
+		replay, err := w.Watch(context.Background(), 1, labeled)
+		Expect(err).NotTo(HaveOccurred())
+		defer replay.Stop()
+		Expect((<-replay.ResultChan()).Type).To(Equal(watch.Added))
+		Expect((<-replay.ResultChan()).Type).To(Equal(watch.Modified))
+		Expect((<-replay.ResultChan()).Type).To(Equal(watch.Deleted))
+	})
+
+	It("should send the changes of a relist to watchers", func() {
+		w := NewWatchCache("policyreports", 10)
+		write(w, watch.Added, "a")
+		write(w, watch.Added, "b")
+		watcher, err := w.Watch(context.Background(), w.Revision(), everything)
+		Expect(err).NotTo(HaveOccurred())
+		defer watcher.Stop()
+
+		b, c := report("b", "default"), report("c", "default")
+		b.ResourceVersion, c.ResourceVersion = "2", "4"
+		changes := w.Replace(map[string]runtime.Object{"b": b, "c": c}, 5)
+		Expect(changes).To(HaveLen(2))
+		Expect(changes).To(HaveKeyWithValue("a", HaveField("Type", watch.Deleted)))
+		Expect(changes).To(HaveKeyWithValue("c", HaveField("Type", watch.Added)))
+
+		event := <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Deleted))
+		Expect(event.Object.(*v1alpha2.PolicyReport).Name).To(Equal("a"))
+		Expect(event.Object.(*v1alpha2.PolicyReport).ResourceVersion).To(Equal("5"))
+		event = <-watcher.ResultChan()
+		Expect(event.Type).To(Equal(watch.Added))
+		Expect(event.Object.(*v1alpha2.PolicyReport).Name).To(Equal("c"))
+		Consistently(watcher.ResultChan()).ShouldNot(Receive())
+		Expect(w.Revision()).To(Equal(uint64(5)))
+	})
+
+	It("should drop events it already observed", func() {
+		w := NewWatchCache("policyreports", 10)
+		write(w, watch.Added, "a")
+		write(w, watch.Added, "b")
+		w.Process("c", watch.Event{Type: watch.Added, Object: report("c", "default")}, 1)
+
+		objs, _, rev := w.List(everything, "", 0)
+		Expect(rev).To(Equal(uint64(2)))
+		Expect(objs).To(HaveLen(2))
+	})
+
+	It("should wait for a revision to be observed", func() {
+		w := NewWatchCache("policyreports", 10)
+		done := make(chan error)
+		go func() {
+			done <- w.WaitForRevision(context.Background(), 2)
+		}()
+		write(w, watch.Added, "a")
+		Consistently(done).ShouldNot(Receive())
+		write(w, watch.Added, "b")
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should expire revisions older than its event window", func() {
+		w := NewWatchCache("policyreports", 1)
+		write(w, watch.Added, "a")
+		write(w, watch.Added, "b")
+
+		_, err := w.Watch(context.Background(), 0, everything)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Watch(context.Background(), 1, everything)
+		Expect(err).NotTo(HaveOccurred())
+		w.Replace(map[string]runtime.Object{}, 5)
+		_, err = w.Watch(context.Background(), 3, everything)
+		Expect(errors.IsResourceExpired(err)).To(BeTrue())
+	})
+})
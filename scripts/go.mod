@@ -5,6 +5,7 @@ go 1.21
 require (
 	github.com/google/addlicense v1.1.1
 	golang.org/x/perf v0.0.0-20230822165715-3c60af34b3f4
+	k8s.io/gengo v0.0.0-20210813121822-485abfe95c7c
 	k8s.io/kube-openapi v0.0.0-20230816210353-14e408962443
 	sigs.k8s.io/logtools v0.7.0
 	sigs.k8s.io/mdtoc v1.1.0
@@ -38,6 +39,5 @@ require (
 	golang.org/x/tools v0.12.0 // indirect
 	google.golang.org/protobuf v1.27.1 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	k8s.io/gengo v0.0.0-20210813121822-485abfe95c7c // indirect
 	k8s.io/klog/v2 v2.2.0 // indirect
 )
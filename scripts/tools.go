@@ -3,6 +3,7 @@ package tools
 import (
 	_ "github.com/google/addlicense"
 	_ "golang.org/x/perf/cmd/benchstat"
+	_ "k8s.io/gengo/examples/deepcopy-gen"
 	_ "k8s.io/kube-openapi/cmd/openapi-gen"
 	_ "sigs.k8s.io/logtools/logcheck"
 	_ "sigs.k8s.io/mdtoc"